@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Параметры запроса, значения которых не пишутся в журнал
+var secretQueryParams = []string{"access_token"}
+
+// requestLogFormatter - формат журнала gin по умолчанию, но без секретов в query:
+// WebSocket передаёт токен в access_token, и он не должен оседать в логах.
+func requestLogFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		redactQuery(param.Path),
+		param.ErrorMessage,
+	)
+}
+
+// redactQuery заменяет значения секретных параметров в пути с query на REDACTED.
+func redactQuery(path string) string {
+	p, rawQuery, found := strings.Cut(path, "?")
+	if !found {
+		return path
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// Неразборчивый query целиком не пишем: в нём может оказаться токен
+		return p + "?REDACTED"
+	}
+	redacted := false
+	for _, name := range secretQueryParams {
+		if query.Has(name) {
+			query.Set(name, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return path
+	}
+	return p + "?" + query.Encode()
+}
@@ -8,7 +8,13 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/toxanetoxa/gohls/internal/auth"
 	"github.com/toxanetoxa/gohls/internal/db"
+	"github.com/toxanetoxa/gohls/internal/live"
+	"github.com/toxanetoxa/gohls/internal/playlist"
+	"github.com/toxanetoxa/gohls/internal/quota"
+	"github.com/toxanetoxa/gohls/internal/signedurl"
+	"github.com/toxanetoxa/gohls/internal/user"
 	"github.com/toxanetoxa/gohls/internal/video"
+	"github.com/toxanetoxa/gohls/pkg/env"
 	"github.com/toxanetoxa/gohls/pkg/logger"
 	"go.uber.org/zap"
 	"os"
@@ -48,39 +54,188 @@ func main() {
 	// Подключаемся к бд
 	connectDB := db.ConnectDB(l, dsn)
 
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.LoggerWithFormatter(requestLogFormatter), gin.Recovery())
 
 	r.MaxMultipartMemory = 100 << 20
 
+	// X-Forwarded-For учитывается только от наших прокси, иначе клиент подставит любой IP
+	// и обойдёт привязку подписанных ссылок и ограничения по адресу
+	if err := r.SetTrustedProxies(env.List("TRUSTED_PROXIES", nil)); err != nil {
+		l.Fatalw("Invalid TRUSTED_PROXIES", "error", err)
+	}
+
 	frontUri := os.Getenv("FRONT_URI")
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{frontUri},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// Определяем пользователя по токену, если он передан: от этого зависит доступ к приватным и платным видео
+	r.Use(auth.OptionalAuthMiddleware(connectDB))
+
 	videoHandler := video.NewVideoHandler(connectDB)
+	liveHandler := live.NewLiveHandler(connectDB, videoHandler)
+	quotaHandler := quota.NewQuotaHandler(connectDB)
+	playlistHandler := playlist.NewPlaylistHandler(connectDB)
 
 	// Регистрация
 	r.POST("/register", auth.RegisterHandler(connectDB))
 	// Авторизация
 	r.POST("/login", auth.LoginHandler(connectDB))
 	// Маршрут для стриминга видео
-	r.GET("/videos/:id/stream", videoHandler.StreamVideo)
+	r.GET("/videos/:id/stream", signedurl.Middleware(videoHandler.Signer, signedurl.RequestPath), videoHandler.StreamVideo)
 	r.GET("/videos/:id/views", videoHandler.GetVideoViews)
+	// Рекомендации: тренды и похожие видео
+	r.GET("/videos/trending", videoHandler.GetTrending)
+	r.GET("/videos/:id/related", videoHandler.GetRelated)
+	r.GET("/videos/:id/active-viewers", videoHandler.ActiveViewersWS)
 	r.GET("/video/:id/info", videoHandler.GetVideoInfo)
-	r.GET("/video/:id/chunk", videoHandler.GetVideoChunk)
+	r.GET("/video/:id/chunk", signedurl.Middleware(videoHandler.Signer, signedurl.RequestPath), videoHandler.GetVideoChunk)
+	r.GET("/videos/:id/thumbnail", videoHandler.GetThumbnail)
+	r.GET("/videos/:id/thumbnails", videoHandler.ListThumbnails)
+	r.GET("/videos/:id/storyboard.vtt", videoHandler.GetStoryboardVTT)
+	r.GET("/videos/:id/storyboard/:file", videoHandler.GetStoryboardSprite)
+	r.GET("/videos/:id/hls/*path", signedurl.Middleware(videoHandler.Signer, video.HLSSignedPrefix), videoHandler.ServeHLS)
+	r.GET("/videos/:id/dash/manifest.mpd", videoHandler.GetDASHManifest)
+	r.GET("/videos/:id/audio", signedurl.Middleware(videoHandler.Signer, signedurl.RequestPath), videoHandler.DownloadAudio)
+	r.GET("/videos/:id/keys/:kid", videoHandler.GetContentKey)
+	r.GET("/videos/:id/subtitles", videoHandler.ListSubtitles)
+	r.GET("/videos/:id/subtitles/:track", videoHandler.GetSubtitle)
+	// Поиск по названию, тегам и описанию
+	r.GET("/search", videoHandler.Search)
+	// Каталог: разделы и теги
+	r.GET("/categories", videoHandler.ListCategories)
+	r.GET("/categories/:slug/videos", videoHandler.ListCategoryVideos)
+	r.GET("/tags/:tag/videos", videoHandler.ListTagVideos)
+	// Каналы авторов
+	r.GET("/channels/:id", videoHandler.GetChannel)
+	// Комментарии: чтение с учётом видимости видео
+	r.GET("/videos/:id/comments", videoHandler.ListComments)
+	r.GET("/comments/:id/replies", videoHandler.ListReplies)
+	// Плейлисты: просмотр с учётом видимости
+	r.GET("/playlists/:id", playlistHandler.GetPlaylist)
+	r.GET("/playlists/:id/next", playlistHandler.NextItem)
+	r.GET("/users/:id/playlists", playlistHandler.ListUserPlaylists)
 
-	// Защищенные эндпоинт
-	authGroup := r.Group("/")
-	authGroup.Use(auth.AuthMiddleware())
+	// Прямые трансляции: просмотр и приём данных от кодировщика (авторизация по ключу трансляции)
+	r.GET("/live/:id", liveHandler.GetStream)
+	r.GET("/live/:id/hls/*file", liveHandler.ServeHLS)
+	r.GET("/live/:id/active-viewers", liveHandler.ActiveViewersWS)
+	r.PUT("/live/ingest/*file", liveHandler.Ingest)
+	r.POST("/live/ingest/*file", liveHandler.Ingest)
+	r.DELETE("/live/ingest/*file", liveHandler.Ingest)
+
+	// Защищенные эндпоинт. API-ключи принимаются только группами с областью (scope),
+	// остальные защищённые маршруты доступны лишь JWT-сессиям
+	uploadGroup := r.Group("/", auth.AuthMiddleware(connectDB, auth.ScopeVideosUpload))
 	{
 		// Маршрут для загрузки видео
-		authGroup.POST("/videos/upload", videoHandler.UploadVideo)
+		uploadGroup.POST("/videos/upload", videoHandler.UploadVideo)
+
+		// Управление трансляциями
+		uploadGroup.POST("/live/streams", liveHandler.CreateStream)
+		uploadGroup.GET("/live/streams", liveHandler.ListStreams)
+		uploadGroup.PATCH("/live/streams/:id", liveHandler.UpdateStream)
+		uploadGroup.POST("/live/streams/:id/key", liveHandler.RotateStreamKey)
+		uploadGroup.POST("/live/streams/:id/end", liveHandler.EndStream)
+	}
+
+	writeGroup := r.Group("/", auth.AuthMiddleware(connectDB, auth.ScopeVideosWrite))
+	{
+		// Изменение метаданных и доступ к платным видео
+		writeGroup.PATCH("/videos/:id", videoHandler.UpdateVideo)
+		writeGroup.POST("/videos/:id/entitlements", videoHandler.GrantEntitlement)
+		writeGroup.DELETE("/videos/:id/entitlements/:userID", videoHandler.RevokeEntitlement)
+		// Выбор и загрузка обложки
+		writeGroup.PUT("/videos/:id/thumbnail", videoHandler.SelectThumbnail)
+		writeGroup.POST("/videos/:id/thumbnail", videoHandler.UploadThumbnail)
+		// Субтитры
+		writeGroup.POST("/videos/:id/subtitles", videoHandler.UploadSubtitle)
+		writeGroup.DELETE("/videos/:id/subtitles/:track", videoHandler.DeleteSubtitle)
+		// Закрепление комментариев автором видео
+		writeGroup.PUT("/comments/:id/pin", videoHandler.PinComment)
+		writeGroup.DELETE("/comments/:id/pin", videoHandler.UnpinComment)
+
+		// Изменение плейлистов, включая "Смотреть позже" (псевдоним watch-later вместо id)
+		writeGroup.POST("/playlists", playlistHandler.CreatePlaylist)
+		writeGroup.PATCH("/playlists/:id", playlistHandler.UpdatePlaylist)
+		writeGroup.DELETE("/playlists/:id", playlistHandler.DeletePlaylist)
+		writeGroup.POST("/playlists/:id/items", playlistHandler.AddItem)
+		writeGroup.PUT("/playlists/:id/items", playlistHandler.ReorderItems)
+		writeGroup.DELETE("/playlists/:id/items/:videoID", playlistHandler.RemoveItem)
+	}
+
+	analyticsGroup := r.Group("/", auth.AuthMiddleware(connectDB, auth.ScopeAnalyticsRead))
+	{
+		// Квота и занятое место текущего пользователя
+		analyticsGroup.GET("/auth/me/usage", quotaHandler.GetMyUsage)
+	}
+
+	authGroup := r.Group("/")
+	authGroup.Use(auth.AuthMiddleware(connectDB))
+	{
+		// Подписки на каналы и лента подписок
+		authGroup.POST("/channels/:id/subscription", videoHandler.Subscribe)
+		authGroup.DELETE("/channels/:id/subscription", videoHandler.Unsubscribe)
+		authGroup.GET("/auth/me/subscriptions", videoHandler.ListSubscriptions)
+		authGroup.GET("/feed", videoHandler.GetFeed)
+
+		// Уведомления: список, отметка прочтения, настройки и WebSocket для доставки в реальном времени
+		authGroup.GET("/notifications", videoHandler.ListNotifications)
+		authGroup.POST("/notifications/read", videoHandler.MarkNotificationsRead)
+		authGroup.POST("/notifications/:id/read", videoHandler.MarkNotificationRead)
+		authGroup.GET("/notifications/preferences", videoHandler.GetNotificationPreferences)
+		authGroup.PUT("/notifications/preferences", videoHandler.UpdateNotificationPreferences)
+		authGroup.GET("/notifications/ws", videoHandler.NotificationsWS)
+
+		// Жалобы на видео и комментарии
+		authGroup.POST("/videos/:id/report", videoHandler.ReportVideo)
+		authGroup.POST("/comments/:id/report", videoHandler.ReportComment)
+
+		// Реакции на видео
+		authGroup.PUT("/videos/:id/reaction", videoHandler.React)
+		authGroup.DELETE("/videos/:id/reaction", videoHandler.Unreact)
+
+		// Комментарии: публикация, правка и удаление автором
+		authGroup.POST("/videos/:id/comments", videoHandler.CreateComment)
+		authGroup.PATCH("/comments/:id", videoHandler.UpdateComment)
+		authGroup.DELETE("/comments/:id", videoHandler.DeleteComment)
+
+		// Плейлисты текущего пользователя
+		authGroup.GET("/playlists", playlistHandler.ListMyPlaylists)
+
+		// Персональные API-ключи
+		authGroup.POST("/auth/keys", auth.CreateAPIKeyHandler(connectDB))
+		authGroup.GET("/auth/keys", auth.ListAPIKeysHandler(connectDB))
+		authGroup.DELETE("/auth/keys/:id", auth.RevokeAPIKeyHandler(connectDB))
+		// История просмотра и позиция для продолжения
+		authGroup.POST("/videos/:id/heartbeat", videoHandler.Heartbeat)
+		authGroup.GET("/auth/me/history", videoHandler.GetHistory)
+		authGroup.DELETE("/auth/me/history", videoHandler.DeleteHistory)
+		authGroup.DELETE("/auth/me/history/:videoID", videoHandler.DeleteHistoryEntry)
+
+		// Администрирование: квоты и роли пользователей
+		adminGroup := authGroup.Group("/admin", auth.RequireRole(connectDB, user.RoleAdmin))
+		adminGroup.GET("/users/:id/quota", quotaHandler.GetUserQuota)
+		adminGroup.PUT("/users/:id/quota", quotaHandler.SetUserQuota)
+		adminGroup.DELETE("/users/:id/quota", quotaHandler.DeleteUserQuota)
+		adminGroup.PUT("/users/:id/role", quotaHandler.SetUserRole)
+		adminGroup.POST("/categories", videoHandler.CreateCategory)
+		adminGroup.PATCH("/categories/:id", videoHandler.UpdateCategory)
+		adminGroup.DELETE("/categories/:id", videoHandler.DeleteCategory)
+
+		// Модерация: очередь жалоб, решения и их журнал (модераторы и администраторы)
+		moderationGroup := authGroup.Group("/moderation", auth.RequireRole(connectDB, user.RoleModerator, user.RoleAdmin))
+		moderationGroup.GET("/reports", videoHandler.ListReports)
+		moderationGroup.GET("/reports/:type/:id", videoHandler.ListTargetReports)
+		moderationGroup.POST("/reports/:type/:id/action", videoHandler.Moderate)
+		moderationGroup.GET("/actions", videoHandler.ListModerationActions)
 	}
 
 	err := r.Run(":8080")
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Префикс, по которому API-ключ отличается от JWT
+const apiKeyPrefix = "ghls_"
+
+// Доступные области (scopes) API-ключей
+const (
+	ScopeVideosUpload  = "videos:upload"
+	ScopeVideosWrite   = "videos:write"
+	ScopeAnalyticsRead = "analytics:read"
+)
+
+var knownScopes = map[string]bool{
+	ScopeVideosUpload:  true,
+	ScopeVideosWrite:   true,
+	ScopeAnalyticsRead: true,
+}
+
+var errInvalidAPIKey = errors.New("invalid api key")
+
+// APIKey - персональный ключ пользователя для скриптов и автоматизации.
+// Сам ключ не хранится, только его sha256-хеш и видимый префикс.
+type APIKey struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"not null"`
+	Name       string `gorm:"not null"`
+	Prefix     string `gorm:"unique;not null"`
+	KeyHash    string `gorm:"not null"`
+	Scopes     string `gorm:"not null"` // Список через запятую
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+// ScopeList возвращает области ключа в виде среза.
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// Active проверяет, что ключ не отозван и не истёк.
+func (k *APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// generateAPIKey создаёт новый ключ вида ghls_<prefix>_<secret> и возвращает его вместе с префиксом.
+func generateAPIKey() (key, prefix string, err error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	encoded := hex.EncodeToString(buf)
+	prefix = apiKeyPrefix + encoded[:8]
+	return prefix + "_" + encoded[8:], prefix, nil
+}
+
+// hashAPIKey возвращает sha256-хеш ключа в hex.
+// Ключи высокоэнтропийные, поэтому bcrypt здесь не нужен.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseAPIKeyPrefix выделяет видимый префикс из полного ключа.
+func parseAPIKeyPrefix(key string) (string, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", errInvalidAPIKey
+	}
+	i := strings.LastIndex(key, "_")
+	if i <= len(apiKeyPrefix) {
+		return "", errInvalidAPIKey
+	}
+	return key[:i], nil
+}
+
+// checkAPIKeyHash сравнивает ключ с сохранённым хешем за постоянное время.
+func checkAPIKeyHash(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashAPIKey(key)), []byte(hash)) == 1
+}
+
+// normalizeScopes проверяет и дедуплицирует список областей.
+func normalizeScopes(scopes []string) (string, error) {
+	seen := make(map[string]bool)
+	var result []string
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+		if !knownScopes[s] {
+			return "", errors.New("unknown scope: " + s)
+		}
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	if len(result) == 0 {
+		return "", errors.New("at least one scope is required")
+	}
+	return strings.Join(result, ","), nil
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toxanetoxa/gohls/internal/user"
+	"gorm.io/gorm"
+)
+
+type CreateAPIKeyRequest struct {
+	Name      string   `json:"name" binding:"required"`
+	Scopes    []string `json:"scopes" binding:"required"`
+	ExpiresIn int      `json:"expires_in_days"` // 0 - бессрочный ключ
+}
+
+type apiKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newAPIKeyResponse(k *APIKey) apiKeyResponse {
+	return apiKeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.ScopeList(),
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+		CreatedAt:  k.CreatedAt,
+	}
+}
+
+// sessionUser возвращает пользователя, вошедшего по JWT.
+// Управлять ключами через сам API-ключ нельзя.
+func sessionUser(c *gin.Context, db *gorm.DB) (*user.User, bool) {
+	if c.GetString("auth_method") != AuthMethodJWT {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys can only be managed with a login session"})
+		return nil, false
+	}
+
+	var u user.User
+	if err := db.Where("username = ?", c.GetString("username")).First(&u).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &u, true
+}
+
+// CreateAPIKeyHandler - выпуск нового API-ключа.
+// Полный ключ возвращается только один раз.
+func CreateAPIKeyHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := sessionUser(c, db)
+		if !ok {
+			return
+		}
+
+		var req CreateAPIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		scopes, err := normalizeScopes(req.Scopes)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.ExpiresIn < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days must not be negative"})
+			return
+		}
+
+		key, prefix, err := generateAPIKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+			return
+		}
+
+		k := APIKey{
+			UserID:  u.ID,
+			Name:    req.Name,
+			Prefix:  prefix,
+			KeyHash: hashAPIKey(key),
+			Scopes:  scopes,
+		}
+		if req.ExpiresIn > 0 {
+			expiresAt := time.Now().AddDate(0, 0, req.ExpiresIn)
+			k.ExpiresAt = &expiresAt
+		}
+
+		if err := db.Create(&k).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save API key", "details": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"key":     key,
+			"api_key": newAPIKeyResponse(&k),
+		})
+	}
+}
+
+// ListAPIKeysHandler - список ключей текущего пользователя.
+func ListAPIKeysHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := sessionUser(c, db)
+		if !ok {
+			return
+		}
+
+		var keys []APIKey
+		if err := db.Where("user_id = ?", u.ID).Order("created_at DESC").Find(&keys).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys", "details": err.Error()})
+			return
+		}
+
+		result := make([]apiKeyResponse, 0, len(keys))
+		for i := range keys {
+			result = append(result, newAPIKeyResponse(&keys[i]))
+		}
+
+		c.JSON(http.StatusOK, gin.H{"api_keys": result})
+	}
+}
+
+// RevokeAPIKeyHandler - отзыв ключа.
+func RevokeAPIKeyHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := sessionUser(c, db)
+		if !ok {
+			return
+		}
+
+		var k APIKey
+		if err := db.Where("id = ? AND user_id = ?", c.Param("id"), u.ID).First(&k).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API key", "details": err.Error()})
+			return
+		}
+
+		if k.RevokedAt == nil {
+			now := time.Now()
+			if err := db.Model(&k).Update("revoked_at", now).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key", "details": err.Error()})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+	}
+}
@@ -68,6 +68,7 @@ func RegisterHandler(db *gorm.DB) gin.HandlerFunc {
 			Username: req.Username,
 			Password: req.Password,
 			Email:    req.Email,
+			Role:     user.RoleUser,
 		}
 
 		// Хешируем пароль
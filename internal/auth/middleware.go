@@ -1,44 +1,194 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/toxanetoxa/gohls/internal/user"
+	"gorm.io/gorm"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// Способы аутентификации, сохраняемые в контексте под ключом auth_method
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+)
+
+// Ошибки аутентификации, их текст уходит клиенту в ответе 401
+var (
+	errTokenRequired      = errors.New("Authorization header is required")
+	errInvalidTokenFormat = errors.New("Invalid token format")
+	errInvalidToken       = errors.New("Invalid token")
+	errAPIKeyRejected     = errors.New("Invalid API key")
+	errAPIKeyInactive     = errors.New("API key is expired or revoked")
+)
+
+// AuthMiddleware принимает JWT или API-ключ (Bearer ghls_... либо заголовок X-API-Key).
+// API-ключ пропускается, только если маршрут объявил области scopes и все они есть у ключа;
+// маршруты без областей доступны только JWT-сессиям.
+func AuthMiddleware(db *gorm.DB, scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Получаем токен из заголовка Authorization
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-			c.Abort()
-			return
+		// Пользователь мог быть уже определён OptionalAuthMiddleware
+		if c.GetString("auth_method") == "" {
+			// Получаем токен из заголовка Authorization или X-API-Key
+			tokenString, err := tokenFromRequest(c)
+			if err == nil && tokenString == "" {
+				err = errTokenRequired
+			}
+			if err == nil {
+				err = authenticate(c, db, tokenString)
+			}
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
 		}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
-			c.Abort()
+		if !checkScopes(c, scopes) {
 			return
 		}
+		c.Next()
+	}
+}
+
+// OptionalAuthMiddleware определяет пользователя, если запрос содержит действующий токен.
+// Запросы без токена и с невалидным или просроченным токеном идут дальше анонимными:
+// отказ в 401 остаётся за AuthMiddleware на закрытых маршрутах.
+func OptionalAuthMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tokenString, err := tokenFromRequest(c); err == nil && tokenString != "" {
+			// Ошибку не возвращаем: с протухшим токеном должны открываться /login и публичные страницы
+			_ = authenticate(c, db, tokenString)
+		}
+		c.Next()
+	}
+}
+
+// tokenFromRequest достаёт токен из заголовков (для WebSocket - из access_token). Пустая строка - токена нет.
+func tokenFromRequest(c *gin.Context) (string, error) {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key, nil
+	}
+
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		// Браузер не может передать заголовок при открытии WebSocket, поэтому для него токен принимается в URL
+		if websocket.IsWebSocketUpgrade(c.Request) {
+			return c.Query("access_token"), nil
+		}
+		return "", nil
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return "", errInvalidTokenFormat
+	}
+	return tokenString, nil
+}
+
+// authenticate проверяет JWT или API-ключ и сохраняет пользователя в контексте.
+// Клиенту не отвечает: что делать с ошибкой, решает вызывающий middleware.
+func authenticate(c *gin.Context, db *gorm.DB, tokenString string) error {
+	if strings.HasPrefix(tokenString, apiKeyPrefix) {
+		return authenticateAPIKey(c, db, tokenString)
+	}
+
+	// Парсим токен
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	})
+
+	if err != nil || !token.Valid {
+		return errInvalidToken
+	}
+
+	// Сохраняем имя пользователя в контексте
+	c.Set("username", claims.Subject)
+	c.Set("auth_method", AuthMethodJWT)
+	return nil
+}
+
+// authenticateAPIKey проверяет API-ключ и сохраняет пользователя и области ключа в контексте.
+func authenticateAPIKey(c *gin.Context, db *gorm.DB, key string) error {
+	prefix, err := parseAPIKeyPrefix(key)
+	if err != nil {
+		return errAPIKeyRejected
+	}
+
+	var k APIKey
+	if err := db.Where("prefix = ?", prefix).First(&k).Error; err != nil || !checkAPIKeyHash(key, k.KeyHash) {
+		return errAPIKeyRejected
+	}
+
+	now := time.Now()
+	if !k.Active(now) {
+		return errAPIKeyInactive
+	}
+
+	var u user.User
+	if err := db.First(&u, k.UserID).Error; err != nil {
+		return errAPIKeyRejected
+	}
+
+	// Отмечаем использование ключа, ошибка здесь не должна ломать запрос
+	db.Model(&k).UpdateColumn("last_used_at", now)
+
+	c.Set("username", u.Username)
+	c.Set("auth_method", AuthMethodAPIKey)
+	c.Set("scopes", k.ScopeList())
+	return nil
+}
 
-		// Парсим токен
-		claims := &jwt.RegisteredClaims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
+// checkScopes пропускает JWT-сессии и API-ключи со всеми областями маршрута.
+// Маршрут без областей API-ключам недоступен.
+func checkScopes(c *gin.Context, scopes []string) bool {
+	if c.GetString("auth_method") != AuthMethodAPIKey {
+		return true
+	}
+	if len(scopes) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys are not accepted on this route"})
+		c.Abort()
+		return false
+	}
+	keyScopes := c.GetStringSlice("scopes")
+	for _, scope := range scopes {
+		if !slices.Contains(keyScopes, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing required scope", "scope": scope})
+			c.Abort()
+			return false
+		}
+	}
+	return true
+}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+// RequireRole пропускает только пользователей с одной из указанных ролей.
+// API-ключи не принимаются: действия от имени роли требуют JWT-сессии.
+func RequireRole(db *gorm.DB, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_method") == AuthMethodAPIKey {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys are not accepted on this route"})
+			c.Abort()
+			return
+		}
+		var u user.User
+		if err := db.Where("username = ?", c.GetString("username")).First(&u).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+		if !slices.Contains(roles, u.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient role", "roles": roles})
 			c.Abort()
 			return
 		}
-
-		// Сохраняем имя пользователя в контексте
-		c.Set("username", claims.Subject)
 		c.Next()
 	}
 }
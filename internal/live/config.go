@@ -0,0 +1,33 @@
+package live
+
+import (
+	"time"
+
+	"github.com/toxanetoxa/gohls/pkg/env"
+)
+
+// Настройки прямых трансляций. Читаются из окружения в loadConfig, которую вызывает NewLiveHandler:
+// при инициализации пакета .env ещё не загружен.
+var (
+	// Целевая длительность полного сегмента, из частей собирается сегмент не короче неё
+	liveSegmentDuration float64
+	// Целевая длительность части (LL-HLS), должна совпадать с -hls_time у кодировщика
+	livePartTarget float64
+	// Глубина DVR: сколько последних секунд эфира остаётся в плейлисте
+	liveDVRWindow time.Duration
+	// Через сколько без новых данных от кодировщика эфир считается завершённым
+	liveIdleTimeout time.Duration
+	// Максимальный размер одного файла, присланного кодировщиком
+	liveMaxUploadSize int64
+	// Сколько времени даётся на склейку записи эфира в видео
+	liveRecordTimeout time.Duration
+)
+
+func loadConfig() {
+	liveSegmentDuration = env.Float("LIVE_SEGMENT_DURATION", 4)
+	livePartTarget = env.Float("LIVE_PART_TARGET", 1)
+	liveDVRWindow = env.Duration("LIVE_DVR_WINDOW", 10*time.Minute)
+	liveIdleTimeout = env.Duration("LIVE_IDLE_TIMEOUT", 30*time.Second)
+	liveMaxUploadSize = env.Int64("LIVE_MAX_UPLOAD_SIZE", 64<<20)
+	liveRecordTimeout = env.Duration("LIVE_RECORD_TIMEOUT", 30*time.Minute)
+}
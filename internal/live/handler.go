@@ -0,0 +1,550 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toxanetoxa/gohls/internal/user"
+	"github.com/toxanetoxa/gohls/internal/video"
+	"github.com/toxanetoxa/gohls/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// Handler обрабатывает запросы прямых трансляций: управление ключами, приём данных и выдачу LL-HLS.
+type Handler struct {
+	DB     *gorm.DB
+	Hub    *Hub
+	Videos *video.Handler // Счётчик зрителей и обработка записей эфиров общие с обычными видео
+}
+
+// NewLiveHandler создаёт новый экземпляр Handler.
+func NewLiveHandler(db *gorm.DB, videos *video.Handler) *Handler {
+	loadConfig()
+
+	h := &Handler{
+		DB:     db,
+		Hub:    NewHub(db),
+		Videos: videos,
+	}
+	h.Hub.OnEnd = h.record
+
+	interrupted, err := h.Hub.endInterrupted()
+	if err != nil {
+		logger.Logger.Errorw("Failed to end interrupted live streams", "error", err)
+	}
+	for _, stream := range interrupted {
+		go h.recordInterrupted(stream)
+	}
+	return h
+}
+
+// viewersRoom - комната счётчика зрителей трансляции, отдельная от комнат видео.
+func viewersRoom(streamID uint) string {
+	return fmt.Sprintf("live:%d", streamID)
+}
+
+// Адрес приёма одинаков для всех трансляций, ключ передаётся заголовком X-Stream-Key или Basic-авторизацией
+const ingestURL = "/live/ingest/index.m3u8"
+
+func playbackURL(streamID uint) string {
+	return fmt.Sprintf("/live/%d/hls/index.m3u8", streamID)
+}
+
+type streamResponse struct {
+	ID          uint       `json:"id"`
+	Title       string     `json:"title"`
+	Status      string     `json:"status"`
+	StreamKey   string     `json:"stream_key"`
+	IngestURL   string     `json:"ingest_url"`
+	PlaybackURL string     `json:"playback_url"`
+	RecordVOD   bool       `json:"record_vod"`
+	TrimStart   float64    `json:"trim_start"`
+	TrimEnd     float64    `json:"trim_end"`
+	VideoID     *uint      `json:"video_id"`
+	StartedAt   *time.Time `json:"started_at"`
+	EndedAt     *time.Time `json:"ended_at"`
+}
+
+func newStreamResponse(s *Stream) streamResponse {
+	return streamResponse{
+		ID:          s.ID,
+		Title:       s.Title,
+		Status:      s.Status,
+		StreamKey:   s.StreamKey,
+		IngestURL:   ingestURL,
+		PlaybackURL: playbackURL(s.ID),
+		RecordVOD:   s.RecordVOD,
+		TrimStart:   s.TrimStart,
+		TrimEnd:     s.TrimEnd,
+		VideoID:     s.VideoID,
+		StartedAt:   s.StartedAt,
+		EndedAt:     s.EndedAt,
+	}
+}
+
+// currentUser возвращает пользователя, установленного AuthMiddleware.
+func (h *Handler) currentUser(c *gin.Context) (*user.User, error) {
+	username := c.GetString("username")
+	if username == "" {
+		return nil, errors.New("user not authenticated")
+	}
+
+	var u user.User
+	if err := h.DB.Where("username = ?", username).First(&u).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// loadStream ищет трансляцию по параметру id и при ошибке сам отвечает клиенту.
+func (h *Handler) loadStream(c *gin.Context) (*Stream, bool) {
+	streamID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stream ID"})
+		return nil, false
+	}
+
+	var s Stream
+	if err := h.DB.First(&s, streamID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Stream not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stream", "details": err.Error()})
+		return nil, false
+	}
+	return &s, true
+}
+
+// loadOwnStream ищет трансляцию и проверяет, что она принадлежит текущему пользователю.
+func (h *Handler) loadOwnStream(c *gin.Context) (*Stream, bool) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	s, ok := h.loadStream(c)
+	if !ok {
+		return nil, false
+	}
+	if s.UserID != u.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author can manage this stream"})
+		return nil, false
+	}
+	return s, true
+}
+
+type CreateStreamRequest struct {
+	Title     string `json:"title" binding:"required"`
+	RecordVOD *bool  `json:"record_vod"` // По умолчанию запись включена
+}
+
+// CreateStream создаёт трансляцию и ключ для кодировщика.
+func (h *Handler) CreateStream(c *gin.Context) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req CreateStreamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, err := generateStreamKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate stream key", "details": err.Error()})
+		return
+	}
+
+	stream := Stream{
+		UserID:    u.ID,
+		Title:     req.Title,
+		StreamKey: key,
+		Status:    StatusIdle,
+		RecordVOD: req.RecordVOD == nil || *req.RecordVOD,
+	}
+	if err := h.DB.Create(&stream).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create stream", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newStreamResponse(&stream))
+}
+
+// ListStreams возвращает трансляции текущего пользователя вместе с ключами.
+func (h *Handler) ListStreams(c *gin.Context) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var streams []Stream
+	if err := h.DB.Where("user_id = ?", u.ID).Order("id DESC").Find(&streams).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch streams", "details": err.Error()})
+		return
+	}
+
+	result := make([]streamResponse, 0, len(streams))
+	for i := range streams {
+		result = append(result, newStreamResponse(&streams[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"streams": result})
+}
+
+type UpdateStreamRequest struct {
+	Title     *string  `json:"title"`
+	RecordVOD *bool    `json:"record_vod"`
+	TrimStart *float64 `json:"trim_start"`
+	TrimEnd   *float64 `json:"trim_end"`
+}
+
+// UpdateStream изменяет название трансляции и настройки записи эфира.
+// Обрезка применяется к записи, когда эфир завершится.
+func (h *Handler) UpdateStream(c *gin.Context) {
+	stream, ok := h.loadOwnStream(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateStreamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Title != nil {
+		if *req.Title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Title must not be empty"})
+			return
+		}
+		updates["title"] = *req.Title
+	}
+	if req.RecordVOD != nil {
+		updates["record_vod"] = *req.RecordVOD
+	}
+	if req.TrimStart != nil {
+		if *req.TrimStart < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "trim_start must not be negative"})
+			return
+		}
+		updates["trim_start"] = *req.TrimStart
+	}
+	if req.TrimEnd != nil {
+		if *req.TrimEnd < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "trim_end must not be negative"})
+			return
+		}
+		updates["trim_end"] = *req.TrimEnd
+	}
+
+	if len(updates) > 0 {
+		if err := h.DB.Model(stream).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stream", "details": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, newStreamResponse(stream))
+}
+
+// RotateStreamKey выпускает новый ключ трансляции, старый перестаёт работать.
+func (h *Handler) RotateStreamKey(c *gin.Context) {
+	stream, ok := h.loadOwnStream(c)
+	if !ok {
+		return
+	}
+
+	key, err := generateStreamKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate stream key", "details": err.Error()})
+		return
+	}
+	if err := h.DB.Model(stream).Update("stream_key", key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stream key", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newStreamResponse(stream))
+}
+
+// EndStream завершает эфир, не дожидаясь остановки кодировщика.
+func (h *Handler) EndStream(c *gin.Context) {
+	stream, ok := h.loadOwnStream(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Hub.end(stream.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end stream", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Stream ended"})
+}
+
+// GetStream возвращает публичную информацию о трансляции.
+func (h *Handler) GetStream(c *gin.Context) {
+	stream, ok := h.loadStream(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":             stream.ID,
+		"title":          stream.Title,
+		"status":         stream.Status,
+		"playback_url":   playbackURL(stream.ID),
+		"active_viewers": h.Videos.ActiveViewers.GetViewers(viewersRoom(stream.ID)),
+		"started_at":     stream.StartedAt,
+		"ended_at":       stream.EndedAt,
+		"video_id":       stream.VideoID,
+	})
+}
+
+// ActiveViewersWS подключает зрителя трансляции к счётчику активных зрителей.
+func (h *Handler) ActiveViewersWS(c *gin.Context) {
+	stream, ok := h.loadStream(c)
+	if !ok {
+		return
+	}
+
+	h.Videos.ActiveViewers.ServeWS(c, viewersRoom(stream.ID))
+}
+
+// streamKeyFromRequest достаёт ключ трансляции из заголовка X-Stream-Key или пароля Basic-авторизации.
+// В URL ключ не передаётся: пути запросов попадают в логи nginx и приложения.
+func streamKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-Stream-Key"); key != "" {
+		return key
+	}
+	if _, password, ok := c.Request.BasicAuth(); ok {
+		return password
+	}
+	return ""
+}
+
+// Ingest принимает данные от кодировщика по HTTP PUT (ffmpeg -f hls -method PUT):
+// init.mp4, части fMP4 (.m4s) и плейлист, из которого берётся длительность частей.
+func (h *Handler) Ingest(c *gin.Context) {
+	key := streamKeyFromRequest(c)
+	if key == "" {
+		c.Header("WWW-Authenticate", `Basic realm="live ingest"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Stream key is required"})
+		return
+	}
+
+	var stream Stream
+	if err := h.DB.Where("stream_key = ?", key).First(&stream).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unknown stream key"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stream", "details": err.Error()})
+		return
+	}
+
+	name := strings.TrimPrefix(c.Param("file"), "/")
+	if name == "" || strings.Contains(name, "/") || strings.HasPrefix(name, ".") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file name"})
+		return
+	}
+
+	// Кодировщик удаляет старые сегменты из своего окна, а мы храним весь эфир
+	if c.Request.Method == http.MethodDelete {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	ext := path.Ext(name)
+	if ext != ".m3u8" && ext != ".m4s" && ext != ".mp4" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Only fMP4 (CMAF) ingest is supported, use -hls_segment_type fmp4"})
+		return
+	}
+
+	s, err := h.Hub.start(&stream)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start stream", "details": err.Error()})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, liveMaxUploadSize)
+	switch ext {
+	case ".m3u8":
+		data, err := io.ReadAll(body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read playlist", "details": err.Error()})
+			return
+		}
+		endList, err := s.ingestPlaylist(data)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add parts", "details": err.Error()})
+			return
+		}
+		if endList {
+			if err := h.Hub.end(stream.ID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end stream", "details": err.Error()})
+				return
+			}
+		}
+	case ".mp4":
+		name = initName
+		fallthrough
+	default:
+		if err := s.saveUpload(name, body); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file", "details": err.Error()})
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// respondNoSession отвечает на запрос к HLS трансляции, файлов эфира которой уже нет:
+// 410 со ссылкой на запись, если эфир сохранён как видео, иначе 404.
+func (h *Handler) respondNoSession(c *gin.Context, streamID uint) {
+	var stream Stream
+	err := h.DB.Select("id", "status", "video_id").First(&stream, streamID).Error
+	if err == nil && stream.Status == StatusEnded && stream.VideoID != nil {
+		c.JSON(http.StatusGone, gin.H{
+			"error":    "Stream has ended",
+			"video_id": stream.VideoID,
+			"hls_url":  fmt.Sprintf("/videos/%d/hls/master.m3u8", *stream.VideoID),
+		})
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Stream is not live"})
+}
+
+// ServeHLS отдаёт плейлист и медиафайлы эфира.
+func (h *Handler) ServeHLS(c *gin.Context) {
+	streamID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stream ID"})
+		return
+	}
+
+	s := h.Hub.get(uint(streamID))
+	if s == nil {
+		h.respondNoSession(c, uint(streamID))
+		return
+	}
+
+	name := strings.TrimPrefix(c.Param("file"), "/")
+	if name == "index.m3u8" {
+		h.servePlaylist(c, s)
+		return
+	}
+
+	// Файлы адресуются как <сессия>/<файл>, файлы прошлых эфиров уже не отдаём
+	sessionName, name, found := strings.Cut(name, "/")
+	if !found || sessionName != s.name {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	var n int
+	switch {
+	case name == initName:
+		serveLiveFile(c, filepath.Join(s.dir, initName), "video/mp4")
+	case scanName(name, "part_%d.m4s", &n):
+		// Часть из EXT-X-PRELOAD-HINT запрашивается заранее: держим запрос, пока она не появится
+		if n > s.nextPartSeq() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Part not found"})
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), blockTimeout())
+		defer cancel()
+		if !s.wait(ctx, func() bool { return s.ended || n < s.nextPart }) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Part is not available yet"})
+			return
+		}
+		serveLiveFile(c, s.partPath(n), "video/iso.segment")
+	case scanName(name, "seg_%d.m4s", &n):
+		if !s.segmentClosed(n) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Segment not found"})
+			return
+		}
+		serveLiveFile(c, s.segmentPath(n), "video/iso.segment")
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	}
+}
+
+// servePlaylist отдаёт плейлист LL-HLS. С параметрами _HLS_msn и _HLS_part запрос блокируется,
+// пока в эфире не появится указанный сегмент или часть.
+func (h *Handler) servePlaylist(c *gin.Context, s *session) {
+	if msnParam := c.Query("_HLS_msn"); msnParam != "" {
+		msn, err := strconv.Atoi(msnParam)
+		if err != nil || msn < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid _HLS_msn"})
+			return
+		}
+		partIndex := -1
+		if partParam := c.Query("_HLS_part"); partParam != "" {
+			if partIndex, err = strconv.Atoi(partParam); err != nil || partIndex < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid _HLS_part"})
+				return
+			}
+		}
+		if msn > s.segmentCount()+1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "_HLS_msn is too far in the future"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), blockTimeout())
+		defer cancel()
+		if !s.wait(ctx, func() bool { return s.ready(msn, partIndex) }) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Playlist update timed out"})
+			return
+		}
+	} else if c.Query("_HLS_part") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "_HLS_part requires _HLS_msn"})
+		return
+	}
+
+	playlist, ok := s.playlist()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stream has not started yet"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(playlist))
+}
+
+// scanName разбирает имя файла по шаблону с одним числом и проверяет, что оно совпадает целиком.
+func scanName(name, format string, n *int) bool {
+	if _, err := fmt.Sscanf(name, format, n); err != nil || *n < 0 {
+		return false
+	}
+	return name == fmt.Sprintf(format, *n)
+}
+
+func serveLiveFile(c *gin.Context, filePath, contentType string) {
+	if _, err := os.Stat(filePath); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	// Опубликованные части и сегменты не меняются
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Header("Content-Type", contentType)
+	c.File(filePath)
+}
@@ -0,0 +1,139 @@
+package live
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/toxanetoxa/gohls/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// Hub хранит состояние эфиров в памяти процесса и завершает эфиры, от которых перестали приходить данные.
+type Hub struct {
+	DB *gorm.DB
+	// OnEnd вызывается в фоне после завершения эфира
+	OnEnd func(streamID uint, s *session)
+
+	mu       sync.Mutex
+	sessions map[uint]*session // streamID -> текущая сессия
+}
+
+// NewHub создаёт Hub и запускает фоновую проверку простаивающих эфиров.
+func NewHub(db *gorm.DB) *Hub {
+	hub := &Hub{
+		DB:       db,
+		sessions: make(map[uint]*session),
+	}
+
+	go hub.reap()
+	return hub
+}
+
+// endInterrupted завершает эфиры, прерванные перезапуском сервиса: их состояние жило в памяти,
+// продолжить их нельзя. Возвращает эти трансляции, чтобы сохранить записи из файлов на диске.
+func (hub *Hub) endInterrupted() ([]Stream, error) {
+	var streams []Stream
+	if err := hub.DB.Where("status = ?", StatusLive).Find(&streams).Error; err != nil {
+		return nil, err
+	}
+	if len(streams) == 0 {
+		return nil, nil
+	}
+
+	err := hub.DB.Model(&Stream{}).Where("status = ?", StatusLive).
+		Updates(map[string]interface{}{"status": StatusEnded, "ended_at": time.Now()}).Error
+	return streams, err
+}
+
+// get возвращает текущую или последнюю сессию трансляции.
+func (hub *Hub) get(streamID uint) *session {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	return hub.sessions[streamID]
+}
+
+// release забывает завершённую сессию, если трансляция с тех пор не начала новый эфир.
+// Вызывается перед удалением файлов сессии, чтобы ServeHLS не отдавал плейлист на удалённые файлы.
+func (hub *Hub) release(streamID uint, s *session) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.sessions[streamID] == s {
+		delete(hub.sessions, streamID)
+	}
+}
+
+// start возвращает идущую сессию трансляции или начинает новый эфир.
+func (hub *Hub) start(stream *Stream) (*session, error) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	if s := hub.sessions[stream.ID]; s != nil && !s.isEnded() {
+		return s, nil
+	}
+
+	now := time.Now()
+	dir := filepath.Join("uploads", "live", strconv.FormatUint(uint64(stream.ID), 10), now.Format("20060102-150405"))
+	if err := os.MkdirAll(filepath.Join(dir, ingestDir), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	err := hub.DB.Model(stream).Updates(map[string]interface{}{
+		"status":      StatusLive,
+		"session_dir": dir,
+		"started_at":  now,
+		"ended_at":    nil,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	s := newSession(stream.ID, dir)
+	hub.sessions[stream.ID] = s
+	logger.Logger.Infow("Live stream started", "stream_id", stream.ID, "dir", dir)
+	return s, nil
+}
+
+// end завершает эфир трансляции.
+func (hub *Hub) end(streamID uint) error {
+	if s := hub.get(streamID); s != nil {
+		ended, err := s.finish()
+		if err != nil {
+			logger.Logger.Errorw("Failed to finalize live stream", "stream_id", streamID, "error", err)
+		}
+		if ended {
+			logger.Logger.Infow("Live stream ended", "stream_id", streamID)
+			if hub.OnEnd != nil {
+				go hub.OnEnd(streamID, s)
+			}
+		}
+	}
+
+	return hub.DB.Model(&Stream{}).Where("id = ? AND status = ?", streamID, StatusLive).
+		Updates(map[string]interface{}{"status": StatusEnded, "ended_at": time.Now()}).Error
+}
+
+// reap завершает эфиры, от кодировщика которых нет данных дольше LIVE_IDLE_TIMEOUT.
+func (hub *Hub) reap() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var idle []uint
+		hub.mu.Lock()
+		for id, s := range hub.sessions {
+			if !s.isEnded() && s.idleFor() > liveIdleTimeout {
+				idle = append(idle, id)
+			}
+		}
+		hub.mu.Unlock()
+
+		for _, id := range idle {
+			if err := hub.end(id); err != nil {
+				logger.Logger.Errorw("Failed to end idle live stream", "stream_id", id, "error", err)
+			}
+		}
+	}
+}
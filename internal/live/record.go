@@ -0,0 +1,198 @@
+package live
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/toxanetoxa/gohls/internal/media"
+	"github.com/toxanetoxa/gohls/internal/video"
+	"github.com/toxanetoxa/gohls/pkg/logger"
+)
+
+// recording возвращает файлы завершённого эфира по порядку (init.mp4 и сегменты) и его длительность.
+// Длительность 0 - неизвестна (сессия восстановлена с диска).
+func (s *session) recording() ([]string, float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.hasInit {
+		return nil, 0
+	}
+
+	files := []string{filepath.Join(s.dir, initName)}
+	var duration float64
+	for _, seg := range s.segments {
+		// Пропуски в запись не попадают: файлов у них нет
+		if seg.closed && !seg.gap {
+			files = append(files, s.segmentPath(seg.msn))
+			duration += seg.duration
+		}
+	}
+	return files, duration
+}
+
+// restoreSession собирает завершённую сессию из файлов эфира, прерванного перезапуском.
+// Длительности сегментов хранились в памяти и не восстанавливаются, а части
+// незакрытого последнего сегмента в запись не попадают.
+func restoreSession(streamID uint, dir string) (*session, error) {
+	s := newSession(streamID, dir)
+	s.ended = true
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		var msn int
+		switch {
+		case e.Name() == initName:
+			s.hasInit = true
+		case scanName(e.Name(), "seg_%d.m4s", &msn):
+			s.segments = append(s.segments, &segment{msn: msn, closed: true})
+		}
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].msn < s.segments[j].msn })
+	return s, nil
+}
+
+// recordInterrupted сохраняет запись эфира, прерванного перезапуском сервиса.
+func (h *Handler) recordInterrupted(stream Stream) {
+	if stream.SessionDir == "" {
+		return
+	}
+	s, err := restoreSession(stream.ID, stream.SessionDir)
+	if err != nil {
+		logger.Logger.Errorw("Failed to restore interrupted live stream", "stream_id", stream.ID, "error", err)
+		return
+	}
+	logger.Logger.Infow("Recording live stream interrupted by restart", "stream_id", stream.ID, "segments", len(s.segments))
+	h.record(stream.ID, s)
+}
+
+// record сохраняет завершённый эфир как обычное видео автора и запускает его обработку:
+// длительность, обложки, превью и HLS с #EXT-X-ENDLIST. Папка эфира удаляется, когда запись
+// сохранена или сохранять нечего; при ошибке она остаётся, чтобы запись можно было восстановить вручную.
+func (h *Handler) record(streamID uint, s *session) {
+	var stream Stream
+	if err := h.DB.First(&stream, streamID).Error; err != nil {
+		logger.Logger.Errorw("Failed to load stream for recording", "stream_id", streamID, "error", err)
+		return
+	}
+	if !stream.RecordVOD {
+		h.removeSessionDir(streamID, s)
+		return
+	}
+
+	files, duration := s.recording()
+	if len(files) < 2 {
+		logger.Logger.Infow("Live stream recording is empty, skipping", "stream_id", streamID)
+		h.removeSessionDir(streamID, s)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), liveRecordTimeout)
+	defer cancel()
+
+	if err := video.EnsureUploadsDir(); err != nil {
+		logger.Logger.Errorw("Failed to create uploads directory", "stream_id", streamID, "error", err)
+		return
+	}
+
+	// init.mp4 и фрагменты, записанные подряд, - корректный фрагментированный MP4
+	raw := filepath.Join(s.dir, "recording.mp4")
+	defer os.Remove(raw)
+	if err := concatFiles(raw, files); err != nil {
+		logger.Logger.Errorw("Failed to stitch live stream segments", "stream_id", streamID, "error", err)
+		return
+	}
+
+	if duration == 0 {
+		probe, err := h.Videos.FFmpeg.Probe(ctx, raw)
+		if err != nil {
+			logger.Logger.Errorw("Failed to probe live stream recording", "stream_id", streamID, "error", err)
+			return
+		}
+		duration = probe.Duration()
+	}
+	length := duration - stream.TrimStart - stream.TrimEnd
+	if length <= 0 {
+		logger.Logger.Infow("Live stream recording is empty, skipping", "stream_id", streamID)
+		h.removeSessionDir(streamID, s)
+		return
+	}
+
+	// Перепаковываем в обычный MP4 без перекодирования, обрезая начало и конец.
+	// Каждая часть начинается с ключевого кадра, поэтому обрезка точна до части.
+	filePath := filepath.Join("uploads", fmt.Sprintf("live_%d_%s.mp4", stream.ID, s.name))
+	args := []string{}
+	if stream.TrimStart > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(stream.TrimStart, 'f', 3, 64))
+	}
+	args = append(args, "-i", raw, "-t", strconv.FormatFloat(length, 'f', 3, 64),
+		"-map", "0", "-c", "copy", "-movflags", "+faststart", filePath)
+	if err := h.Videos.FFmpeg.Run(ctx, args...); err != nil {
+		logger.Logger.Errorw("Failed to remux live stream recording", "stream_id", streamID, "error", err)
+		return
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		logger.Logger.Errorw("Failed to stat live stream recording", "stream_id", streamID, "error", err)
+		return
+	}
+
+	// Запись учитывается в квоте автора, но не отклоняется: эфир уже состоялся
+	v := video.Video{
+		Title:    stream.Title,
+		Language: video.DetectLanguage(stream.Title),
+		FilePath: filePath,
+		FileSize: info.Size(),
+		MimeType: media.MimeMP4,
+		AuthorID: stream.UserID,
+		Status:   video.StatusProcessing,
+	}
+	if h.Videos.Scanner != nil {
+		v.ScanStatus = video.ScanPending
+	}
+	if err := h.DB.Create(&v).Error; err != nil {
+		logger.Logger.Errorw("Failed to save recording metadata", "stream_id", streamID, "error", err)
+		return
+	}
+	if err := video.UpdateSearchVector(h.DB, v.ID); err != nil {
+		logger.Logger.Errorw("Failed to index recording", "stream_id", streamID, "error", err)
+	}
+	if err := h.DB.Model(&stream).Update("video_id", v.ID).Error; err != nil {
+		logger.Logger.Errorw("Failed to link recording to stream", "stream_id", streamID, "error", err)
+	}
+
+	logger.Logger.Infow("Live stream recorded", "stream_id", streamID, "video_id", v.ID)
+	h.Videos.Pipeline.Process(v.ID)
+	h.removeSessionDir(streamID, s)
+}
+
+// removeSessionDir удаляет файлы эфира: дальше он доступен только как видео.
+// Сессия сначала убирается из Hub, иначе ServeHLS продолжил бы отдавать плейлист на удалённые файлы.
+func (h *Handler) removeSessionDir(streamID uint, s *session) {
+	h.Hub.release(streamID, s)
+	if err := os.RemoveAll(s.dir); err != nil {
+		logger.Logger.Errorw("Failed to remove live session files", "stream_id", streamID, "error", err)
+	}
+}
+
+func concatFiles(dst string, files []string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := appendFile(out, f); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	return out.Close()
+}
@@ -0,0 +1,440 @@
+package live
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/toxanetoxa/gohls/pkg/logger"
+)
+
+// Файлы эфира внутри папки сессии
+const (
+	initName  = "init.mp4" // Инициализационный сегмент fMP4
+	ingestDir = "ingest"   // Файлы кодировщика, ещё не попавшие в эфир
+)
+
+// Сколько последних сегментов хранят свои части: более старые части уже есть в склеенных сегментах
+const keepPartsSegments = 5
+
+// part - часть сегмента LL-HLS, один файл от кодировщика.
+type part struct {
+	seq      int // Сквозной номер части в эфире
+	duration float64
+	gap      bool // Файл так и не пришёл от кодировщика, в плейлисте часть помечена GAP=YES
+}
+
+// segment - полный сегмент, склеенный из частей.
+type segment struct {
+	msn      int // Media Sequence Number
+	parts    []part
+	duration float64
+	start    time.Time
+	closed   bool
+	gap      bool // Сегмент из пропущенных частей: файла нет, в плейлисте он помечен #EXT-X-GAP
+}
+
+// session - состояние одного эфира. Плейлист строится в памяти, файлы лежат в dir.
+type session struct {
+	mu         sync.Mutex
+	streamID   uint
+	dir        string
+	name       string // Имя сессии, входит в URI файлов, чтобы кеш не смешивал разные эфиры
+	hasInit    bool
+	segments   []*segment
+	nextPart   int
+	known      map[string]bool // Файлы кодировщика, уже добавленные в эфир
+	ended      bool
+	lastIngest time.Time
+	warned     bool
+	changed    chan struct{} // Закрывается при каждом обновлении эфира
+}
+
+func newSession(streamID uint, dir string) *session {
+	return &session{
+		streamID:   streamID,
+		dir:        dir,
+		name:       filepath.Base(dir),
+		known:      make(map[string]bool),
+		lastIngest: time.Now(),
+		changed:    make(chan struct{}),
+	}
+}
+
+func (s *session) partPath(seq int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("part_%d.m4s", seq))
+}
+
+func (s *session) segmentPath(msn int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("seg_%d.m4s", msn))
+}
+
+// notify будит запросы, ожидающие обновления плейлиста. Вызывается под s.mu.
+func (s *session) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// wait ждёт, пока ready не вернёт true, или отмены ctx. ready вызывается под s.mu.
+func (s *session) wait(ctx context.Context, ready func() bool) bool {
+	for {
+		s.mu.Lock()
+		ok := ready()
+		changed := s.changed
+		s.mu.Unlock()
+
+		if ok {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// saveUpload сохраняет файл кодировщика. Части попадают в эфир, только когда их перечислит
+// плейлист кодировщика: из него берётся длительность части.
+func (s *session) saveUpload(name string, r io.Reader) error {
+	dst := filepath.Join(s.dir, ingestDir, name)
+	if name == initName {
+		dst = filepath.Join(s.dir, initName)
+	}
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastIngest = time.Now()
+	if name == initName {
+		s.hasInit = true
+		s.notify()
+	}
+	return nil
+}
+
+// ingestPlaylist добавляет в эфир новые части из плейлиста кодировщика.
+// Возвращает true, если кодировщик завершил эфир (#EXT-X-ENDLIST).
+func (s *session) ingestPlaylist(data []byte) (bool, error) {
+	entries, endList := parseMediaPlaylist(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastIngest = time.Now()
+
+	// Последняя часть плейлиста, файл которой уже есть. Всё, что после неё, ещё может дойти,
+	// а ненайденные части до неё кодировщик потерял: их пропускаем, чтобы эфир не встал
+	last := -1
+	for i, e := range entries {
+		if s.known[e.uri] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(s.dir, ingestDir, e.uri)); err == nil {
+			last = i
+		}
+	}
+	for _, e := range entries[:last+1] {
+		if s.known[e.uri] {
+			continue
+		}
+		src := filepath.Join(s.dir, ingestDir, e.uri)
+		_, missing := os.Stat(src)
+		if err := s.addPart(src, e.duration, missing != nil); err != nil {
+			return false, err
+		}
+		s.known[e.uri] = true
+	}
+	s.notify()
+
+	return endList, nil
+}
+
+// addPart добавляет часть в открытый сегмент. Пропущенная часть (gap) файла не имеет:
+// пропуски собираются в отдельные сегменты, чтобы остальные сегменты оставались целыми.
+// Вызывается под s.mu.
+func (s *session) addPart(src string, duration float64, gap bool) error {
+	seg := s.openSegment()
+	// Новая часть начинает следующий сегмент, если текущий уже набрал целевую длительность.
+	// Кодировщик режет файлы по ключевым кадрам, поэтому каждая часть независимая.
+	if seg != nil && (seg.duration >= liveSegmentDuration || seg.gap != gap) {
+		if err := s.closeSegment(seg); err != nil {
+			return err
+		}
+		seg = nil
+	}
+	if seg == nil {
+		seg = &segment{msn: len(s.segments), start: time.Now(), gap: gap}
+		s.segments = append(s.segments, seg)
+	}
+
+	seq := s.nextPart
+	s.nextPart++
+	if gap {
+		logger.Logger.Warnw("Live part is missing, marking it as a gap", "stream_id", s.streamID, "part", seq)
+		seg.parts = append(seg.parts, part{seq: seq, duration: duration, gap: true})
+		seg.duration += duration
+		return nil
+	}
+
+	if duration > livePartTarget && !s.warned {
+		s.warned = true
+		logger.Logger.Warnw("Live part is longer than LIVE_PART_TARGET, check encoder keyframe interval",
+			"stream_id", s.streamID, "duration", duration)
+	}
+
+	if err := os.Rename(src, s.partPath(seq)); err != nil {
+		return err
+	}
+	seg.parts = append(seg.parts, part{seq: seq, duration: duration})
+	seg.duration += duration
+	return nil
+}
+
+// openSegment возвращает сегмент, в который ещё добавляются части.
+func (s *session) openSegment() *segment {
+	if n := len(s.segments); n > 0 && !s.segments[n-1].closed {
+		return s.segments[n-1]
+	}
+	return nil
+}
+
+// closeSegment склеивает части сегмента в один файл: фрагменты fMP4 можно записать подряд.
+// У сегмента-пропуска файла нет, он только закрывается.
+func (s *session) closeSegment(seg *segment) error {
+	if !seg.gap {
+		tmp := s.segmentPath(seg.msn) + ".tmp"
+		out, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		for _, p := range seg.parts {
+			if err := appendFile(out, s.partPath(p.seq)); err != nil {
+				out.Close()
+				return err
+			}
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, s.segmentPath(seg.msn)); err != nil {
+			return err
+		}
+	}
+	seg.closed = true
+
+	if old := seg.msn - keepPartsSegments; old >= 0 {
+		for _, p := range s.segments[old].parts {
+			_ = os.Remove(s.partPath(p.seq))
+		}
+	}
+	return nil
+}
+
+func appendFile(w io.Writer, filePath string) error {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(w, in)
+	return err
+}
+
+// finish завершает эфир. Возвращает false, если эфир уже был завершён.
+func (s *session) finish() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ended {
+		return false, nil
+	}
+
+	var err error
+	if seg := s.openSegment(); seg != nil {
+		err = s.closeSegment(seg)
+	}
+	s.ended = true
+	s.notify()
+	_ = os.RemoveAll(filepath.Join(s.dir, ingestDir))
+
+	return true, err
+}
+
+func (s *session) isEnded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ended
+}
+
+func (s *session) idleFor() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Since(s.lastIngest)
+}
+
+// ready проверяет, есть ли в эфире часть partIndex сегмента msn (partIndex < 0 - весь сегмент). Вызывается под s.mu.
+func (s *session) ready(msn, partIndex int) bool {
+	if s.ended {
+		return true
+	}
+	if msn >= len(s.segments) {
+		return false
+	}
+	seg := s.segments[msn]
+	return seg.closed || (partIndex >= 0 && partIndex < len(seg.parts))
+}
+
+func (s *session) segmentCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments)
+}
+
+func (s *session) nextPartSeq() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nextPart
+}
+
+func (s *session) segmentClosed(msn int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return msn >= 0 && msn < len(s.segments) && s.segments[msn].closed
+}
+
+// targetDuration - EXT-X-TARGETDURATION. Сегмент закрывается, набрав LIVE_SEGMENT_DURATION,
+// поэтому он может быть длиннее не больше чем на одну часть.
+func targetDuration() int {
+	return int(math.Ceil(liveSegmentDuration + livePartTarget))
+}
+
+// blockTimeout - сколько держать блокирующий запрос плейлиста или части.
+func blockTimeout() time.Duration {
+	return time.Duration(3*targetDuration()) * time.Second
+}
+
+// playlist строит медиаплейлист LL-HLS с окном DVR. Возвращает false, пока в эфире нет ни одной части.
+func (s *session) playlist() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.hasInit || s.nextPart == 0 {
+		return "", false
+	}
+
+	target := targetDuration()
+
+	// Окно DVR: последние сегменты общей длительностью не больше LIVE_DVR_WINDOW
+	first := len(s.segments)
+	var total float64
+	for i := len(s.segments) - 1; i >= 0; i-- {
+		total += s.segments[i].duration
+		if total > liveDVRWindow.Seconds() && first < len(s.segments) {
+			break
+		}
+		first = i
+	}
+
+	// Части перечисляются только для последних трёх целевых длительностей
+	partsFrom := len(s.segments)
+	var tail float64
+	for i := len(s.segments) - 1; i >= first && tail < float64(3*target); i-- {
+		tail += s.segments[i].duration
+		partsFrom = i
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:6\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", target)
+	if !s.ended {
+		fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", 3*livePartTarget)
+	}
+	fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", livePartTarget)
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", first)
+	fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s/%s\"\n", s.name, initName)
+
+	for i := first; i < len(s.segments); i++ {
+		seg := s.segments[i]
+		if i == first {
+			fmt.Fprintf(&b, "#EXT-X-PROGRAM-DATE-TIME:%s\n", seg.start.UTC().Format("2006-01-02T15:04:05.000Z"))
+		}
+		if i >= partsFrom {
+			for _, p := range seg.parts {
+				if p.gap {
+					fmt.Fprintf(&b, "#EXT-X-PART:DURATION=%.3f,URI=\"%s/part_%d.m4s\",GAP=YES\n", p.duration, s.name, p.seq)
+					continue
+				}
+				fmt.Fprintf(&b, "#EXT-X-PART:DURATION=%.3f,URI=\"%s/part_%d.m4s\",INDEPENDENT=YES\n", p.duration, s.name, p.seq)
+			}
+		}
+		if seg.closed {
+			if seg.gap {
+				b.WriteString("#EXT-X-GAP\n")
+			}
+			fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s/seg_%d.m4s\n", seg.duration, s.name, seg.msn)
+		}
+	}
+
+	if s.ended {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	} else {
+		fmt.Fprintf(&b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"%s/part_%d.m4s\"\n", s.name, s.nextPart)
+	}
+
+	return b.String(), true
+}
+
+type playlistEntry struct {
+	uri      string
+	duration float64
+}
+
+// parseMediaPlaylist разбирает медиаплейлист кодировщика: файлы сегментов и их длительность.
+func parseMediaPlaylist(data []byte) ([]playlistEntry, bool) {
+	var entries []playlistEntry
+	var duration float64
+	endList := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			duration, _ = strconv.ParseFloat(value, 64)
+		case line == "#EXT-X-ENDLIST":
+			endList = true
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			entries = append(entries, playlistEntry{uri: filepath.Base(line), duration: duration})
+			duration = 0
+		}
+	}
+	return entries, endList
+}
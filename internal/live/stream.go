@@ -0,0 +1,45 @@
+package live
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Статусы трансляции
+const (
+	StatusIdle  = "idle"  // Ключ создан, эфир ещё не начинался
+	StatusLive  = "live"  // Идёт эфир
+	StatusEnded = "ended" // Эфир завершён
+)
+
+// Stream - прямая трансляция автора. Кодировщик отправляет данные по ключу StreamKey.
+type Stream struct {
+	ID         uint    `gorm:"primaryKey"`
+	UserID     uint    `gorm:"not null"`
+	Title      string  `gorm:"not null"`
+	StreamKey  string  `gorm:"unique;not null"`
+	Status     string  `gorm:"not null;default:idle"`
+	SessionDir string  // Папка с сегментами текущего или последнего эфира
+	RecordVOD  bool    `gorm:"column:record_vod;not null;default:true"` // Сохранять эфир как видео после окончания
+	TrimStart  float64 `gorm:"not null;default:0"`                      // Сколько секунд обрезать в начале записи
+	TrimEnd    float64 `gorm:"not null;default:0"`                      // Сколько секунд обрезать в конце записи
+	VideoID    *uint   // Видео с записью последнего эфира
+	StartedAt  *time.Time
+	EndedAt    *time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+}
+
+func (Stream) TableName() string {
+	return "live_streams"
+}
+
+// generateStreamKey создаёт ключ трансляции вида live_<32 hex>.
+func generateStreamKey() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "live_" + hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,172 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/toxanetoxa/gohls/pkg/env"
+)
+
+// FFmpeg - обёртка над бинарниками ffmpeg и ffprobe.
+type FFmpeg struct {
+	Bin      string
+	ProbeBin string
+}
+
+// NewFFmpeg создаёт обёртку, пути к бинарникам берутся из FFMPEG_PATH и FFPROBE_PATH.
+func NewFFmpeg() *FFmpeg {
+	return &FFmpeg{
+		Bin:      env.String("FFMPEG_PATH", "ffmpeg"),
+		ProbeBin: env.String("FFPROBE_PATH", "ffprobe"),
+	}
+}
+
+// Run запускает ffmpeg с указанными аргументами.
+// В случае ошибки возвращает хвост stderr, чтобы было понятно, что пошло не так.
+func (f *FFmpeg) Run(ctx context.Context, args ...string) error {
+	args = append([]string{"-hide_banner", "-loglevel", "error", "-y"}, args...)
+	cmd := exec.CommandContext(ctx, f.Bin, args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, tail(stderr.String(), 512))
+	}
+	return nil
+}
+
+// Stream - описание потока из вывода ffprobe.
+type Stream struct {
+	Index       int               `json:"index"`
+	CodecType   string            `json:"codec_type"`
+	CodecName   string            `json:"codec_name"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	Channels    int               `json:"channels"`
+	BitRate     string            `json:"bit_rate"`
+	Tags        map[string]string `json:"tags"`
+	Disposition map[string]int    `json:"disposition"`
+}
+
+// Language возвращает язык потока из тегов (или "und").
+func (s *Stream) Language() string {
+	if lang := s.Tags["language"]; lang != "" {
+		return lang
+	}
+	return "und"
+}
+
+// Коды ISO 639-2, которые ffprobe отдаёт в тегах, и их двухбуквенные аналоги для HLS
+var shortLanguages = map[string]string{
+	"eng": "en",
+	"rus": "ru",
+	"ukr": "uk",
+	"deu": "de",
+	"ger": "de",
+	"fra": "fr",
+	"fre": "fr",
+	"spa": "es",
+	"ita": "it",
+	"por": "pt",
+	"jpn": "ja",
+	"kor": "ko",
+	"zho": "zh",
+	"chi": "zh",
+}
+
+// ShortLanguage переводит трёхбуквенный код языка в двухбуквенный, если он известен.
+func ShortLanguage(lang string) string {
+	if short, ok := shortLanguages[lang]; ok {
+		return short
+	}
+	return lang
+}
+
+// ProbeResult - результат ffprobe для файла.
+type ProbeResult struct {
+	Streams []Stream `json:"streams"`
+	Format  struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// Duration возвращает длительность файла в секундах.
+func (p *ProbeResult) Duration() float64 {
+	d, _ := strconv.ParseFloat(p.Format.Duration, 64)
+	return d
+}
+
+// VideoStream возвращает первый видеопоток или nil.
+func (p *ProbeResult) VideoStream() *Stream {
+	for i := range p.Streams {
+		if p.Streams[i].CodecType == "video" {
+			return &p.Streams[i]
+		}
+	}
+	return nil
+}
+
+// AudioStreams возвращает все аудиопотоки.
+func (p *ProbeResult) AudioStreams() []Stream {
+	var result []Stream
+	for _, s := range p.Streams {
+		if s.CodecType == "audio" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// Probe читает метаданные файла с помощью ffprobe.
+func (f *FFmpeg) Probe(ctx context.Context, path string) (*ProbeResult, error) {
+	cmd := exec.CommandContext(ctx, f.ProbeBin,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path,
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffprobe: %w: %s", err, tail(stderr.String(), 512))
+	}
+
+	var result ProbeResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("ffprobe: failed to parse output: %w", err)
+	}
+	return &result, nil
+}
+
+// ExtractFrame сохраняет в dst (JPEG) кадр на отметке at секунд.
+func (f *FFmpeg) ExtractFrame(ctx context.Context, src string, at float64, dst string) error {
+	return f.Run(ctx,
+		"-ss", formatSeconds(at),
+		"-i", src,
+		"-frames:v", "1",
+		"-q:v", "2",
+		dst,
+	)
+}
+
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', 3, 64)
+}
+
+func tail(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) > n {
+		return s[len(s)-n:]
+	}
+	return s
+}
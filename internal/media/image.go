@@ -0,0 +1,105 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // Пользовательские обложки могут быть в PNG
+	"io"
+)
+
+// DecodeImage декодирует JPEG или PNG.
+func DecodeImage(r io.Reader) (image.Image, error) {
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// DecodeImageLimited декодирует JPEG или PNG, предварительно проверив размеры по заголовку:
+// картинка больше maxPixels отклоняется, не занимая память под полное декодирование.
+func DecodeImageLimited(r io.ReadSeeker, maxPixels int) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxPixels/cfg.Height {
+		return nil, fmt.Errorf("image is %dx%d, at most %d pixels are allowed", cfg.Width, cfg.Height, maxPixels)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return DecodeImage(r)
+}
+
+// EncodeJPEG сохраняет изображение в JPEG.
+func EncodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+}
+
+// ResizeToWidth масштабирует изображение до указанной ширины с сохранением пропорций.
+// Используется билинейная интерполяция, при увеличении возвращается исходное изображение.
+func ResizeToWidth(src image.Image, width int) image.Image {
+	b := src.Bounds()
+	if width <= 0 || width >= b.Dx() {
+		return src
+	}
+
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	scaleX := float64(b.Dx()) / float64(width)
+	scaleY := float64(b.Dy()) / float64(height)
+
+	for y := 0; y < height; y++ {
+		sy := (float64(y)+0.5)*scaleY - 0.5
+		y0 := clamp(int(sy), 0, b.Dy()-1)
+		y1 := clamp(y0+1, 0, b.Dy()-1)
+		fy := sy - float64(y0)
+		if fy < 0 {
+			fy = 0
+		}
+
+		for x := 0; x < width; x++ {
+			sx := (float64(x)+0.5)*scaleX - 0.5
+			x0 := clamp(int(sx), 0, b.Dx()-1)
+			x1 := clamp(x0+1, 0, b.Dx()-1)
+			fx := sx - float64(x0)
+			if fx < 0 {
+				fx = 0
+			}
+
+			c00 := color.RGBAModel.Convert(src.At(b.Min.X+x0, b.Min.Y+y0)).(color.RGBA)
+			c10 := color.RGBAModel.Convert(src.At(b.Min.X+x1, b.Min.Y+y0)).(color.RGBA)
+			c01 := color.RGBAModel.Convert(src.At(b.Min.X+x0, b.Min.Y+y1)).(color.RGBA)
+			c11 := color.RGBAModel.Convert(src.At(b.Min.X+x1, b.Min.Y+y1)).(color.RGBA)
+
+			dst.SetRGBA(x, y, color.RGBA{
+				R: lerp2(c00.R, c10.R, c01.R, c11.R, fx, fy),
+				G: lerp2(c00.G, c10.G, c01.G, c11.G, fx, fy),
+				B: lerp2(c00.B, c10.B, c01.B, c11.B, fx, fy),
+				A: lerp2(c00.A, c10.A, c01.A, c11.A, fx, fy),
+			})
+		}
+	}
+
+	return dst
+}
+
+func lerp2(c00, c10, c01, c11 uint8, fx, fy float64) uint8 {
+	top := float64(c00)*(1-fx) + float64(c10)*fx
+	bottom := float64(c01)*(1-fx) + float64(c11)*fx
+	return uint8(top*(1-fy) + bottom*fy + 0.5)
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
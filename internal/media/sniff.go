@@ -0,0 +1,122 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/toxanetoxa/gohls/internal/mp4"
+)
+
+// MIME-типы поддерживаемых контейнеров
+const (
+	MimeMP4       = "video/mp4"
+	MimeQuickTime = "video/quicktime"
+	MimeWebM      = "video/webm"
+	MimeMatroska  = "video/x-matroska"
+	MimeMPEGTS    = "video/mp2t"
+)
+
+// ErrUnknownContainer - файл не похож ни на один поддерживаемый видеоконтейнер.
+var ErrUnknownContainer = errors.New("file is not a supported video container")
+
+// Размер пакета MPEG-TS и число пакетов, по которым проверяется синхробайт
+const (
+	tsPacketSize   = 188
+	tsCheckPackets = 5
+)
+
+// ebmlMagic - заголовок EBML, с которого начинаются WebM и Matroska.
+var ebmlMagic = []byte{0x1A, 0x45, 0xDF, 0xA3}
+
+// SniffContainer определяет контейнер по сигнатуре и проверяет его структуру.
+// Расширение и Content-Type от клиента не учитываются.
+func SniffContainer(r io.ReaderAt, size int64) (string, error) {
+	head := make([]byte, 1024)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	head = head[:n]
+
+	switch {
+	case len(head) >= 12 && isBMFFBox(head):
+		return sniffBMFF(r, size, head)
+	case bytes.HasPrefix(head, ebmlMagic):
+		return sniffEBML(head)
+	case isMPEGTS(r, size, 0):
+		return MimeMPEGTS, nil
+	case isMPEGTS(r, size, 4):
+		// M2TS (Blu-ray, AVCHD): перед каждым пакетом 4 байта таймкода
+		return MimeMPEGTS, nil
+	}
+	return "", ErrUnknownContainer
+}
+
+// isBMFFBox проверяет, что файл начинается с бокса, с которого начинаются MP4 и MOV.
+func isBMFFBox(head []byte) bool {
+	switch string(head[4:8]) {
+	case "ftyp", "moov", "mdat", "wide", "free", "skip":
+		return true
+	}
+	return false
+}
+
+// sniffBMFF различает MP4 и QuickTime по основному бренду и требует наличия moov.
+func sniffBMFF(r io.ReaderAt, size int64, head []byte) (string, error) {
+	headers, err := mp4.ScanTopLevel(r, size)
+	if err != nil {
+		return "", ErrUnknownContainer
+	}
+	hasMoov := false
+	for _, h := range headers {
+		if h.Type == "moov" {
+			hasMoov = true
+		}
+	}
+	if !hasMoov {
+		return "", ErrUnknownContainer
+	}
+
+	// В старых MOV бокса ftyp нет вовсе
+	if string(head[4:8]) != "ftyp" || string(head[8:12]) == "qt  " {
+		return MimeQuickTime, nil
+	}
+	return MimeMP4, nil
+}
+
+// sniffEBML различает WebM и Matroska по DocType из заголовка EBML.
+func sniffEBML(head []byte) (string, error) {
+	// DocType - элемент 0x4282, за ним длина в формате VINT и строка
+	i := bytes.Index(head, []byte{0x42, 0x82})
+	if i < 0 || i+3 > len(head) {
+		return "", ErrUnknownContainer
+	}
+	length := int(head[i+2] &^ 0x80)
+	if head[i+2]&0x80 == 0 || i+3+length > len(head) {
+		return "", ErrUnknownContainer
+	}
+
+	switch string(head[i+3 : i+3+length]) {
+	case "webm":
+		return MimeWebM, nil
+	case "matroska":
+		return MimeMatroska, nil
+	}
+	return "", ErrUnknownContainer
+}
+
+// isMPEGTS проверяет синхробайт 0x47 в начале нескольких пакетов подряд.
+func isMPEGTS(r io.ReaderAt, size int64, prefix int64) bool {
+	stride := tsPacketSize + prefix
+	if size < stride*tsCheckPackets {
+		return false
+	}
+	b := make([]byte, 1)
+	for i := int64(0); i < tsCheckPackets; i++ {
+		if _, err := r.ReadAt(b, i*stride+prefix); err != nil || b[0] != 0x47 {
+			return false
+		}
+	}
+	return true
+}
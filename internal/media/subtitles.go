@@ -0,0 +1,138 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Cue - одна реплика субтитров.
+type Cue struct {
+	Start    float64 // Секунды
+	End      float64
+	Settings string // Настройки позиционирования WebVTT (line, align и т. п.)
+	Text     string
+}
+
+// ParseSubtitles разбирает субтитры в формате SRT или WebVTT.
+func ParseSubtitles(data []byte) ([]Cue, error) {
+	text := strings.TrimPrefix(string(data), "\uFEFF")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	isVTT := strings.HasPrefix(text, "WEBVTT")
+	blocks := strings.Split(strings.TrimSpace(text), "\n\n")
+	if isVTT {
+		// Первый блок - заголовок WEBVTT
+		blocks = blocks[1:]
+	}
+
+	var cues []Cue
+	for _, block := range blocks {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		if len(lines) == 0 || lines[0] == "" {
+			continue
+		}
+
+		// Блоки NOTE, STYLE и REGION в WebVTT не содержат реплик
+		if isVTT && (strings.HasPrefix(lines[0], "NOTE") || lines[0] == "STYLE" || lines[0] == "REGION") {
+			continue
+		}
+
+		// Строка с таймингом может идти после идентификатора (номер в SRT, id в WebVTT)
+		timingIdx := 0
+		if !strings.Contains(lines[0], "-->") {
+			timingIdx = 1
+		}
+		if timingIdx >= len(lines) || !strings.Contains(lines[timingIdx], "-->") {
+			return nil, fmt.Errorf("invalid cue: missing timing line in %q", lines[0])
+		}
+
+		cue, err := parseTiming(lines[timingIdx])
+		if err != nil {
+			return nil, err
+		}
+		cue.Text = strings.Join(lines[timingIdx+1:], "\n")
+		cues = append(cues, cue)
+	}
+
+	if len(cues) == 0 {
+		return nil, errors.New("no subtitle cues found")
+	}
+	return cues, nil
+}
+
+func parseTiming(line string) (Cue, error) {
+	parts := strings.SplitN(line, "-->", 2)
+	start, err := parseTimestamp(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return Cue{}, err
+	}
+
+	rest := strings.Fields(parts[1])
+	if len(rest) == 0 {
+		return Cue{}, fmt.Errorf("invalid timing line %q", line)
+	}
+	end, err := parseTimestamp(rest[0])
+	if err != nil {
+		return Cue{}, err
+	}
+	if end < start {
+		return Cue{}, fmt.Errorf("cue ends before it starts: %q", line)
+	}
+
+	return Cue{Start: start, End: end, Settings: strings.Join(rest[1:], " ")}, nil
+}
+
+// timestampPattern - [ЧЧ:]ММ:СС.ммм, в SRT вместо точки запятая.
+var timestampPattern = regexp.MustCompile(`^(?:(\d+):)?([0-5]\d):([0-5]\d)[.,](\d{1,3})$`)
+
+// parseTimestamp разбирает ЧЧ:ММ:СС.ммм, ММ:СС.ммм и SRT-вариант с запятой.
+// Формат проверяется строго: NaN, Inf и экспоненциальная запись отклоняются.
+func parseTimestamp(s string) (float64, error) {
+	m := timestampPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+
+	var hours int64
+	if m[1] != "" {
+		var err error
+		if hours, err = strconv.ParseInt(m[1], 10, 32); err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+	}
+	minutes, _ := strconv.Atoi(m[2])
+	seconds, _ := strconv.Atoi(m[3])
+	millis, _ := strconv.Atoi((m[4] + "00")[:3])
+	return float64(hours*3600+int64(minutes*60+seconds)) + float64(millis)/1000, nil
+}
+
+// FormatVTTTimestamp форматирует секунды как ЧЧ:ММ:СС.ммм.
+func FormatVTTTimestamp(s float64) string {
+	ms := int64(math.Round(s * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// WriteVTT собирает WebVTT-документ из реплик. header добавляется сразу после строки WEBVTT.
+func WriteVTT(cues []Cue, header string) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	if header != "" {
+		b.WriteString(header + "\n")
+	}
+
+	for _, cue := range cues {
+		b.WriteString("\n")
+		b.WriteString(FormatVTTTimestamp(cue.Start) + " --> " + FormatVTTTimestamp(cue.End))
+		if cue.Settings != "" {
+			b.WriteString(" " + cue.Settings)
+		}
+		b.WriteString("\n" + cue.Text + "\n")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,210 @@
+// Package mp4 работает с контейнером ISO BMFF (MP4/MOV) без ffmpeg: разбор боксов и таблиц сэмплов.
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var (
+	ErrNotMP4    = errors.New("file is not an ISO BMFF (MP4/MOV) container")
+	ErrTruncated = errors.New("mp4 box is truncated")
+)
+
+// Контейнеры, которые разбираются вглубь. Остальные боксы хранятся как есть.
+var containerTypes = map[string]bool{
+	"moov": true,
+	"trak": true,
+	"mdia": true,
+	"minf": true,
+	"stbl": true,
+	"edts": true,
+	"dinf": true,
+	"mvex": true,
+}
+
+// Box - бокс ISO BMFF. У контейнера заполнены Children, у остальных - Payload.
+type Box struct {
+	Type     string
+	Payload  []byte
+	Children []*Box
+}
+
+// Size возвращает полный размер бокса вместе с заголовком.
+func (b *Box) Size() int64 {
+	body := int64(len(b.Payload))
+	for _, child := range b.Children {
+		body += child.Size()
+	}
+	if body+8 > math.MaxUint32 {
+		return body + 16
+	}
+	return body + 8
+}
+
+// Child возвращает первый дочерний бокс указанного типа.
+func (b *Box) Child(typ string) *Box {
+	for _, child := range b.Children {
+		if child.Type == typ {
+			return child
+		}
+	}
+	return nil
+}
+
+// Find возвращает все боксы по пути типов, например Find("trak", "mdia", "minf", "stbl").
+func (b *Box) Find(path ...string) []*Box {
+	if len(path) == 0 {
+		return []*Box{b}
+	}
+
+	var result []*Box
+	for _, child := range b.Children {
+		if child.Type == path[0] {
+			result = append(result, child.Find(path[1:]...)...)
+		}
+	}
+	return result
+}
+
+// WriteTo записывает бокс с пересчитанными размерами.
+func (b *Box) WriteTo(w io.Writer) (int64, error) {
+	size := b.Size()
+	var header []byte
+	if size > math.MaxUint32 {
+		header = make([]byte, 16)
+		binary.BigEndian.PutUint32(header, 1)
+		copy(header[4:8], b.Type)
+		binary.BigEndian.PutUint64(header[8:], uint64(size))
+	} else {
+		header = make([]byte, 8)
+		binary.BigEndian.PutUint32(header, uint32(size))
+		copy(header[4:8], b.Type)
+	}
+
+	n, err := w.Write(header)
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	if b.Children == nil {
+		n, err = w.Write(b.Payload)
+		return written + int64(n), err
+	}
+	for _, child := range b.Children {
+		m, err := child.WriteTo(w)
+		written += m
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Header - заголовок бокса верхнего уровня в файле.
+type Header struct {
+	Type       string
+	Offset     int64 // Смещение начала бокса в файле
+	Size       int64 // Полный размер вместе с заголовком
+	HeaderSize int64
+}
+
+// readHeader читает заголовок бокса по смещению offset. limit - конец родителя.
+func readHeader(r io.ReaderAt, offset, limit int64) (Header, error) {
+	if limit-offset < 8 {
+		return Header{}, ErrTruncated
+	}
+
+	buf := make([]byte, 16)
+	if _, err := r.ReadAt(buf[:8], offset); err != nil {
+		return Header{}, err
+	}
+
+	h := Header{
+		Type:       string(buf[4:8]),
+		Offset:     offset,
+		Size:       int64(binary.BigEndian.Uint32(buf)),
+		HeaderSize: 8,
+	}
+	switch h.Size {
+	case 0:
+		// Бокс до конца файла
+		h.Size = limit - offset
+	case 1:
+		if limit-offset < 16 {
+			return Header{}, ErrTruncated
+		}
+		if _, err := r.ReadAt(buf[8:16], offset+8); err != nil {
+			return Header{}, err
+		}
+		h.Size = int64(binary.BigEndian.Uint64(buf[8:16]))
+		h.HeaderSize = 16
+	}
+
+	if h.Size < h.HeaderSize || offset+h.Size > limit {
+		return Header{}, fmt.Errorf("%w: %q at %d", ErrTruncated, h.Type, offset)
+	}
+	return h, nil
+}
+
+// ScanTopLevel возвращает боксы верхнего уровня файла.
+func ScanTopLevel(r io.ReaderAt, size int64) ([]Header, error) {
+	var headers []Header
+	for offset := int64(0); offset < size; {
+		h, err := readHeader(r, offset, size)
+		if err != nil {
+			if len(headers) == 0 {
+				return nil, ErrNotMP4
+			}
+			return nil, err
+		}
+		if !isPrintable(h.Type) {
+			return nil, ErrNotMP4
+		}
+		headers = append(headers, h)
+		offset += h.Size
+	}
+	return headers, nil
+}
+
+// ReadBox читает бокс целиком в память, разбирая контейнеры.
+func ReadBox(r io.ReaderAt, h Header) (*Box, error) {
+	b := &Box{Type: h.Type}
+	start, end := h.Offset+h.HeaderSize, h.Offset+h.Size
+
+	if !containerTypes[h.Type] {
+		b.Payload = make([]byte, end-start)
+		if _, err := r.ReadAt(b.Payload, start); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	b.Children = []*Box{}
+	for offset := start; offset < end; {
+		child, err := readHeader(r, offset, end)
+		if err != nil {
+			return nil, err
+		}
+		childBox, err := ReadBox(r, child)
+		if err != nil {
+			return nil, err
+		}
+		b.Children = append(b.Children, childBox)
+		offset += child.Size
+	}
+	return b, nil
+}
+
+func isPrintable(typ string) bool {
+	for i := 0; i < len(typ); i++ {
+		if typ[i] < 0x20 || typ[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
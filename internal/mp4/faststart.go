@@ -0,0 +1,207 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// chunkOffsets - таблица смещений чанков (stco или co64) одной дорожки.
+type chunkOffsets struct {
+	box     *Box
+	offsets []uint64
+}
+
+func readChunkOffsets(b *Box) (*chunkOffsets, error) {
+	entrySize := 4
+	if b.Type == "co64" {
+		entrySize = 8
+	}
+	if len(b.Payload) < 8 {
+		return nil, fmt.Errorf("%w: %s", ErrTruncated, b.Type)
+	}
+
+	count := int(binary.BigEndian.Uint32(b.Payload[4:8]))
+	if len(b.Payload) < 8+count*entrySize {
+		return nil, fmt.Errorf("%w: %s", ErrTruncated, b.Type)
+	}
+
+	t := &chunkOffsets{box: b, offsets: make([]uint64, count)}
+	for i := range t.offsets {
+		p := b.Payload[8+i*entrySize:]
+		if entrySize == 8 {
+			t.offsets[i] = binary.BigEndian.Uint64(p)
+		} else {
+			t.offsets[i] = uint64(binary.BigEndian.Uint32(p))
+		}
+	}
+	return t, nil
+}
+
+// encode записывает в бокс смещения, пересчитанные функцией shift.
+func (t *chunkOffsets) encode(shift func(uint64) uint64) {
+	entrySize := 4
+	if t.box.Type == "co64" {
+		entrySize = 8
+	}
+
+	payload := make([]byte, 8+len(t.offsets)*entrySize)
+	copy(payload[:4], t.box.Payload[:4]) // Версия и флаги
+	binary.BigEndian.PutUint32(payload[4:8], uint32(len(t.offsets)))
+	for i, off := range t.offsets {
+		p := payload[8+i*entrySize:]
+		if entrySize == 8 {
+			binary.BigEndian.PutUint64(p, shift(off))
+		} else {
+			binary.BigEndian.PutUint32(p, uint32(shift(off)))
+		}
+	}
+	t.box.Payload = payload
+}
+
+// Faststart переписывает файл так, чтобы moov шёл перед mdat, и исправляет смещения чанков.
+// Возвращает false, если файл уже пригоден для прогрессивного воспроизведения.
+func Faststart(filePath string) (bool, error) {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	tmp := filePath + ".faststart"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return false, err
+	}
+
+	changed, err := Rewrite(in, info.Size(), out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || !changed {
+		os.Remove(tmp)
+		return false, err
+	}
+
+	in.Close()
+	return true, os.Rename(tmp, filePath)
+}
+
+// Rewrite записывает в w копию файла с moov перед первым mdat.
+// Если moov уже стоит раньше mdat, ничего не пишет и возвращает false.
+func Rewrite(r io.ReaderAt, size int64, w io.Writer) (bool, error) {
+	headers, err := ScanTopLevel(r, size)
+	if err != nil {
+		return false, err
+	}
+
+	moovIndex, mdatIndex := -1, -1
+	for i, h := range headers {
+		switch h.Type {
+		case "moov":
+			if moovIndex < 0 {
+				moovIndex = i
+			}
+		case "mdat":
+			if mdatIndex < 0 {
+				mdatIndex = i
+			}
+		case "moof":
+			// Фрагментированный файл и так воспроизводится по мере загрузки
+			return false, nil
+		}
+	}
+	if moovIndex < 0 || mdatIndex < 0 {
+		return false, ErrNotMP4
+	}
+	if moovIndex < mdatIndex {
+		return false, nil
+	}
+
+	oldMoov := headers[moovIndex]
+	moov, err := ReadBox(r, oldMoov)
+	if err != nil {
+		return false, err
+	}
+
+	var tables []*chunkOffsets
+	for _, stbl := range moov.Find("trak", "mdia", "minf", "stbl") {
+		for _, child := range stbl.Children {
+			if child.Type != "stco" && child.Type != "co64" {
+				continue
+			}
+			t, err := readChunkOffsets(child)
+			if err != nil {
+				return false, err
+			}
+			tables = append(tables, t)
+		}
+	}
+
+	// Данные между первым mdat и старым moov сдвигаются на размер нового moov,
+	// данные после старого moov - на разницу размеров нового и старого moov.
+	insertAt := uint64(headers[mdatIndex].Offset)
+	moovStart, moovEnd := uint64(oldMoov.Offset), uint64(oldMoov.Offset+oldMoov.Size)
+	var shift func(uint64) uint64
+	for {
+		newSize := uint64(moov.Size())
+		shift = func(off uint64) uint64 {
+			switch {
+			case off >= insertAt && off < moovStart:
+				return off + newSize
+			case off >= moovEnd:
+				return off + newSize - uint64(oldMoov.Size)
+			default:
+				return off
+			}
+		}
+
+		// Смещение перестало помещаться в 32 бита - переводим таблицу в co64 и пересчитываем размер moov
+		upgraded := false
+		for _, t := range tables {
+			if t.box.Type != "stco" {
+				continue
+			}
+			for _, off := range t.offsets {
+				if shift(off) > math.MaxUint32 {
+					payload := make([]byte, 8+len(t.offsets)*8)
+					copy(payload, t.box.Payload[:4])
+					t.box.Type = "co64"
+					t.box.Payload = payload
+					upgraded = true
+					break
+				}
+			}
+		}
+		if !upgraded {
+			break
+		}
+	}
+
+	for _, t := range tables {
+		t.encode(shift)
+	}
+
+	for i, h := range headers {
+		if i == moovIndex {
+			continue
+		}
+		if i == mdatIndex {
+			if _, err := moov.WriteTo(w); err != nil {
+				return false, err
+			}
+		}
+		if _, err := io.Copy(w, io.NewSectionReader(r, h.Offset, h.Size)); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
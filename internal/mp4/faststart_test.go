@@ -0,0 +1,232 @@
+package mp4
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestRewriteGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		build   func(t *testing.T) []byte
+		changed bool
+	}{
+		{
+			name:    "moov at end",
+			input:   "moov_at_end.mp4",
+			build:   func(t *testing.T) []byte { return buildMovie(t, movieSpec{}) },
+			changed: true,
+		},
+		{
+			name:    "moov at end with co64",
+			input:   "moov_at_end_co64.mp4",
+			build:   func(t *testing.T) []byte { return buildMovie(t, movieSpec{co64: true}) },
+			changed: true,
+		},
+		{
+			name:  "moov first",
+			input: "moov_first.mp4",
+			build: func(t *testing.T) []byte { return buildMovie(t, movieSpec{moovFirst: true}) },
+		},
+		{
+			name:  "fragmented",
+			input: "fragmented.mp4",
+			build: func(t *testing.T) []byte {
+				src := buildMovie(t, movieSpec{moovFirst: true})
+				var out bytes.Buffer
+				if _, err := WriteFragmented(bytes.NewReader(src), int64(len(src)), &out, 1); err != nil {
+					t.Fatal(err)
+				}
+				return out.Bytes()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := fixture(t, tt.input, func() []byte { return tt.build(t) })
+
+			var out bytes.Buffer
+			changed, err := Rewrite(bytes.NewReader(input), int64(len(input)), &out)
+			if err != nil {
+				t.Fatalf("Rewrite: %v", err)
+			}
+			if changed != tt.changed {
+				t.Fatalf("changed = %v, want %v", changed, tt.changed)
+			}
+			if !changed {
+				if out.Len() != 0 {
+					t.Fatalf("Rewrite wrote %d bytes for a file that needs no changes", out.Len())
+				}
+				return
+			}
+
+			checkGolden(t, tt.input+".golden", out.Bytes())
+
+			headers, err := ScanTopLevel(bytes.NewReader(out.Bytes()), int64(out.Len()))
+			if err != nil {
+				t.Fatalf("ScanTopLevel: %v", err)
+			}
+			if headers[1].Type != "moov" || headers[2].Type != "mdat" {
+				t.Fatalf("top-level boxes are %s, %s, %s; want ftyp, moov, mdat", headers[0].Type, headers[1].Type, headers[2].Type)
+			}
+
+			// Смещения пересчитаны: каждый сэмпл указывает на те же данные, что и в исходнике
+			want, got := readSampleData(t, input), readSampleData(t, out.Bytes())
+			for id, samples := range want {
+				for i := range samples {
+					if !bytes.Equal(samples[i], got[id][i]) {
+						t.Fatalf("track %d sample %d points to different data after rewrite", id, i)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRewriteNotMP4(t *testing.T) {
+	data := []byte("definitely not an mp4 file")
+	if _, err := Rewrite(bytes.NewReader(data), int64(len(data)), io.Discard); err != ErrNotMP4 {
+		t.Fatalf("err = %v, want ErrNotMP4", err)
+	}
+}
+
+// sparseFile - файл, который читается как нули, кроме заданных участков. Позволяет проверить
+// файлы больше 4 ГБ, не занимая ни память, ни диск.
+type sparseFile struct {
+	size  int64
+	parts map[int64][]byte // смещение -> данные
+}
+
+func (f *sparseFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	n := len(p)
+	if rest := f.size - off; int64(n) > rest {
+		n = int(rest)
+	}
+	clear(p[:n])
+	for start, data := range f.parts {
+		end := start + int64(len(data))
+		if end <= off || start >= off+int64(n) {
+			continue
+		}
+		from, to := max(start, off), min(end, off+int64(n))
+		copy(p[from-off:to-off], data[from-start:to-start])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// prefixWriter запоминает первые limit байт и считает остальные.
+type prefixWriter struct {
+	limit int
+	buf   []byte
+	total int64
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if rest := w.limit - len(w.buf); rest > 0 {
+		w.buf = append(w.buf, p[:min(rest, len(p))]...)
+	}
+	w.total += int64(len(p))
+	return len(p), nil
+}
+
+// Данные лежат у самой границы 4 ГБ: после вставки moov перед mdat смещения не помещаются в stco,
+// и таблица должна стать co64.
+func TestRewriteUpgradesToCo64(t *testing.T) {
+	if testing.Short() {
+		t.Skip("copies 4 GB of mdat")
+	}
+
+	ftyp := &Box{Type: "ftyp", Payload: []byte("isom\x00\x00\x02\x00isomiso2avc1mp41")}
+	samples := testMdat()
+
+	// mdat с 64-битным размером заканчивается ровно на 4 ГБ, сэмплы - в его конце
+	mdatStart := ftyp.Size()
+	mdatEnd := int64(1) << 32
+	base := mdatEnd - int64(len(samples))
+	moov := testMoov(movieSpec{}, uint64(base))
+
+	var head bytes.Buffer
+	if _, err := ftyp.WriteTo(&head); err != nil {
+		t.Fatal(err)
+	}
+	head.Write(u32(1))
+	head.WriteString("mdat")
+	head.Write(u64(uint64(mdatEnd - mdatStart)))
+
+	var tail bytes.Buffer
+	if _, err := moov.WriteTo(&tail); err != nil {
+		t.Fatal(err)
+	}
+
+	file := &sparseFile{
+		size: mdatEnd + int64(tail.Len()),
+		parts: map[int64][]byte{
+			0:       head.Bytes(),
+			base:    samples,
+			mdatEnd: tail.Bytes(),
+		},
+	}
+
+	out := &prefixWriter{limit: 4096}
+	changed, err := Rewrite(file, file.size, out)
+	if err != nil {
+		t.Fatalf("Rewrite: %v", err)
+	}
+	if !changed {
+		t.Fatal("Rewrite reported no changes for a file with moov at the end")
+	}
+
+	checkGolden(t, "co64_upgrade.golden", out.buf)
+
+	// moov вырос на 4 байта на каждый чанк, файл - ровно на разницу размеров moov
+	prefix := bytes.NewReader(out.buf)
+	h, err := readHeader(prefix, ftyp.Size(), int64(len(out.buf)))
+	if err != nil || h.Type != "moov" {
+		t.Fatalf("moov is not right after ftyp: %v %q", err, h.Type)
+	}
+	newMoov, err := ReadBox(prefix, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.total != file.size-moov.Size()+newMoov.Size() {
+		t.Fatalf("output size = %d, want %d", out.total, file.size-moov.Size()+newMoov.Size())
+	}
+
+	// Смещения сдвинуты на размер нового moov; таблица, которой стало мало 32 бит, переведена в co64,
+	// остальные остались stco
+	upgraded := 0
+	for _, stbl := range newMoov.Find("trak", "mdia", "minf", "stbl") {
+		box := stbl.Child("co64")
+		if box == nil {
+			box = stbl.Child("stco")
+		}
+		table, err := readChunkOffsets(box)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, off := range table.offsets {
+			if off < uint64(base)+uint64(newMoov.Size()) {
+				t.Fatalf("offset %d was not shifted by the new moov size", off)
+			}
+		}
+		if last := table.offsets[len(table.offsets)-1]; last > math.MaxUint32 {
+			if box.Type != "co64" {
+				t.Fatalf("offset %d is stored in stco", last)
+			}
+			upgraded++
+		}
+	}
+	if upgraded == 0 {
+		t.Fatal("no chunk offset table needed co64, the fixture does not exercise the upgrade")
+	}
+}
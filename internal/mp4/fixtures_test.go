@@ -0,0 +1,266 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// go test ./internal/mp4 -update пересобирает входные файлы и эталоны в testdata
+var update = flag.Bool("update", false, "rewrite testdata fixtures and golden files")
+
+// movieSpec описывает синтетический MP4: видеодорожка и аудиодорожка, сэмплы лежат
+// чанками по chunkSamples, чанки видео и звука чередуются в одном mdat.
+type movieSpec struct {
+	moovFirst bool
+	co64      bool
+}
+
+const (
+	videoSamples = 30 // По 100 мс, ключевой кадр каждые 10 сэмплов
+	audioSamples = 15 // По 200 мс
+	chunkSamples = 5  // Сэмплов в чанке
+	timescale    = 1000
+)
+
+func videoSampleSize(i int) int { return 100 + i*3 }
+
+func audioSampleSize(int) int { return 20 }
+
+// sampleData - содержимое сэмпла: по нему после переупаковки видно, что данные не перепутаны.
+func sampleData(track, i, size int) []byte {
+	return bytes.Repeat([]byte{byte(track*64 + i)}, size)
+}
+
+func fullBox(version byte, body ...[]byte) []byte {
+	payload := []byte{version, 0, 0, 0}
+	for _, b := range body {
+		payload = append(payload, b...)
+	}
+	return payload
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+func u64(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+
+func testTrak(id uint32, handler, codec string, sizes []int, delta uint32, sync []uint32, offsets []uint64, co64 bool) *Box {
+	duration := uint32(len(sizes)) * delta
+
+	tkhd := fullBox(0, u32(0), u32(0), u32(id), u32(0), u32(duration), make([]byte, 8),
+		u16(0), u16(0), u16(0x0100), u16(0), make([]byte, 36), u32(0), u32(0))
+	mdhd := fullBox(0, u32(0), u32(0), u32(timescale), u32(duration), u16(0x55c4), u16(0))
+	hdlr := fullBox(0, u32(0), []byte(handler), make([]byte, 12), []byte{0})
+
+	entry := append(u32(16), []byte(codec)...)
+	entry = append(entry, make([]byte, 6)...)
+	entry = append(entry, u16(1)...)
+	stsd := fullBox(0, u32(1), entry)
+
+	stts := fullBox(0, u32(1), u32(uint32(len(sizes))), u32(delta))
+	stsc := fullBox(0, u32(1), u32(1), u32(chunkSamples), u32(1))
+	stsz := fullBox(0, u32(0), u32(uint32(len(sizes))))
+	for _, s := range sizes {
+		stsz = append(stsz, u32(uint32(s))...)
+	}
+
+	chunkType := "stco"
+	chunkTable := fullBox(0, u32(uint32(len(offsets))))
+	for _, off := range offsets {
+		if co64 {
+			chunkType = "co64"
+			chunkTable = append(chunkTable, u64(off)...)
+		} else {
+			chunkTable = append(chunkTable, u32(uint32(off))...)
+		}
+	}
+
+	stbl := &Box{Type: "stbl", Children: []*Box{
+		{Type: "stsd", Payload: stsd},
+		{Type: "stts", Payload: stts},
+	}}
+	if sync != nil {
+		// Видео с B-кадрами: постоянный сдвиг отображения на один кадр
+		stbl.Children = append(stbl.Children, &Box{Type: "ctts", Payload: fullBox(0, u32(1), u32(uint32(len(sizes))), u32(delta))})
+		stss := fullBox(0, u32(uint32(len(sync))))
+		for _, n := range sync {
+			stss = append(stss, u32(n)...)
+		}
+		stbl.Children = append(stbl.Children, &Box{Type: "stss", Payload: stss})
+	}
+	stbl.Children = append(stbl.Children,
+		&Box{Type: "stsc", Payload: stsc},
+		&Box{Type: "stsz", Payload: stsz},
+		&Box{Type: chunkType, Payload: chunkTable},
+	)
+
+	mediaHeader := &Box{Type: "smhd", Payload: fullBox(0, make([]byte, 4))}
+	if handler == "vide" {
+		mediaHeader = &Box{Type: "vmhd", Payload: fullBox(0, make([]byte, 8))}
+	}
+	dref := fullBox(0, u32(1), u32(12), []byte("url "), u32(1))
+
+	return &Box{Type: "trak", Children: []*Box{
+		{Type: "tkhd", Payload: tkhd},
+		{Type: "mdia", Children: []*Box{
+			{Type: "mdhd", Payload: mdhd},
+			{Type: "hdlr", Payload: hdlr},
+			{Type: "minf", Children: []*Box{
+				mediaHeader,
+				{Type: "dinf", Children: []*Box{{Type: "dref", Payload: dref}}},
+				stbl,
+			}},
+		}},
+	}}
+}
+
+// testMoov собирает moov, chunkBase - смещение данных mdat в файле.
+func testMoov(spec movieSpec, chunkBase uint64) *Box {
+	videoSizes := make([]int, videoSamples)
+	for i := range videoSizes {
+		videoSizes[i] = videoSampleSize(i)
+	}
+	audioSizes := make([]int, audioSamples)
+	for i := range audioSizes {
+		audioSizes[i] = audioSampleSize(i)
+	}
+
+	var videoOffsets, audioOffsets []uint64
+	offset := chunkBase
+	for _, c := range chunkOrder() {
+		sizes, offsets := videoSizes, &videoOffsets
+		if c.track == 2 {
+			sizes, offsets = audioSizes, &audioOffsets
+		}
+		*offsets = append(*offsets, offset)
+		for i := c.index * chunkSamples; i < (c.index+1)*chunkSamples; i++ {
+			offset += uint64(sizes[i])
+		}
+	}
+
+	mvhd := fullBox(0, u32(0), u32(0), u32(timescale), u32(videoSamples*100), u32(0x00010000), u16(0x0100),
+		make([]byte, 10), make([]byte, 36), make([]byte, 24), u32(3))
+
+	return &Box{Type: "moov", Children: []*Box{
+		{Type: "mvhd", Payload: mvhd},
+		testTrak(1, "vide", "avc1", videoSizes, 100, []uint32{1, 11, 21}, videoOffsets, spec.co64),
+		testTrak(2, "soun", "mp4a", audioSizes, 200, nil, audioOffsets, spec.co64),
+	}}
+}
+
+type testChunk struct{ track, index int }
+
+// chunkOrder - порядок чанков в mdat: видео и звук по очереди, пока звук не кончится.
+func chunkOrder() []testChunk {
+	var order []testChunk
+	for i := 0; i < videoSamples/chunkSamples; i++ {
+		order = append(order, testChunk{1, i})
+		if i < audioSamples/chunkSamples {
+			order = append(order, testChunk{2, i})
+		}
+	}
+	return order
+}
+
+func testMdat() []byte {
+	var data []byte
+	for _, c := range chunkOrder() {
+		for i := c.index * chunkSamples; i < (c.index+1)*chunkSamples; i++ {
+			if c.track == 1 {
+				data = append(data, sampleData(1, i, videoSampleSize(i))...)
+			} else {
+				data = append(data, sampleData(2, i, audioSampleSize(i))...)
+			}
+		}
+	}
+	return data
+}
+
+// buildMovie собирает синтетический MP4 с moov в начале или в конце файла.
+func buildMovie(t *testing.T, spec movieSpec) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	ftyp := &Box{Type: "ftyp", Payload: []byte("isom\x00\x00\x02\x00isomiso2avc1mp41")}
+	mdat := &Box{Type: "mdat", Payload: testMdat()}
+
+	// Размер moov не зависит от значений смещений, поэтому считаем его по черновику
+	base := uint64(ftyp.Size() + 8)
+	if spec.moovFirst {
+		base += uint64(testMoov(spec, 0).Size())
+	}
+	moov := testMoov(spec, base)
+
+	boxes := []*Box{ftyp, moov, mdat}
+	if !spec.moovFirst {
+		boxes = []*Box{ftyp, mdat, moov}
+	}
+	for _, b := range boxes {
+		if _, err := b.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// fixture возвращает входной файл из testdata, при -update предварительно пересобирая его
+// (build == nil - файл собирает другой тест).
+func fixture(t *testing.T, name string, build func() []byte) []byte {
+	t.Helper()
+	p := filepath.Join("testdata", name)
+	if *update && build != nil {
+		if err := os.WriteFile(p, build(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("read fixture: %v (run with -update to create it)", err)
+	}
+	return data
+}
+
+// checkGolden сравнивает результат с эталоном из testdata, при -update перезаписывает эталон.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	p := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(p, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("read golden file: %v (run with -update to create it)", err)
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	n := min(len(got), len(want))
+	for i := 0; i < n; i++ {
+		if got[i] != want[i] {
+			t.Fatalf("%s: output differs from golden file at byte %d (got %d bytes, want %d)", name, i, len(got), len(want))
+		}
+	}
+	t.Fatalf("%s: output is %d bytes, golden file is %d bytes", name, len(got), len(want))
+}
+
+// readSampleData читает содержимое всех сэмплов дорожек файла.
+func readSampleData(t *testing.T, data []byte) map[uint32][][]byte {
+	t.Helper()
+	_, tracks, err := ReadTracks(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadTracks: %v", err)
+	}
+	result := make(map[uint32][][]byte)
+	for _, tr := range tracks {
+		for _, s := range tr.Samples {
+			result[tr.ID] = append(result[tr.ID], data[s.Offset:s.Offset+int64(s.Size)])
+		}
+	}
+	return result
+}
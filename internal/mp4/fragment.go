@@ -0,0 +1,287 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Кодеки, которые HLS-плееры воспроизводят из fMP4 без перекодирования.
+var hlsCodecs = map[string]bool{
+	"avc1": true,
+	"avc3": true,
+	"hvc1": true,
+	"hev1": true,
+	"mp4a": true,
+	"ac-3": true,
+	"ec-3": true,
+}
+
+// Флаги сэмплов в trun: ключевой кадр и кадр, зависящий от других.
+const (
+	syncSampleFlags    = 0x02000000
+	nonSyncSampleFlags = 0x01010000
+)
+
+// Fragment - фрагмент (moof+mdat) в выходном файле.
+type Fragment struct {
+	Offset   int64
+	Size     int64
+	Duration float64 // Секунды
+}
+
+// Fragmented описывает раскладку фрагментированного файла для плейлиста с EXT-X-BYTERANGE.
+type Fragmented struct {
+	InitSize  int64 // Размер ftyp+moov в начале файла
+	Fragments []Fragment
+}
+
+// countingWriter считает записанные байты.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// WriteFragmented переупаковывает обычный MP4 во фрагментированный (init + moof/mdat) без перекодирования.
+// Фрагменты режутся по ключевым кадрам видео и длятся не меньше target секунд.
+// Сэмплы копируются как есть, поэтому файл с неподдерживаемым HLS кодеком отклоняется с ErrUnsupported.
+func WriteFragmented(r io.ReaderAt, size int64, w io.Writer, target float64) (*Fragmented, error) {
+	moov, all, err := ReadTracks(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []*Track
+	var ref *Track
+	for _, t := range all {
+		if t.Handler != "vide" && t.Handler != "soun" {
+			continue
+		}
+		if !hlsCodecs[t.Codec] {
+			return nil, fmt.Errorf("%w: codec %q", ErrUnsupported, t.Codec)
+		}
+		if len(t.Samples) == 0 {
+			continue
+		}
+		tracks = append(tracks, t)
+		if ref == nil && t.Handler == "vide" {
+			ref = t
+		}
+	}
+	if ref == nil {
+		return nil, fmt.Errorf("%w: no video track", ErrUnsupported)
+	}
+
+	cuts := cutPoints(ref, target)
+
+	cw := &countingWriter{w: w}
+	if _, err := ftypBox().WriteTo(cw); err != nil {
+		return nil, err
+	}
+	if _, err := initMoov(moov, tracks).WriteTo(cw); err != nil {
+		return nil, err
+	}
+	result := &Fragmented{InitSize: cw.n}
+
+	// Для каждой дорожки - индекс первого ещё не записанного сэмпла
+	next := make([]int, len(tracks))
+	for i := range cuts {
+		end := math.Inf(1)
+		if i+1 < len(cuts) {
+			end = cuts[i+1]
+		}
+
+		ranges := make([][2]int, len(tracks))
+		for ti, t := range tracks {
+			from := next[ti]
+			to := from
+			for to < len(t.Samples) && t.Seconds(t.Samples[to].DTS) < end {
+				to++
+			}
+			ranges[ti] = [2]int{from, to}
+			next[ti] = to
+		}
+
+		offset := cw.n
+		if err := writeFragment(r, cw, uint32(i+1), tracks, ranges); err != nil {
+			return nil, err
+		}
+
+		last := ref.Samples[len(ref.Samples)-1]
+		if i+1 == len(cuts) {
+			end = ref.Seconds(last.DTS + uint64(last.Duration))
+		}
+		result.Fragments = append(result.Fragments, Fragment{
+			Offset:   offset,
+			Size:     cw.n - offset,
+			Duration: end - cuts[i],
+		})
+	}
+
+	return result, nil
+}
+
+// cutPoints возвращает время начала фрагментов в секундах: ключевые кадры не чаще, чем раз в target секунд.
+func cutPoints(ref *Track, target float64) []float64 {
+	cuts := []float64{ref.Seconds(ref.Samples[0].DTS)}
+	for _, s := range ref.Samples[1:] {
+		at := ref.Seconds(s.DTS)
+		if s.Sync && at-cuts[len(cuts)-1] >= target {
+			cuts = append(cuts, at)
+		}
+	}
+	return cuts
+}
+
+func ftypBox() *Box {
+	payload := []byte("iso6\x00\x00\x00\x00iso6isommp41")
+	return &Box{Type: "ftyp", Payload: payload}
+}
+
+// initMoov собирает moov init-сегмента: описания дорожек без сэмплов и mvex.
+func initMoov(src *Box, tracks []*Track) *Box {
+	moov := &Box{Type: "moov", Children: []*Box{}}
+	if mvhd := src.Child("mvhd"); mvhd != nil {
+		moov.Children = append(moov.Children, mvhd)
+	}
+
+	mvex := &Box{Type: "mvex", Children: []*Box{}}
+	for _, t := range tracks {
+		trak := &Box{Type: "trak", Children: []*Box{t.trak.Child("tkhd")}}
+
+		srcMdia := t.trak.Child("mdia")
+		mdia := &Box{Type: "mdia", Children: []*Box{}}
+		for _, child := range srcMdia.Children {
+			if child.Type != "minf" {
+				mdia.Children = append(mdia.Children, child)
+				continue
+			}
+			minf := &Box{Type: "minf", Children: []*Box{}}
+			for _, m := range child.Children {
+				if m.Type != "stbl" {
+					minf.Children = append(minf.Children, m)
+					continue
+				}
+				minf.Children = append(minf.Children, &Box{Type: "stbl", Children: []*Box{
+					m.Child("stsd"),
+					{Type: "stts", Payload: make([]byte, 8)},
+					{Type: "stsc", Payload: make([]byte, 8)},
+					{Type: "stsz", Payload: make([]byte, 12)},
+					{Type: "stco", Payload: make([]byte, 8)},
+				}})
+			}
+			mdia.Children = append(mdia.Children, minf)
+		}
+		trak.Children = append(trak.Children, mdia)
+		moov.Children = append(moov.Children, trak)
+
+		trex := make([]byte, 24)
+		binary.BigEndian.PutUint32(trex[4:], t.ID)
+		binary.BigEndian.PutUint32(trex[8:], 1) // default_sample_description_index
+		mvex.Children = append(mvex.Children, &Box{Type: "trex", Payload: trex})
+	}
+	moov.Children = append(moov.Children, mvex)
+	return moov
+}
+
+// writeFragment пишет moof с trun для каждой дорожки и mdat с данными сэмплов.
+func writeFragment(r io.ReaderAt, w io.Writer, seq uint32, tracks []*Track, ranges [][2]int) error {
+	mfhd := make([]byte, 8)
+	binary.BigEndian.PutUint32(mfhd[4:], seq)
+	moof := &Box{Type: "moof", Children: []*Box{{Type: "mfhd", Payload: mfhd}}}
+
+	var truns [][]byte
+	var dataSize int64
+	for ti, t := range tracks {
+		from, to := ranges[ti][0], ranges[ti][1]
+		if from == to {
+			continue
+		}
+
+		tfhd := make([]byte, 8)
+		binary.BigEndian.PutUint32(tfhd, 0x020000) // default-base-is-moof
+		binary.BigEndian.PutUint32(tfhd[4:], t.ID)
+
+		tfdt := make([]byte, 12)
+		tfdt[0] = 1
+		binary.BigEndian.PutUint64(tfdt[4:], t.Samples[from].DTS)
+
+		// data-offset, длительность, размер и флаги сэмпла; сдвиг отображения - если есть ctts
+		flags, entrySize := uint32(0x000701), 12
+		if t.HasCTO {
+			flags, entrySize = 0x000F01, 16
+		}
+		trun := make([]byte, 12+(to-from)*entrySize)
+		binary.BigEndian.PutUint32(trun, 1<<24|flags)
+		binary.BigEndian.PutUint32(trun[4:], uint32(to-from))
+		for i, s := range t.Samples[from:to] {
+			p := trun[12+i*entrySize:]
+			binary.BigEndian.PutUint32(p, s.Duration)
+			binary.BigEndian.PutUint32(p[4:], s.Size)
+			if s.Sync {
+				binary.BigEndian.PutUint32(p[8:], syncSampleFlags)
+			} else {
+				binary.BigEndian.PutUint32(p[8:], nonSyncSampleFlags)
+			}
+			if t.HasCTO {
+				binary.BigEndian.PutUint32(p[12:], uint32(s.CTO))
+			}
+			dataSize += int64(s.Size)
+		}
+		truns = append(truns, trun)
+
+		moof.Children = append(moof.Children, &Box{Type: "traf", Children: []*Box{
+			{Type: "tfhd", Payload: tfhd},
+			{Type: "tfdt", Payload: tfdt},
+			{Type: "trun", Payload: trun},
+		}})
+	}
+	if dataSize+8 > math.MaxUint32 {
+		return fmt.Errorf("%w: fragment is too large", ErrUnsupported)
+	}
+
+	// data_offset отсчитывается от начала moof: данные дорожек идут в mdat друг за другом
+	offset := moof.Size() + 8
+	for _, trun := range truns {
+		binary.BigEndian.PutUint32(trun[8:], uint32(offset))
+		count := int(binary.BigEndian.Uint32(trun[4:]))
+		entrySize := (len(trun) - 12) / count
+		for i := 0; i < count; i++ {
+			offset += int64(binary.BigEndian.Uint32(trun[12+i*entrySize+4:]))
+		}
+	}
+
+	if _, err := moof.WriteTo(w); err != nil {
+		return err
+	}
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(dataSize+8))
+	copy(header[4:], "mdat")
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	// Соседние сэмплы часто лежат в файле подряд - копируем их одним куском
+	for ti, t := range tracks {
+		samples := t.Samples[ranges[ti][0]:ranges[ti][1]]
+		for i := 0; i < len(samples); {
+			start, end := samples[i].Offset, samples[i].Offset+int64(samples[i].Size)
+			i++
+			for i < len(samples) && samples[i].Offset == end {
+				end += int64(samples[i].Size)
+				i++
+			}
+			if _, err := io.Copy(w, io.NewSectionReader(r, start, end-start)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestWriteFragmentedGolden(t *testing.T) {
+	input := fixture(t, "moov_at_end.mp4", func() []byte { return buildMovie(t, movieSpec{}) })
+
+	var out bytes.Buffer
+	layout, err := WriteFragmented(bytes.NewReader(input), int64(len(input)), &out, 1)
+	if err != nil {
+		t.Fatalf("WriteFragmented: %v", err)
+	}
+	checkGolden(t, "fragmented_from_moov_at_end.golden", out.Bytes())
+
+	// Ключевой кадр каждую секунду, фрагменты по секунде
+	if len(layout.Fragments) != 3 {
+		t.Fatalf("got %d fragments, want 3", len(layout.Fragments))
+	}
+	data := out.Bytes()
+	offset := layout.InitSize
+	for i, f := range layout.Fragments {
+		if f.Offset != offset {
+			t.Fatalf("fragment %d starts at %d, want %d", i, f.Offset, offset)
+		}
+		if f.Duration != 1 {
+			t.Fatalf("fragment %d lasts %.3f s, want 1", i, f.Duration)
+		}
+		offset += f.Size
+
+		// moof, затем mdat: сначала видео фрагмента, затем звук того же интервала
+		moofSize := int64(binary.BigEndian.Uint32(data[f.Offset:]))
+		mdat := data[f.Offset+moofSize : f.Offset+f.Size]
+		if string(mdat[4:8]) != "mdat" {
+			t.Fatalf("fragment %d: moof is followed by %q", i, mdat[4:8])
+		}
+		var want []byte
+		for s := i * 10; s < (i+1)*10; s++ {
+			want = append(want, sampleData(1, s, videoSampleSize(s))...)
+		}
+		for s := i * 5; s < (i+1)*5; s++ {
+			want = append(want, sampleData(2, s, audioSampleSize(s))...)
+		}
+		if !bytes.Equal(mdat[8:], want) {
+			t.Fatalf("fragment %d: mdat does not contain the samples of its interval", i)
+		}
+	}
+	if offset != int64(out.Len()) {
+		t.Fatalf("fragments end at %d, file is %d bytes", offset, out.Len())
+	}
+}
+
+func TestWriteFragmentedRejectsFragmented(t *testing.T) {
+	input := fixture(t, "fragmented.mp4", nil)
+
+	var out bytes.Buffer
+	if _, err := WriteFragmented(bytes.NewReader(input), int64(len(input)), &out, 1); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("err = %v, want ErrUnsupported", err)
+	}
+}
+
+// movieWithStsz собирает файл, в котором у видеодорожки подменена таблица размеров сэмплов.
+func movieWithStsz(t *testing.T, stsz []byte) []byte {
+	t.Helper()
+
+	ftyp := &Box{Type: "ftyp", Payload: []byte("isom\x00\x00\x02\x00isomiso2avc1mp41")}
+	moov := testMoov(movieSpec{moovFirst: true}, 0)
+	moov.Find("trak", "mdia", "minf", "stbl")[0].Child("stsz").Payload = stsz
+
+	var buf bytes.Buffer
+	for _, b := range []*Box{ftyp, moov, {Type: "mdat", Payload: testMdat()}} {
+		if _, err := b.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// Общий размер сэмпла оставляет таблицу stsz пустой: огромный count должен отклоняться
+// до выделения памяти под сэмплы.
+func TestReadTracksBoundsSampleCount(t *testing.T) {
+	tests := []struct {
+		name string
+		stsz []byte
+		want error
+	}{
+		{
+			name: "more samples than the file can hold",
+			stsz: fullBox(0, u32(1), u32(0xFFFFFFFF)),
+			want: ErrTruncated,
+		},
+		{
+			name: "more samples than stts describes",
+			stsz: fullBox(0, u32(1), u32(videoSamples+1)),
+			want: ErrUnsupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := movieWithStsz(t, tt.stsz)
+			if _, _, err := ReadTracks(bytes.NewReader(data), int64(len(data))); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
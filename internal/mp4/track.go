@@ -0,0 +1,284 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrUnsupported - файл разобран, но его нельзя переупаковать без перекодирования.
+var ErrUnsupported = errors.New("mp4 layout or codec is not supported")
+
+// Sample - сэмпл (кадр или аудиоблок) дорожки.
+type Sample struct {
+	Offset   int64  // Смещение данных в файле
+	Size     uint32 // Размер данных
+	DTS      uint64 // Время декодирования в единицах Timescale
+	Duration uint32
+	CTO      int32 // Сдвиг времени отображения относительно DTS
+	Sync     bool  // Ключевой кадр
+}
+
+// Track - дорожка MP4 с развёрнутой таблицей сэмплов.
+type Track struct {
+	ID        uint32
+	Handler   string // vide, soun и т. п.
+	Timescale uint32
+	Codec     string // Тип sample entry из stsd, например avc1 или mp4a
+	HasCTO    bool
+	Samples   []Sample
+
+	trak *Box
+}
+
+// Seconds переводит время дорожки в секунды.
+func (t *Track) Seconds(ts uint64) float64 {
+	return float64(ts) / float64(t.Timescale)
+}
+
+// ReadTracks читает moov и таблицы сэмплов всех дорожек файла.
+func ReadTracks(r io.ReaderAt, size int64) (*Box, []*Track, error) {
+	headers, err := ScanTopLevel(r, size)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var moov *Box
+	for _, h := range headers {
+		if h.Type == "moof" {
+			return nil, nil, fmt.Errorf("%w: file is already fragmented", ErrUnsupported)
+		}
+		if h.Type == "moov" && moov == nil {
+			if moov, err = ReadBox(r, h); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if moov == nil {
+		return nil, nil, ErrNotMP4
+	}
+
+	var tracks []*Track
+	for _, trak := range moov.Find("trak") {
+		t, err := readTrack(trak, size)
+		if err != nil {
+			return nil, nil, err
+		}
+		tracks = append(tracks, t)
+	}
+	return moov, tracks, nil
+}
+
+// fullBoxPayload возвращает содержимое дочернего бокса по пути, проверяя минимальную длину.
+func fullBoxPayload(b *Box, minLen int, path ...string) ([]byte, error) {
+	boxes := b.Find(path...)
+	if len(boxes) == 0 {
+		return nil, fmt.Errorf("%w: %s not found", ErrUnsupported, path[len(path)-1])
+	}
+	payload := boxes[0].Payload
+	if len(payload) < minLen {
+		return nil, fmt.Errorf("%w: %s", ErrTruncated, path[len(path)-1])
+	}
+	return payload, nil
+}
+
+// tableEntries проверяет, что в таблице (version/flags, count, записи) хватает места под count записей.
+func tableEntries(payload []byte, header, entrySize int, name string) (int, error) {
+	if len(payload) < header {
+		return 0, fmt.Errorf("%w: %s", ErrTruncated, name)
+	}
+	count := int(binary.BigEndian.Uint32(payload[header-4 : header]))
+	if count < 0 || len(payload) < header+count*entrySize {
+		return 0, fmt.Errorf("%w: %s", ErrTruncated, name)
+	}
+	return count, nil
+}
+
+// readTrack разбирает дорожку. fileSize ограничивает таблицу сэмплов: сэмплы не могут занимать больше файла.
+func readTrack(trak *Box, fileSize int64) (*Track, error) {
+	t := &Track{trak: trak}
+
+	tkhd, err := fullBoxPayload(trak, 24, "tkhd")
+	if err != nil {
+		return nil, err
+	}
+	if tkhd[0] == 1 {
+		t.ID = binary.BigEndian.Uint32(tkhd[20:24])
+	} else {
+		t.ID = binary.BigEndian.Uint32(tkhd[12:16])
+	}
+
+	mdhd, err := fullBoxPayload(trak, 24, "mdia", "mdhd")
+	if err != nil {
+		return nil, err
+	}
+	if mdhd[0] == 1 {
+		t.Timescale = binary.BigEndian.Uint32(mdhd[20:24])
+	} else {
+		t.Timescale = binary.BigEndian.Uint32(mdhd[12:16])
+	}
+	if t.Timescale == 0 {
+		return nil, fmt.Errorf("%w: zero timescale", ErrUnsupported)
+	}
+
+	hdlr, err := fullBoxPayload(trak, 12, "mdia", "hdlr")
+	if err != nil {
+		return nil, err
+	}
+	t.Handler = string(hdlr[8:12])
+
+	stbls := trak.Find("mdia", "minf", "stbl")
+	if len(stbls) == 0 {
+		return nil, fmt.Errorf("%w: stbl not found", ErrUnsupported)
+	}
+	stbl := stbls[0]
+
+	stsd, err := fullBoxPayload(stbl, 16, "stsd")
+	if err != nil {
+		return nil, err
+	}
+	t.Codec = string(stsd[12:16])
+
+	if err := t.readSamples(stbl, fileSize); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// readSamples разворачивает stts, ctts, stsz, stsc, stco/co64 и stss в список сэмплов.
+// Число сэмплов из stsz проверяется до выделения памяти: при общем размере сэмпла
+// таблица размеров пустая, и count ничем, кроме stts и размера файла, не ограничен.
+func (t *Track) readSamples(stbl *Box, fileSize int64) error {
+	stsz, err := fullBoxPayload(stbl, 12, "stsz")
+	if err != nil {
+		return err
+	}
+	uniformSize := binary.BigEndian.Uint32(stsz[4:8])
+	count := int(binary.BigEndian.Uint32(stsz[8:12]))
+	if uniformSize == 0 && len(stsz) < 12+count*4 {
+		return fmt.Errorf("%w: stsz", ErrTruncated)
+	}
+	if uniformSize != 0 && uint64(count)*uint64(uniformSize) > uint64(fileSize) {
+		return fmt.Errorf("%w: stsz describes %d samples of %d bytes in a %d byte file", ErrTruncated, count, uniformSize, fileSize)
+	}
+
+	// Длительности и время декодирования
+	stts, err := fullBoxPayload(stbl, 8, "stts")
+	if err != nil {
+		return err
+	}
+	entries, err := tableEntries(stts, 8, 8, "stts")
+	if err != nil {
+		return err
+	}
+	var timed uint64
+	for e := 0; e < entries; e++ {
+		timed += uint64(binary.BigEndian.Uint32(stts[8+e*8:]))
+	}
+	if uint64(count) > timed {
+		return fmt.Errorf("%w: stts covers %d of %d samples", ErrUnsupported, timed, count)
+	}
+
+	t.Samples = make([]Sample, count)
+	for i := range t.Samples {
+		t.Samples[i].Size = uniformSize
+		if uniformSize == 0 {
+			t.Samples[i].Size = binary.BigEndian.Uint32(stsz[12+i*4:])
+		}
+	}
+
+	i := 0
+	var dts uint64
+	for e := 0; e < entries && i < count; e++ {
+		n := int(binary.BigEndian.Uint32(stts[8+e*8:]))
+		delta := binary.BigEndian.Uint32(stts[12+e*8:])
+		for ; n > 0 && i < count; n-- {
+			t.Samples[i].DTS = dts
+			t.Samples[i].Duration = delta
+			dts += uint64(delta)
+			i++
+		}
+	}
+
+	// Сдвиги времени отображения (B-кадры)
+	if ctts := stbl.Child("ctts"); ctts != nil {
+		entries, err := tableEntries(ctts.Payload, 8, 8, "ctts")
+		if err != nil {
+			return err
+		}
+		t.HasCTO = true
+		i := 0
+		for e := 0; e < entries && i < count; e++ {
+			n := int(binary.BigEndian.Uint32(ctts.Payload[8+e*8:]))
+			offset := int32(binary.BigEndian.Uint32(ctts.Payload[12+e*8:]))
+			for ; n > 0 && i < count; n-- {
+				t.Samples[i].CTO = offset
+				i++
+			}
+		}
+	}
+
+	// Ключевые кадры; без stss все сэмплы ключевые
+	if stss := stbl.Child("stss"); stss != nil {
+		entries, err := tableEntries(stss.Payload, 8, 4, "stss")
+		if err != nil {
+			return err
+		}
+		for e := 0; e < entries; e++ {
+			n := int(binary.BigEndian.Uint32(stss.Payload[8+e*4:]))
+			if n >= 1 && n <= count {
+				t.Samples[n-1].Sync = true
+			}
+		}
+	} else {
+		for i := range t.Samples {
+			t.Samples[i].Sync = true
+		}
+	}
+
+	// Смещения: сэмплы лежат чанками, число сэмплов в чанке задаёт stsc
+	var offsets *Box
+	if offsets = stbl.Child("stco"); offsets == nil {
+		offsets = stbl.Child("co64")
+	}
+	if offsets == nil {
+		return fmt.Errorf("%w: chunk offsets not found", ErrUnsupported)
+	}
+	chunks, err := readChunkOffsets(offsets)
+	if err != nil {
+		return err
+	}
+
+	stsc, err := fullBoxPayload(stbl, 8, "stsc")
+	if err != nil {
+		return err
+	}
+	entries, err = tableEntries(stsc, 8, 12, "stsc")
+	if err != nil {
+		return err
+	}
+
+	i = 0
+	for e := 0; e < entries; e++ {
+		first := int(binary.BigEndian.Uint32(stsc[8+e*12:]))
+		perChunk := int(binary.BigEndian.Uint32(stsc[12+e*12:]))
+		last := len(chunks.offsets)
+		if e+1 < entries {
+			last = int(binary.BigEndian.Uint32(stsc[8+(e+1)*12:])) - 1
+		}
+		for chunk := first; chunk <= last && chunk >= 1 && chunk <= len(chunks.offsets); chunk++ {
+			offset := int64(chunks.offsets[chunk-1])
+			for n := 0; n < perChunk && i < count; n++ {
+				t.Samples[i].Offset = offset
+				offset += int64(t.Samples[i].Size)
+				i++
+			}
+		}
+	}
+	if i < count {
+		return fmt.Errorf("%w: stsc covers %d of %d samples", ErrUnsupported, i, count)
+	}
+
+	return nil
+}
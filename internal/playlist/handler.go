@@ -0,0 +1,615 @@
+package playlist
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toxanetoxa/gohls/internal/user"
+	"github.com/toxanetoxa/gohls/internal/video"
+	"github.com/toxanetoxa/gohls/pkg/env"
+	"gorm.io/gorm"
+)
+
+// Handler обрабатывает запросы плейлистов.
+type Handler struct {
+	DB       *gorm.DB
+	MaxItems int // Максимальное число видео в плейлисте, 0 - без ограничения
+}
+
+// NewPlaylistHandler создаёт новый экземпляр Handler.
+func NewPlaylistHandler(db *gorm.DB) *Handler {
+	return &Handler{DB: db, MaxItems: env.Int("PLAYLIST_MAX_ITEMS", 500)}
+}
+
+var visibilities = map[string]bool{
+	video.VisibilityPublic:   true,
+	video.VisibilityUnlisted: true,
+	video.VisibilityPrivate:  true,
+}
+
+type CreatePlaylistRequest struct {
+	Title       string `json:"title" binding:"required"`
+	Description string `json:"description"`
+	Visibility  string `json:"visibility"` // По умолчанию private
+}
+
+type UpdatePlaylistRequest struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Visibility  *string `json:"visibility"`
+}
+
+type AddItemRequest struct {
+	VideoID  uint `json:"video_id" binding:"required"`
+	Position *int `json:"position"` // Без позиции - в конец
+}
+
+type ReorderRequest struct {
+	VideoIDs []uint `json:"video_ids" binding:"required"` // Все видео плейлиста в новом порядке
+}
+
+// currentUser возвращает пользователя из контекста или nil для анонимного запроса.
+func (h *Handler) currentUser(c *gin.Context) (*user.User, error) {
+	username := c.GetString("username")
+	if username == "" {
+		return nil, nil
+	}
+
+	var u user.User
+	if err := h.DB.Where("username = ?", username).First(&u).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// requireUser возвращает текущего пользователя и при его отсутствии сам отвечает клиенту.
+func (h *Handler) requireUser(c *gin.Context) (*user.User, bool) {
+	u, err := h.currentUser(c)
+	if err != nil || u == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+	return u, true
+}
+
+// loadPlaylist ищет плейлист по параметру id (или псевдониму watch-later) и проверяет доступ к нему.
+// Чужие приватные плейлисты выглядят несуществующими, как и приватные видео.
+func (h *Handler) loadPlaylist(c *gin.Context) (*Playlist, *user.User, bool) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return nil, nil, false
+	}
+
+	if c.Param("id") == watchLaterAlias {
+		if u == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return nil, nil, false
+		}
+		p, err := WatchLater(h.DB, u.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch playlist", "details": err.Error()})
+			return nil, nil, false
+		}
+		return p, u, true
+	}
+
+	var p Playlist
+	if err := h.DB.First(&p, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch playlist", "details": err.Error()})
+		return nil, nil, false
+	}
+
+	if p.Visibility == video.VisibilityPrivate && (u == nil || u.ID != p.OwnerID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return nil, nil, false
+	}
+	return &p, u, true
+}
+
+// loadOwnPlaylist ищет плейлист и проверяет, что текущий пользователь - его владелец.
+func (h *Handler) loadOwnPlaylist(c *gin.Context) (*Playlist, bool) {
+	p, u, ok := h.loadPlaylist(c)
+	if !ok {
+		return nil, false
+	}
+	if u == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+	if u.ID != p.OwnerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can change the playlist"})
+		return nil, false
+	}
+	return p, true
+}
+
+func viewerID(u *user.User) uint {
+	if u == nil {
+		return 0
+	}
+	return u.ID
+}
+
+// visibleItems возвращает запрос к видео плейлиста, которые зритель может видеть:
+// чужие приватные и скрытые модерацией, а также отклонённые и снятые видео в плейлисте не показываются.
+// Автор видит свои приватные и скрытые видео, как и в каталоге.
+func (h *Handler) visibleItems(playlistID, viewerID uint) *gorm.DB {
+	return h.DB.Table("playlist_items pi").
+		Joins("JOIN videos v ON v.id = pi.video_id").
+		Where("pi.playlist_id = ?", playlistID).
+		Where("v.status <> ? AND v.moderation_status <> ?", video.StatusRejected, video.ModerationTakenDown).
+		Where("v.author_id = ? OR (v.visibility <> ? AND v.moderation_status = ?)",
+			viewerID, video.VisibilityPrivate, video.ModerationNone)
+}
+
+// itemRow - видео плейлиста.
+type itemRow struct {
+	Position     int
+	AddedAt      time.Time
+	VideoID      uint
+	Title        string
+	AuthorID     uint
+	Duration     float64
+	ThumbnailKey string
+	Status       string
+	IsPaid       bool
+}
+
+const itemColumns = "pi.position, pi.added_at, v.id AS video_id, v.title, v.author_id, v.duration, v.thumbnail_key, v.status, v.is_paid"
+
+func (r *itemRow) response() gin.H {
+	thumbnailURL := ""
+	if r.ThumbnailKey != "" {
+		thumbnailURL = fmt.Sprintf("/videos/%d/thumbnail", r.VideoID)
+	}
+	return gin.H{
+		"position":      r.Position,
+		"added_at":      r.AddedAt,
+		"video_id":      r.VideoID,
+		"title":         r.Title,
+		"author_id":     r.AuthorID,
+		"duration":      r.Duration,
+		"thumbnail_url": thumbnailURL,
+		"status":        r.Status,
+		"is_paid":       r.IsPaid,
+	}
+}
+
+func playlistResponse(p *Playlist) gin.H {
+	return gin.H{
+		"id":          p.ID,
+		"owner_id":    p.OwnerID,
+		"title":       p.Title,
+		"description": p.Description,
+		"visibility":  p.Visibility,
+		"kind":        p.Kind,
+		"created_at":  p.CreatedAt,
+		"updated_at":  p.UpdatedAt,
+	}
+}
+
+// CreatePlaylist создаёт плейлист текущего пользователя.
+func (h *Handler) CreatePlaylist(c *gin.Context) {
+	u, ok := h.requireUser(c)
+	if !ok {
+		return
+	}
+
+	var req CreatePlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Visibility == "" {
+		req.Visibility = video.VisibilityPrivate
+	}
+	if !visibilities[req.Visibility] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Visibility must be public, unlisted or private"})
+		return
+	}
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Title must not be empty"})
+		return
+	}
+
+	p := Playlist{
+		OwnerID:     u.ID,
+		Title:       title,
+		Description: req.Description,
+		Visibility:  req.Visibility,
+		Kind:        KindUser,
+	}
+	if err := h.DB.Create(&p).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create playlist", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, playlistResponse(&p))
+}
+
+// listPlaylists отдаёт плейлисты владельца с числом видео.
+func (h *Handler) listPlaylists(c *gin.Context, query *gorm.DB) {
+	var playlists []Playlist
+	if err := query.Order("kind = 'watch_later' DESC, created_at DESC").Find(&playlists).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch playlists", "details": err.Error()})
+		return
+	}
+
+	ids := make([]uint, 0, len(playlists))
+	for _, p := range playlists {
+		ids = append(ids, p.ID)
+	}
+	type countRow struct {
+		PlaylistID uint
+		Count      int64
+	}
+	var counts []countRow
+	if err := h.DB.Model(&Item{}).Select("playlist_id, COUNT(*) AS count").
+		Where("playlist_id IN ?", ids).Group("playlist_id").Scan(&counts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count playlist items", "details": err.Error()})
+		return
+	}
+	byID := make(map[uint]int64, len(counts))
+	for _, r := range counts {
+		byID[r.PlaylistID] = r.Count
+	}
+
+	result := make([]gin.H, 0, len(playlists))
+	for i := range playlists {
+		item := playlistResponse(&playlists[i])
+		item["items"] = byID[playlists[i].ID]
+		result = append(result, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"playlists": result})
+}
+
+// ListMyPlaylists отдаёт все плейлисты текущего пользователя, включая "Смотреть позже".
+func (h *Handler) ListMyPlaylists(c *gin.Context) {
+	u, ok := h.requireUser(c)
+	if !ok {
+		return
+	}
+	if _, err := WatchLater(h.DB, u.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch playlist", "details": err.Error()})
+		return
+	}
+	h.listPlaylists(c, h.DB.Where("owner_id = ?", u.ID))
+}
+
+// ListUserPlaylists отдаёт публичные плейлисты пользователя; владельцу - все.
+func (h *Handler) ListUserPlaylists(c *gin.Context) {
+	ownerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	query := h.DB.Where("owner_id = ?", ownerID)
+	if viewerID(u) != uint(ownerID) {
+		query = query.Where("visibility = ?", video.VisibilityPublic)
+	}
+	h.listPlaylists(c, query)
+}
+
+// GetPlaylist отдаёт плейлист с видео по порядку.
+func (h *Handler) GetPlaylist(c *gin.Context) {
+	p, u, ok := h.loadPlaylist(c)
+	if !ok {
+		return
+	}
+
+	var rows []itemRow
+	if err := h.visibleItems(p.ID, viewerID(u)).Select(itemColumns).Order("pi.position").Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch playlist items", "details": err.Error()})
+		return
+	}
+
+	items := make([]gin.H, 0, len(rows))
+	for i := range rows {
+		items = append(items, rows[i].response())
+	}
+	resp := playlistResponse(p)
+	resp["items"] = items
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdatePlaylist изменяет название, описание и видимость плейлиста.
+func (h *Handler) UpdatePlaylist(c *gin.Context) {
+	p, ok := h.loadOwnPlaylist(c)
+	if !ok {
+		return
+	}
+	if p.Kind == KindWatchLater {
+		c.JSON(http.StatusConflict, gin.H{"error": "Watch later playlist cannot be changed"})
+		return
+	}
+
+	var req UpdatePlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Title must not be empty"})
+			return
+		}
+		updates["title"] = title
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.Visibility != nil {
+		if !visibilities[*req.Visibility] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Visibility must be public, unlisted or private"})
+			return
+		}
+		updates["visibility"] = *req.Visibility
+	}
+
+	if len(updates) > 0 {
+		if err := h.DB.Model(p).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update playlist", "details": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, playlistResponse(p))
+}
+
+// DeletePlaylist удаляет плейлист. Видео не затрагиваются.
+func (h *Handler) DeletePlaylist(c *gin.Context) {
+	p, ok := h.loadOwnPlaylist(c)
+	if !ok {
+		return
+	}
+	if p.Kind == KindWatchLater {
+		c.JSON(http.StatusConflict, gin.H{"error": "Watch later playlist cannot be deleted"})
+		return
+	}
+
+	if err := h.DB.Delete(p).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete playlist", "details": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// AddItem добавляет видео в плейлист. Добавить можно любое видео, кроме чужих приватных.
+func (h *Handler) AddItem(c *gin.Context) {
+	p, ok := h.loadOwnPlaylist(c)
+	if !ok {
+		return
+	}
+
+	var req AddItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var v video.Video
+	if err := h.DB.First(&v, req.VideoID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch video", "details": err.Error()})
+		return
+	}
+	if v.Visibility == video.VisibilityPrivate && v.AuthorID != p.OwnerID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Video not found"})
+		return
+	}
+	if v.Status == video.StatusRejected {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Video was rejected"})
+		return
+	}
+
+	var item *Item
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Блокируем плейлист, чтобы параллельные добавления не получили одинаковые позиции
+		if err := tx.Exec("SELECT id FROM playlists WHERE id = ? FOR UPDATE", p.ID).Error; err != nil {
+			return err
+		}
+
+		var exists, count int64
+		if err := tx.Model(&Item{}).Where("playlist_id = ? AND video_id = ?", p.ID, v.ID).Count(&exists).Error; err != nil {
+			return err
+		}
+		if exists > 0 {
+			return errAlreadyAdded
+		}
+		if err := tx.Model(&Item{}).Where("playlist_id = ?", p.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if h.MaxItems > 0 && count >= int64(h.MaxItems) {
+			return errPlaylistFull
+		}
+
+		var err error
+		item, err = appendItem(tx, p.ID, v.ID, req.Position)
+		return err
+	})
+	switch {
+	case errors.Is(err, errAlreadyAdded):
+		c.JSON(http.StatusConflict, gin.H{"error": "Video is already in the playlist"})
+		return
+	case errors.Is(err, errPlaylistFull):
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Playlist cannot contain more than %d videos", h.MaxItems)})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add video", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"playlist_id": p.ID, "video_id": item.VideoID, "position": item.Position})
+}
+
+var (
+	errAlreadyAdded = errors.New("video is already in the playlist")
+	errPlaylistFull = errors.New("playlist is full")
+)
+
+// RemoveItem убирает видео из плейлиста.
+func (h *Handler) RemoveItem(c *gin.Context) {
+	p, ok := h.loadOwnPlaylist(c)
+	if !ok {
+		return
+	}
+	videoID, err := strconv.ParseUint(c.Param("videoID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid video ID"})
+		return
+	}
+
+	var removed bool
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT id FROM playlists WHERE id = ? FOR UPDATE", p.ID).Error; err != nil {
+			return err
+		}
+		var err error
+		removed, err = removeItem(tx, p.ID, uint(videoID))
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove video", "details": err.Error()})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Video is not in the playlist"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ReorderItems задаёт новый порядок видео. В запросе должны быть перечислены все видео плейлиста.
+func (h *Handler) ReorderItems(c *gin.Context) {
+	p, ok := h.loadOwnPlaylist(c)
+	if !ok {
+		return
+	}
+
+	var req ReorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT id FROM playlists WHERE id = ? FOR UPDATE", p.ID).Error; err != nil {
+			return err
+		}
+
+		var current []uint
+		if err := tx.Model(&Item{}).Where("playlist_id = ?", p.ID).Pluck("video_id", &current).Error; err != nil {
+			return err
+		}
+		if !samePlaylistItems(current, req.VideoIDs) {
+			return errReorderMismatch
+		}
+
+		for i, id := range req.VideoIDs {
+			if err := tx.Model(&Item{}).Where("playlist_id = ? AND video_id = ?", p.ID, id).
+				Update("position", i).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errReorderMismatch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "video_ids must list every video of the playlist exactly once"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder playlist", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"playlist_id": p.ID, "video_ids": req.VideoIDs})
+}
+
+var errReorderMismatch = errors.New("reorder does not match playlist items")
+
+// samePlaylistItems проверяет, что order - перестановка current без повторов.
+func samePlaylistItems(current, order []uint) bool {
+	if len(current) != len(order) {
+		return false
+	}
+	left := make(map[uint]bool, len(current))
+	for _, id := range current {
+		left[id] = true
+	}
+	for _, id := range order {
+		if !left[id] {
+			return false
+		}
+		delete(left, id)
+	}
+	return true
+}
+
+// NextItem отдаёт видео, которое играет после after. Без after - первое видео плейлиста.
+// Пропускаются видео, которые зритель не видит или которые ещё не готовы.
+func (h *Handler) NextItem(c *gin.Context) {
+	p, u, ok := h.loadPlaylist(c)
+	if !ok {
+		return
+	}
+
+	position := -1
+	if after := c.Query("after"); after != "" {
+		afterID, err := strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid video ID"})
+			return
+		}
+
+		var item Item
+		if err := h.DB.Where("playlist_id = ? AND video_id = ?", p.ID, afterID).First(&item).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Video is not in the playlist"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch playlist item", "details": err.Error()})
+			return
+		}
+		position = item.Position
+	}
+
+	var rows []itemRow
+	err := h.visibleItems(p.ID, viewerID(u)).
+		Select(itemColumns).
+		Where("pi.position > ? AND v.status = ?", position, video.StatusReady).
+		Order("pi.position").
+		Limit(1).
+		Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch playlist item", "details": err.Error()})
+		return
+	}
+
+	// Конец плейлиста
+	var next gin.H
+	if len(rows) > 0 {
+		next = rows[0].response()
+	}
+	c.JSON(http.StatusOK, gin.H{"playlist_id": p.ID, "next": next})
+}
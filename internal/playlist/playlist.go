@@ -0,0 +1,112 @@
+package playlist
+
+import (
+	"errors"
+	"time"
+
+	"github.com/toxanetoxa/gohls/internal/video"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Виды плейлистов
+const (
+	KindUser       = "user"        // Созданный пользователем
+	KindWatchLater = "watch_later" // Встроенный "Смотреть позже", по одному на пользователя
+)
+
+// Псевдоним встроенного плейлиста в URL: /playlists/watch-later/...
+const watchLaterAlias = "watch-later"
+
+const watchLaterTitle = "Watch later"
+
+// Playlist - упорядоченная подборка видео пользователя.
+type Playlist struct {
+	ID          uint      `gorm:"primaryKey"`
+	OwnerID     uint      `gorm:"not null"`
+	Title       string    `gorm:"not null"`
+	Description string    `gorm:"not null;default:''"`
+	Visibility  string    `gorm:"not null;default:private"` // public, unlisted, private - как у видео
+	Kind        string    `gorm:"not null;default:user"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+}
+
+// Item - видео в плейлисте. Position задаёт порядок, начиная с 0.
+type Item struct {
+	PlaylistID uint      `gorm:"primaryKey;autoIncrement:false"`
+	VideoID    uint      `gorm:"primaryKey;autoIncrement:false"`
+	Position   int       `gorm:"not null"`
+	AddedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+func (Item) TableName() string {
+	return "playlist_items"
+}
+
+// WatchLater возвращает плейлист "Смотреть позже" пользователя, создавая его при первом обращении.
+func WatchLater(db *gorm.DB, ownerID uint) (*Playlist, error) {
+	p := Playlist{
+		OwnerID:    ownerID,
+		Title:      watchLaterTitle,
+		Visibility: video.VisibilityPrivate,
+		Kind:       KindWatchLater,
+	}
+	// Уникальный индекс по владельцу для watch_later не даёт создать второй плейлист при гонке
+	err := db.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "owner_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "kind = '" + KindWatchLater + "'"}}},
+		DoNothing:   true,
+	}).Create(&p).Error
+	if err != nil {
+		return nil, err
+	}
+	if p.ID != 0 {
+		return &p, nil
+	}
+
+	err = db.Where("owner_id = ? AND kind = ?", ownerID, KindWatchLater).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("watch later playlist was not created")
+	}
+	return &p, err
+}
+
+// appendItem добавляет видео в конец плейлиста или на позицию position, сдвигая остальные.
+func appendItem(tx *gorm.DB, playlistID, videoID uint, position *int) (*Item, error) {
+	var count int64
+	if err := tx.Model(&Item{}).Where("playlist_id = ?", playlistID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+
+	item := Item{PlaylistID: playlistID, VideoID: videoID, Position: int(count)}
+	if position != nil && *position >= 0 && *position < int(count) {
+		item.Position = *position
+		if err := tx.Model(&Item{}).
+			Where("playlist_id = ? AND position >= ?", playlistID, item.Position).
+			Update("position", gorm.Expr("position + 1")).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &item, tx.Create(&item).Error
+}
+
+// removeItem удаляет видео из плейлиста и закрывает промежуток в позициях.
+// Возвращает false, если видео в плейлисте не было.
+func removeItem(tx *gorm.DB, playlistID, videoID uint) (bool, error) {
+	var item Item
+	err := tx.Where("playlist_id = ? AND video_id = ?", playlistID, videoID).First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Delete(&item).Error; err != nil {
+		return false, err
+	}
+	return true, tx.Model(&Item{}).
+		Where("playlist_id = ? AND position > ?", playlistID, item.Position).
+		Update("position", gorm.Expr("position - 1")).Error
+}
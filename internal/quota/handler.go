@@ -0,0 +1,216 @@
+package quota
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toxanetoxa/gohls/internal/user"
+	"gorm.io/gorm"
+)
+
+// Handler - эндпоинты использования квоты и управления квотами для администратора.
+type Handler struct {
+	DB *gorm.DB
+}
+
+// NewQuotaHandler создаёт новый экземпляр Handler.
+func NewQuotaHandler(db *gorm.DB) *Handler {
+	return &Handler{DB: db}
+}
+
+// UpdateQuotaRequest - переопределение лимитов. Отсутствующее или null поле возвращает лимит роли.
+type UpdateQuotaRequest struct {
+	MaxBytes    *int64   `json:"max_bytes"`
+	MaxVideos   *int64   `json:"max_videos"`
+	MaxFileSize *int64   `json:"max_file_size"`
+	MaxDuration *float64 `json:"max_duration"`
+}
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// usageResponse описывает квоту пользователя.
+func (h *Handler) usageResponse(u *user.User) (gin.H, error) {
+	limits, err := LimitsFor(h.DB, u)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := UsageOf(h.DB, u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"user_id":   u.ID,
+		"role":      u.Role,
+		"limits":    limits,
+		"usage":     usage,
+		"remaining": RemainingOf(limits, usage),
+	}, nil
+}
+
+// GetMyUsage возвращает лимиты, занятое место и остаток квоты текущего пользователя.
+func (h *Handler) GetMyUsage(c *gin.Context) {
+	var u user.User
+	if err := h.DB.Where("username = ?", c.GetString("username")).First(&u).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	resp, err := h.usageResponse(&u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// loadUser ищет пользователя по параметру id и при ошибке сам отвечает клиенту.
+func (h *Handler) loadUser(c *gin.Context) (*user.User, bool) {
+	var u user.User
+	if err := h.DB.First(&u, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user", "details": err.Error()})
+		return nil, false
+	}
+	return &u, true
+}
+
+// GetUserQuota возвращает квоту пользователя вместе с переопределением администратора.
+func (h *Handler) GetUserQuota(c *gin.Context) {
+	u, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.usageResponse(u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage", "details": err.Error()})
+		return
+	}
+
+	var o Override
+	if err := h.DB.Where("user_id = ?", u.ID).Limit(1).Find(&o).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quota override", "details": err.Error()})
+		return
+	}
+	resp["role_limits"] = RoleLimits(u.Role)
+	resp["override"] = nil
+	if o.UserID != 0 {
+		resp["override"] = UpdateQuotaRequest{
+			MaxBytes:    o.MaxBytes,
+			MaxVideos:   o.MaxVideos,
+			MaxFileSize: o.MaxFileSize,
+			MaxDuration: o.MaxDuration,
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// SetUserQuota назначает пользователю собственные лимиты вместо лимитов роли.
+func (h *Handler) SetUserQuota(c *gin.Context) {
+	u, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, v := range []*int64{req.MaxBytes, req.MaxVideos, req.MaxFileSize} {
+		if v != nil && *v < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limits must not be negative"})
+			return
+		}
+	}
+	if req.MaxDuration != nil && *req.MaxDuration < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Limits must not be negative"})
+		return
+	}
+
+	o := Override{
+		UserID:      u.ID,
+		MaxBytes:    req.MaxBytes,
+		MaxVideos:   req.MaxVideos,
+		MaxFileSize: req.MaxFileSize,
+		MaxDuration: req.MaxDuration,
+	}
+	if err := h.DB.Save(&o).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save quota override", "details": err.Error()})
+		return
+	}
+
+	resp, err := h.usageResponse(u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteUserQuota возвращает пользователю лимиты его роли.
+func (h *Handler) DeleteUserQuota(c *gin.Context) {
+	u, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Where("user_id = ?", u.ID).Delete(&Override{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete quota override", "details": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// SetUserRole меняет роль пользователя, а вместе с ней и лимиты по умолчанию.
+func (h *Handler) SetUserRole(c *gin.Context) {
+	u, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role != user.RoleUser && req.Role != user.RoleModerator && req.Role != user.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role", "role": req.Role})
+		return
+	}
+
+	if err := h.DB.Model(u).Update("role", req.Role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role", "details": err.Error()})
+		return
+	}
+	u.Role = req.Role
+
+	resp, err := h.usageResponse(u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Respond отвечает клиенту на превышение квоты: 413 для размера, 403 для количества и длительности.
+func Respond(c *gin.Context, e *Exceeded) {
+	status := http.StatusForbidden
+	if e.Reason == ReasonBytes || e.Reason == ReasonFileSize {
+		status = http.StatusRequestEntityTooLarge
+	}
+	c.JSON(status, gin.H{
+		"error":     "Quota exceeded",
+		"details":   e.Reason,
+		"limits":    e.Limits,
+		"usage":     e.Usage,
+		"remaining": e.Remaining,
+	})
+}
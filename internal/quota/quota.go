@@ -0,0 +1,191 @@
+// Package quota ограничивает место и количество видео, которые может загрузить пользователь.
+package quota
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/toxanetoxa/gohls/internal/user"
+	"github.com/toxanetoxa/gohls/pkg/env"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Limits - лимиты пользователя. Ноль означает отсутствие ограничения.
+type Limits struct {
+	MaxBytes    int64   `json:"max_bytes"`     // Суммарный размер всех видео
+	MaxVideos   int64   `json:"max_videos"`    // Количество видео
+	MaxFileSize int64   `json:"max_file_size"` // Размер одного файла
+	MaxDuration float64 `json:"max_duration"`  // Длительность одного видео в секундах
+}
+
+// Лимиты ролей по умолчанию, переопределяются переменными QUOTA_<РОЛЬ>_MAX_BYTES и т. д.
+var defaultLimits = map[string]Limits{
+	user.RoleUser: {
+		MaxBytes:    10 << 30,
+		MaxVideos:   100,
+		MaxFileSize: 2 << 30,
+		MaxDuration: 4 * 60 * 60,
+	},
+	user.RoleAdmin: {},
+}
+
+// RoleLimits возвращает лимиты роли с учётом переменных окружения.
+func RoleLimits(role string) Limits {
+	def, ok := defaultLimits[role]
+	if !ok {
+		def = defaultLimits[user.RoleUser]
+	}
+
+	prefix := "QUOTA_" + strings.ToUpper(role) + "_"
+	return Limits{
+		MaxBytes:    env.Int64(prefix+"MAX_BYTES", def.MaxBytes),
+		MaxVideos:   env.Int64(prefix+"MAX_VIDEOS", def.MaxVideos),
+		MaxFileSize: env.Int64(prefix+"MAX_FILE_SIZE", def.MaxFileSize),
+		MaxDuration: env.Float(prefix+"MAX_DURATION", def.MaxDuration),
+	}
+}
+
+// Override - лимиты, назначенные пользователю администратором. NULL - взять лимит роли.
+type Override struct {
+	UserID      uint `gorm:"primaryKey;autoIncrement:false"`
+	MaxBytes    *int64
+	MaxVideos   *int64
+	MaxFileSize *int64
+	MaxDuration *float64
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+}
+
+func (Override) TableName() string {
+	return "user_quotas"
+}
+
+// apply накладывает заданные поля переопределения на лимиты роли.
+func (o *Override) apply(l Limits) Limits {
+	if o.MaxBytes != nil {
+		l.MaxBytes = *o.MaxBytes
+	}
+	if o.MaxVideos != nil {
+		l.MaxVideos = *o.MaxVideos
+	}
+	if o.MaxFileSize != nil {
+		l.MaxFileSize = *o.MaxFileSize
+	}
+	if o.MaxDuration != nil {
+		l.MaxDuration = *o.MaxDuration
+	}
+	return l
+}
+
+// Usage - занятое пользователем место.
+type Usage struct {
+	Bytes  int64 `json:"bytes"`
+	Videos int64 `json:"videos"`
+}
+
+// LimitsFor возвращает действующие лимиты пользователя: лимиты роли с переопределением администратора.
+func LimitsFor(db *gorm.DB, u *user.User) (Limits, error) {
+	limits := RoleLimits(u.Role)
+
+	var o Override
+	err := db.Where("user_id = ?", u.ID).Limit(1).Find(&o).Error
+	if err != nil {
+		return Limits{}, err
+	}
+	if o.UserID != 0 {
+		limits = o.apply(limits)
+	}
+	return limits, nil
+}
+
+// UsageOf считает видео пользователя и их суммарный размер.
+func UsageOf(db *gorm.DB, userID uint) (Usage, error) {
+	var usage Usage
+	err := db.Table("videos").
+		Select("COUNT(*) AS videos, COALESCE(SUM(file_size), 0) AS bytes").
+		Where("author_id = ?", userID).
+		Scan(&usage).Error
+	return usage, err
+}
+
+// Lock блокирует строку пользователя до конца транзакции tx: параллельные загрузки одного
+// пользователя проверяют квоту и создают видео по очереди, а не по одному и тому же снимку UsageOf.
+func Lock(tx *gorm.DB, userID uint) error {
+	var u user.User
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&u, userID).Error
+}
+
+// CheckUpload проверяет, помещается ли в квоту ещё одно видео размером size. nil - помещается.
+func CheckUpload(l Limits, u Usage, size int64) *Exceeded {
+	switch {
+	case l.MaxVideos > 0 && u.Videos >= l.MaxVideos:
+		return NewExceeded(ReasonVideos, l, u)
+	case l.MaxFileSize > 0 && size > l.MaxFileSize:
+		return NewExceeded(ReasonFileSize, l, u)
+	case l.MaxBytes > 0 && u.Bytes+size > l.MaxBytes:
+		return NewExceeded(ReasonBytes, l, u)
+	}
+	return nil
+}
+
+// Remaining - сколько ещё можно загрузить. nil - без ограничения.
+type Remaining struct {
+	Bytes  *int64 `json:"bytes"`
+	Videos *int64 `json:"videos"`
+}
+
+// RemainingOf вычисляет остаток квоты.
+func RemainingOf(l Limits, u Usage) Remaining {
+	var r Remaining
+	if l.MaxBytes > 0 {
+		bytes := max(l.MaxBytes-u.Bytes, 0)
+		r.Bytes = &bytes
+	}
+	if l.MaxVideos > 0 {
+		videos := max(l.MaxVideos-u.Videos, 0)
+		r.Videos = &videos
+	}
+	return r
+}
+
+// MaxUploadSize возвращает предельный размер следующего файла: меньшее из лимита на файл
+// и свободного места. 0 - без ограничения, отрицательное значение - места нет.
+func MaxUploadSize(l Limits, u Usage) int64 {
+	size := l.MaxFileSize
+	if l.MaxBytes > 0 {
+		free := l.MaxBytes - u.Bytes
+		if free <= 0 {
+			return -1
+		}
+		if size == 0 || free < size {
+			size = free
+		}
+	}
+	return size
+}
+
+// Exceeded - нарушение квоты с данными для ответа клиенту.
+type Exceeded struct {
+	Reason    string
+	Limits    Limits
+	Usage     Usage
+	Remaining Remaining
+}
+
+func (e *Exceeded) Error() string {
+	return fmt.Sprintf("quota exceeded: %s", e.Reason)
+}
+
+// Причины отказа
+const (
+	ReasonVideos   = "video count limit reached"
+	ReasonBytes    = "storage quota exceeded"
+	ReasonFileSize = "file is too large"
+	ReasonDuration = "video is too long"
+)
+
+// NewExceeded собирает ошибку превышения квоты.
+func NewExceeded(reason string, l Limits, u Usage) *Exceeded {
+	return &Exceeded{Reason: reason, Limits: l, Usage: u, Remaining: RemainingOf(l, u)}
+}
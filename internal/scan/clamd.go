@@ -0,0 +1,124 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Размер блока, передаваемого clamd. Должен быть меньше StreamMaxLength в clamd.conf.
+const clamdChunkSize = 64 << 10
+
+// Ответ clamd на поток длиннее StreamMaxLength
+const clamdSizeLimitReply = "INSTREAM size limit exceeded"
+
+// Clamd проверяет файлы демоном ClamAV по протоколу INSTREAM.
+type Clamd struct {
+	Network string // tcp или unix
+	Address string
+	Timeout time.Duration // Таймаут подключения
+	MaxSize int64         // StreamMaxLength из clamd.conf, 0 - не ограничен
+}
+
+// NewClamd разбирает адрес вида tcp://host:3310, unix:///run/clamav/clamd.sock или host:3310.
+func NewClamd(addr string) *Clamd {
+	c := &Clamd{Network: "tcp", Address: addr, Timeout: 10 * time.Second, MaxSize: DefaultStreamMaxLength}
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		c.Network, c.Address = "unix", strings.TrimPrefix(addr, "unix://")
+	case strings.HasPrefix(addr, "tcp://"):
+		c.Address = strings.TrimPrefix(addr, "tcp://")
+	}
+	return c
+}
+
+// MaxStreamSize возвращает наибольший размер файла, который clamd примет на проверку.
+func (c *Clamd) MaxStreamSize() int64 {
+	return c.MaxSize
+}
+
+// Scan отправляет содержимое в clamd блоками: 4 байта длины и данные, нулевая длина завершает поток.
+// Сбои соединения и ошибки clamd возвращаются как ErrUnavailable, поток длиннее MaxSize - как ErrTooLarge.
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	dialer := net.Dialer{Timeout: c.Timeout}
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return Result{}, unavailable(err)
+	}
+	defer conn.Close()
+
+	// Отмена контекста прерывает зависшее чтение или запись
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	w := bufio.NewWriterSize(conn, clamdChunkSize+4)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return Result{}, unavailable(err)
+	}
+
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	var sent int64
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			// clamd всё равно оборвёт поток, не дочитав его: не тратим время на передачу
+			if sent += int64(n); c.MaxSize > 0 && sent > c.MaxSize {
+				return Result{}, fmt.Errorf("clamd: %w", ErrTooLarge)
+			}
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := w.Write(size); err != nil {
+				return Result{}, unavailable(err)
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return Result{}, unavailable(err)
+			}
+		}
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			return Result{}, readErr
+		}
+	}
+	if _, err := w.Write([]byte{0, 0, 0, 0}); err != nil {
+		return Result{}, unavailable(err)
+	}
+	if err := w.Flush(); err != nil {
+		return Result{}, unavailable(err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return Result{}, unavailable(err)
+	}
+	return parseClamdReply(reply)
+}
+
+// parseClamdReply разбирает ответ вида "stream: OK", "stream: <угроза> FOUND" или "<текст> ERROR".
+func parseClamdReply(reply string) (Result, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	body := strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case body == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(body, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(body, " FOUND")}, nil
+	case strings.HasPrefix(body, clamdSizeLimitReply):
+		return Result{}, fmt.Errorf("clamd: %w", ErrTooLarge)
+	default:
+		// Нехватка памяти, перезагрузка баз и т. п. - повторная проверка может пройти
+		return Result{}, fmt.Errorf("clamd: %w: %s", ErrUnavailable, reply)
+	}
+}
+
+func unavailable(err error) error {
+	return fmt.Errorf("clamd: %w: %w", ErrUnavailable, err)
+}
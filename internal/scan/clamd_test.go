@@ -0,0 +1,119 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseClamdReply(t *testing.T) {
+	tests := []struct {
+		reply   string
+		want    Result
+		wantErr error
+	}{
+		{reply: "stream: OK\x00", want: Result{}},
+		{reply: "stream: Eicar-Test-Signature FOUND\x00", want: Result{Infected: true, Signature: "Eicar-Test-Signature"}},
+		{reply: "INSTREAM size limit exceeded. ERROR\x00", wantErr: ErrTooLarge},
+		{reply: "Can't allocate memory ERROR\x00", wantErr: ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		got, err := parseClamdReply(tt.reply)
+		if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+			t.Fatalf("parseClamdReply(%q) error = %v, want %v", tt.reply, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Fatalf("parseClamdReply(%q) = %+v, want %+v", tt.reply, got, tt.want)
+		}
+	}
+}
+
+// fakeClamd принимает одно соединение INSTREAM, собирает поток и отвечает reply.
+func fakeClamd(t *testing.T, reply string) (*Clamd, <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+			return
+		}
+		var data []byte
+		size := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(r, size); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			if n == 0 {
+				break
+			}
+			chunk := make([]byte, n)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return
+			}
+			data = append(data, chunk...)
+		}
+		received <- data
+		conn.Write([]byte(reply + "\x00"))
+	}()
+
+	return NewClamd("tcp://" + ln.Addr().String()), received
+}
+
+func TestClamdScan(t *testing.T) {
+	c, received := fakeClamd(t, "stream: Eicar-Test-Signature FOUND")
+	content := strings.Repeat("a", clamdChunkSize+100) + EICAR
+
+	got, err := c.Scan(context.Background(), strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if !got.Infected || got.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("Scan = %+v, want infected with Eicar-Test-Signature", got)
+	}
+	if data := <-received; string(data) != content {
+		t.Fatalf("clamd received %d bytes, want %d", len(data), len(content))
+	}
+}
+
+func TestClamdScanTooLarge(t *testing.T) {
+	c, _ := fakeClamd(t, "stream: OK")
+	c.MaxSize = clamdChunkSize
+
+	_, err := c.Scan(context.Background(), strings.NewReader(strings.Repeat("a", clamdChunkSize+1)))
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("err = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestClamdScanUnavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	_, err = NewClamd(addr).Scan(context.Background(), strings.NewReader("data"))
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("err = %v, want ErrUnavailable", err)
+	}
+}
@@ -0,0 +1,136 @@
+// Package scan проверяет загруженные файлы антивирусом.
+package scan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/toxanetoxa/gohls/pkg/env"
+	"github.com/toxanetoxa/gohls/pkg/logger"
+)
+
+// Result - результат проверки файла.
+type Result struct {
+	Infected  bool
+	Signature string // Название найденной угрозы
+}
+
+// Scanner проверяет содержимое файла. Ошибка означает, что проверить файл не удалось.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// Ошибки проверки
+var (
+	// ErrUnavailable - сканер недоступен или временно не может проверить файл, проверку стоит повторить
+	ErrUnavailable = errors.New("scanner is unavailable")
+	// ErrTooLarge - файл больше, чем сканер принимает на проверку; повтор не поможет
+	ErrTooLarge = errors.New("file is too large to scan")
+)
+
+// DefaultStreamMaxLength - StreamMaxLength clamd по умолчанию (25 МБ).
+const DefaultStreamMaxLength = 25 << 20
+
+// MaxSize возвращает наибольший размер файла, который может проверить сканер. 0 - без ограничения.
+func MaxSize(s Scanner) int64 {
+	if l, ok := s.(interface{ MaxStreamSize() int64 }); ok {
+		return l.MaxStreamSize()
+	}
+	return 0
+}
+
+// Nop считает чистыми все файлы.
+type Nop struct{}
+
+func (Nop) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return Result{}, nil
+}
+
+// EICAR - стандартная тестовая строка антивирусов.
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// Fake находит в файле строку Marker (по умолчанию EICAR) и сообщает о заражении.
+type Fake struct {
+	Marker    string
+	Signature string
+}
+
+func (f Fake) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	marker := f.Marker
+	if marker == "" {
+		marker = EICAR
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+	if !bytes.Contains(data, []byte(marker)) {
+		return Result{}, nil
+	}
+
+	signature := f.Signature
+	if signature == "" {
+		signature = "Eicar-Test-Signature"
+	}
+	return Result{Infected: true, Signature: signature}, nil
+}
+
+// NewScannerFromEnv создаёт сканер по SCAN_BACKEND: none (по умолчанию) или clamd.
+// nil означает, что проверка выключена.
+func NewScannerFromEnv() Scanner {
+	switch backend := env.String("SCAN_BACKEND", "none"); backend {
+	case "none", "":
+		return nil
+	case "clamd":
+		c := NewClamd(env.String("CLAMD_ADDRESS", "tcp://clamav:3310"))
+		c.MaxSize = env.Int64("CLAMD_STREAM_MAX_LENGTH", DefaultStreamMaxLength)
+		return c
+	default:
+		logger.Logger.Warnw("Unknown scan backend, malware scanning is disabled", "backend", backend)
+		return nil
+	}
+}
+
+// ScanFileChunks проверяет файл частями по size байт, соседние части перекрываются на overlap байт.
+// Так сканер с ограничением на размер потока проверяет и файлы больше него; сигнатура длиннее overlap
+// на стыке частей может быть пропущена.
+func ScanFileChunks(ctx context.Context, s Scanner, filePath string, size, overlap int64) (Result, error) {
+	if size <= 0 {
+		return ScanFile(ctx, s, filePath)
+	}
+	overlap = min(overlap, size/2)
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return Result{}, err
+	}
+
+	for off := int64(0); ; off += size - overlap {
+		result, err := s.Scan(ctx, io.NewSectionReader(f, off, size))
+		if err != nil || result.Infected {
+			return result, err
+		}
+		if off+size >= info.Size() {
+			return Result{}, nil
+		}
+	}
+}
+
+// ScanFile проверяет файл на диске.
+func ScanFile(ctx context.Context, s Scanner, filePath string) (Result, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+	return s.Scan(ctx, f)
+}
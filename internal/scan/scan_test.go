@@ -0,0 +1,154 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestFakeScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		scanner Fake
+		content string
+		want    Result
+	}{
+		{
+			name:    "clean",
+			content: "ordinary video bytes",
+			want:    Result{},
+		},
+		{
+			name:    "eicar",
+			content: "header " + EICAR + " trailer",
+			want:    Result{Infected: true, Signature: "Eicar-Test-Signature"},
+		},
+		{
+			name:    "custom marker and signature",
+			scanner: Fake{Marker: "BAD", Signature: "Test.Bad"},
+			content: "xxBADxx",
+			want:    Result{Infected: true, Signature: "Test.Bad"},
+		},
+		{
+			name:    "custom marker ignores eicar",
+			scanner: Fake{Marker: "BAD"},
+			content: EICAR,
+			want:    Result{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.scanner.Scan(context.Background(), strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Scan = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFakeScanReadError(t *testing.T) {
+	readErr := errors.New("disk failure")
+	if _, err := (Fake{}).Scan(context.Background(), iotest.ErrReader(readErr)); !errors.Is(err, readErr) {
+		t.Fatalf("err = %v, want %v", err, readErr)
+	}
+}
+
+func TestScanFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, []byte(EICAR), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ScanFile(context.Background(), Fake{}, path)
+	if err != nil {
+		t.Fatalf("ScanFile: %v", err)
+	}
+	if !got.Infected {
+		t.Fatal("ScanFile did not report the infected file")
+	}
+
+	if _, err := ScanFile(context.Background(), Fake{}, path+".missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("err = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	if got := MaxSize(Fake{}); got != 0 {
+		t.Fatalf("MaxSize(Fake) = %d, want 0", got)
+	}
+	if got := MaxSize(&Clamd{MaxSize: 1 << 20}); got != 1<<20 {
+		t.Fatalf("MaxSize(Clamd) = %d, want %d", got, 1<<20)
+	}
+}
+
+// limitedScanner - Fake с ограничением на размер потока, как у clamd.
+type limitedScanner struct {
+	Fake
+	limit int64
+	calls int
+}
+
+func (s *limitedScanner) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	s.calls++
+	data, err := io.ReadAll(io.LimitReader(r, s.limit+1))
+	if err != nil {
+		return Result{}, err
+	}
+	if int64(len(data)) > s.limit {
+		return Result{}, ErrTooLarge
+	}
+	return s.Fake.Scan(ctx, bytes.NewReader(data))
+}
+
+func TestScanFileChunks(t *testing.T) {
+	const limit = 1000
+
+	tests := []struct {
+		name     string
+		content  string
+		infected bool
+		calls    int
+	}{
+		{name: "fits in one chunk", content: strings.Repeat("a", limit), calls: 1},
+		{name: "clean large file", content: strings.Repeat("a", 2500), calls: 3},
+		{name: "marker in the last chunk", content: strings.Repeat("a", 2400) + EICAR, infected: true, calls: 3},
+		// Маркер лежит на стыке первой и второй частей и целиком попадает во вторую благодаря перекрытию
+		{name: "marker across chunk boundary", content: strings.Repeat("a", limit-20) + EICAR + strings.Repeat("a", 1000), infected: true, calls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "recording.mp4")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			s := &limitedScanner{limit: limit}
+			if _, err := ScanFile(context.Background(), s, path); len(tt.content) > limit && !errors.Is(err, ErrTooLarge) {
+				t.Fatalf("ScanFile err = %v, want ErrTooLarge", err)
+			}
+
+			s.calls = 0
+			got, err := ScanFileChunks(context.Background(), s, path, limit, 200)
+			if err != nil {
+				t.Fatalf("ScanFileChunks: %v", err)
+			}
+			if got.Infected != tt.infected {
+				t.Fatalf("Infected = %v, want %v", got.Infected, tt.infected)
+			}
+			if s.calls != tt.calls {
+				t.Fatalf("scanned %d chunks, want %d", s.calls, tt.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toxanetoxa/gohls/pkg/env"
+)
+
+// Алгоритмы подписи
+const (
+	// AlgorithmMD5 совместим с модулем nginx secure_link:
+	// secure_link_md5 "$secure_link_expires<prefix>$remote_addr <secret>"
+	AlgorithmMD5 = "md5"
+	// AlgorithmHMAC - HMAC-SHA256, проверяется только приложением
+	AlgorithmHMAC = "hmac"
+)
+
+var (
+	ErrMissing = errors.New("signature is missing")
+	ErrExpired = errors.New("signature is expired")
+	ErrInvalid = errors.New("signature is invalid")
+)
+
+// Signer подписывает и проверяет ссылки вида <path>?md5=<token>&expires=<unix>.
+// Подпись покрывает префикс пути, поэтому одна подпись годится для всех сегментов плейлиста.
+type Signer struct {
+	Secret    string
+	TTL       time.Duration
+	BindIP    bool // Привязывать подпись к IP-адресу клиента
+	Algorithm string
+}
+
+// NewSignerFromEnv создаёт Signer по переменным окружения.
+// Возвращает nil, если SIGNED_URL_SECRET не задан - подпись ссылок выключена.
+func NewSignerFromEnv() *Signer {
+	secret := env.String("SIGNED_URL_SECRET", "")
+	if secret == "" {
+		return nil
+	}
+
+	return &Signer{
+		Secret:    secret,
+		TTL:       env.Duration("SIGNED_URL_TTL", 6*time.Hour),
+		BindIP:    env.Bool("SIGNED_URL_BIND_IP", false),
+		Algorithm: env.String("SIGNED_URL_ALGORITHM", AlgorithmMD5),
+	}
+}
+
+// Sign возвращает параметры запроса с подписью для префикса prefix.
+func (s *Signer) Sign(prefix, clientIP string) url.Values {
+	expires := strconv.FormatInt(time.Now().Add(s.TTL).Unix(), 10)
+	return url.Values{
+		"md5":     {s.token(expires, prefix, clientIP)},
+		"expires": {expires},
+	}
+}
+
+// SignURL дописывает подпись к ссылке. prefix должен быть префиксом пути ссылки.
+func (s *Signer) SignURL(rawURL, prefix, clientIP string) string {
+	return rawURL + "?" + s.Sign(prefix, clientIP).Encode()
+}
+
+// Verify проверяет подпись префикса.
+func (s *Signer) Verify(prefix, clientIP, token, expires string) error {
+	if token == "" || expires == "" {
+		return ErrMissing
+	}
+
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalid
+	}
+
+	if !hmac.Equal([]byte(token), []byte(s.token(expires, prefix, clientIP))) {
+		return ErrInvalid
+	}
+	if time.Now().Unix() > exp {
+		return ErrExpired
+	}
+	return nil
+}
+
+func (s *Signer) token(expires, prefix, clientIP string) string {
+	if !s.BindIP {
+		clientIP = ""
+	}
+
+	var sum []byte
+	if s.Algorithm == AlgorithmHMAC {
+		mac := hmac.New(sha256.New, []byte(s.Secret))
+		mac.Write([]byte(expires + prefix + clientIP))
+		sum = mac.Sum(nil)
+	} else {
+		digest := md5.Sum([]byte(expires + prefix + clientIP + " " + s.Secret))
+		sum = digest[:]
+	}
+
+	return base64.RawURLEncoding.EncodeToString(sum)
+}
+
+// Middleware проверяет подпись запроса. prefix возвращает подписываемый префикс пути
+// для текущего запроса; пустая строка означает, что запрос проверять не нужно.
+// При выключенной подписи (nil) пропускает все запросы.
+func Middleware(s *Signer, prefix func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s == nil {
+			c.Next()
+			return
+		}
+
+		p := prefix(c)
+		if p == "" {
+			c.Next()
+			return
+		}
+
+		err := s.Verify(p, c.ClientIP(), c.Query("md5"), c.Query("expires"))
+		switch {
+		case err == nil:
+			c.Next()
+		case errors.Is(err, ErrExpired):
+			// Как в nginx secure_link: истёкшая ссылка - 410
+			c.JSON(http.StatusGone, gin.H{"error": "Link has expired"})
+			c.Abort()
+		default:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or missing link signature"})
+			c.Abort()
+		}
+	}
+}
+
+// RequestPath - префикс, равный пути запроса (для ссылок на один файл).
+func RequestPath(c *gin.Context) string {
+	return c.Request.URL.Path
+}
@@ -0,0 +1,59 @@
+package signedurl
+
+import (
+	"errors"
+	"testing"
+)
+
+// Токены посчитаны независимо, как их считает nginx secure_link:
+// echo -n '<expires><prefix><ip> <secret>' | openssl md5 -binary | base64 | tr '+/' '-_' | tr -d '='
+func TestMD5TokenMatchesNginxSecureLink(t *testing.T) {
+	const (
+		expires = "2147483647"
+		prefix  = "/videos/1/hls/"
+		ip      = "203.0.113.7"
+	)
+
+	tests := []struct {
+		name   string
+		bindIP bool
+		want   string
+	}{
+		{name: "without ip", want: "fsr2t5CP77Fhs5-SXCGPAA"},
+		{name: "bound to ip", bindIP: true, want: "co2ZMLijazseKofSdX82-g"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Signer{Secret: "secret", BindIP: tt.bindIP, Algorithm: AlgorithmMD5}
+			if got := s.token(expires, prefix, ip); got != tt.want {
+				t.Fatalf("token = %q, want %q", got, tt.want)
+			}
+			if err := s.Verify(prefix, ip, tt.want, expires); err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	s := &Signer{Secret: "secret", Algorithm: AlgorithmMD5}
+	const prefix = "/videos/1/hls/"
+
+	if err := s.Verify(prefix, "", "", ""); !errors.Is(err, ErrMissing) {
+		t.Fatalf("missing signature: err = %v, want ErrMissing", err)
+	}
+	if err := s.Verify("/videos/2/hls/", "", "fsr2t5CP77Fhs5-SXCGPAA", "2147483647"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("other prefix: err = %v, want ErrInvalid", err)
+	}
+
+	expired := s.token("1", prefix, "")
+	if err := s.Verify(prefix, "", expired, "1"); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expired signature: err = %v, want ErrExpired", err)
+	}
+
+	hmacSigner := &Signer{Secret: "secret", Algorithm: AlgorithmHMAC}
+	if err := hmacSigner.Verify(prefix, "", "fsr2t5CP77Fhs5-SXCGPAA", "2147483647"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("md5 token accepted by hmac signer: err = %v", err)
+	}
+}
@@ -5,11 +5,27 @@ import (
 	"gorm.io/gorm"
 )
 
+// Роли пользователей: от роли зависят квоты, администратор может менять квоты и роли других,
+// модератор разбирает жалобы на видео и комментарии
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 type User struct {
 	gorm.Model
 	Username string `gorm:"unique;not null"`
 	Password string `gorm:"not null"`
 	Email    string `gorm:"unique;not null"`
+	Role     string `gorm:"not null;default:user"`
+	// Число подписчиков канала пользователя, меняется вместе с subscriptions
+	SubscriberCount int64 `gorm:"not null;default:0"`
+}
+
+// IsModerator проверяет, может ли пользователь разбирать жалобы: это модераторы и администраторы.
+func (u *User) IsModerator() bool {
+	return u.Role == RoleModerator || u.Role == RoleAdmin
 }
 
 // HashPassword хеширует пароль пользователя.
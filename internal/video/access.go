@@ -0,0 +1,335 @@
+package video
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toxanetoxa/gohls/internal/user"
+	"gorm.io/gorm"
+)
+
+// Видимость видео
+const (
+	VisibilityPublic   = "public"   // Доступно всем и попадает в списки
+	VisibilityUnlisted = "unlisted" // Доступно по ссылке
+	VisibilityPrivate  = "private"  // Доступно только автору
+)
+
+var visibilities = map[string]bool{
+	VisibilityPublic:   true,
+	VisibilityUnlisted: true,
+	VisibilityPrivate:  true,
+}
+
+// Entitlement - право пользователя смотреть платное видео.
+type Entitlement struct {
+	ID        uint `gorm:"primaryKey"`
+	VideoID   uint `gorm:"not null"`
+	UserID    uint `gorm:"not null"`
+	ExpiresAt *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (Entitlement) TableName() string {
+	return "video_entitlements"
+}
+
+// cacheControl возвращает Cache-Control для файлов видео. Общим кэшам разрешено хранить только файлы
+// публичных бесплатных видео без ограничений: остальные отдаются после проверки прав конкретного зрителя.
+func cacheControl(v *Video, maxAge time.Duration, extra string) string {
+	scope := "private"
+	if v.Visibility == VisibilityPublic && !v.IsPaid && !v.AgeRestricted && v.ModerationStatus == ModerationNone {
+		scope = "public"
+	}
+	value := fmt.Sprintf("%s, max-age=%d", scope, int(maxAge.Seconds()))
+	if extra != "" {
+		value += ", " + extra
+	}
+	return value
+}
+
+// canWatch проверяет видимость видео и права зрителя. u может быть nil для анонимного зрителя.
+func (h *Handler) canWatch(v *Video, u *user.User) (bool, error) {
+	if u != nil && u.ID == v.AuthorID {
+		return true, nil
+	}
+
+	if v.Visibility == VisibilityPrivate {
+		return false, nil
+	}
+	// Возраст пользователя неизвестен: ограничение по возрасту сводится к требованию войти
+	if v.AgeRestricted && u == nil {
+		return false, nil
+	}
+
+	if !v.IsPaid {
+		return true, nil
+	}
+	if u == nil {
+		return false, nil
+	}
+
+	var count int64
+	err := h.DB.Model(&Entitlement{}).
+		Where("video_id = ? AND user_id = ? AND (expires_at IS NULL OR expires_at > ?)", v.ID, u.ID, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// requireAccess отвечает клиенту, если зритель не может смотреть видео
+// или файл видео нельзя отдавать (отклонён, снят модерацией или ещё проверяется антивирусом).
+func (h *Handler) requireAccess(c *gin.Context, v *Video) bool {
+	return h.requireViewer(c, v) && requireServable(c, v)
+}
+
+// requireServable не даёт отдавать файлы отклонённых, снятых модерацией и ещё не проверенных видео,
+// в том числе автору.
+func requireServable(c *gin.Context, v *Video) bool {
+	switch {
+	case v.ModerationStatus == ModerationTakenDown:
+		c.JSON(http.StatusUnavailableForLegalReasons, gin.H{"error": "Video was taken down", "reason": v.ModerationReason})
+		return false
+	case v.Status == StatusRejected:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Video was rejected", "reason": v.RejectionReason})
+		return false
+	case v.ScanStatus == ScanPending:
+		c.JSON(http.StatusConflict, gin.H{"error": "Video is being scanned"})
+		return false
+	case v.ScanStatus == ScanFailed:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Video could not be scanned for malware"})
+		return false
+	}
+	return true
+}
+
+// requireViewer проверяет только права зрителя на видео.
+// Приватные видео для посторонних выглядят несуществующими.
+func (h *Handler) requireViewer(c *gin.Context, v *Video) bool {
+	u, _ := h.currentUser(c)
+
+	allowed, err := h.canWatch(v, u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access", "details": err.Error()})
+		return false
+	}
+	if allowed {
+		return true
+	}
+
+	if v.Visibility == VisibilityPrivate {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Video not found"})
+		return false
+	}
+	if u == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication is required to watch this video"})
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "You have no access to this video"})
+	return false
+}
+
+type UpdateVideoRequest struct {
+	Title            *string   `json:"title"`
+	Description      *string   `json:"description"`
+	Language         *string   `json:"language"` // ru или en; пустая строка - определить по тексту
+	Tags             *[]string `json:"tags"`     // Заменяет все теги видео
+	Category         *string   `json:"category"` // Slug раздела; пустая строка - убрать из раздела
+	Visibility       *string   `json:"visibility"`
+	IsPaid           *bool     `json:"is_paid"`
+	CommentsDisabled *bool     `json:"comments_disabled"`
+}
+
+// UpdateVideo изменяет метаданные видео (название, описание, язык, теги, раздел, видимость, платность, комментарии).
+func (h *Handler) UpdateVideo(c *gin.Context) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireOwner(c, v) {
+		return
+	}
+
+	var req UpdateVideoRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Title != nil {
+		if *req.Title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Title must not be empty"})
+			return
+		}
+		updates["title"] = *req.Title
+	}
+	if req.Description != nil {
+		if len([]rune(*req.Description)) > maxDescriptionLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Description must not exceed %d characters", maxDescriptionLength)})
+			return
+		}
+		updates["description"] = *req.Description
+	}
+	if req.Language != nil {
+		title, description := v.Title, v.Description
+		if req.Title != nil {
+			title = *req.Title
+		}
+		if req.Description != nil {
+			description = *req.Description
+		}
+		language, err := normalizeLanguage(*req.Language, title, description)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["language"] = language
+	}
+	if req.Visibility != nil {
+		if !visibilities[*req.Visibility] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Visibility must be public, unlisted or private"})
+			return
+		}
+		updates["visibility"] = *req.Visibility
+	}
+	if req.IsPaid != nil {
+		updates["is_paid"] = *req.IsPaid
+	}
+	if req.CommentsDisabled != nil {
+		updates["comments_disabled"] = *req.CommentsDisabled
+	}
+	if req.Category != nil {
+		if *req.Category == "" {
+			updates["category_id"] = nil
+		} else {
+			cat, err := categoryBySlug(h.DB, *req.Category)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category", "details": err.Error()})
+				return
+			}
+			if cat == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
+				return
+			}
+			updates["category_id"] = cat.ID
+		}
+	}
+	var tags []string
+	if req.Tags != nil {
+		var err error
+		if tags, err = normalizeTags(*req.Tags); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(v).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if req.Tags != nil {
+			return setVideoTags(tx, v.ID, tags)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update video", "details": err.Error()})
+		return
+	}
+
+	// Видео, впервые открытое для всех, анонсируется подписчикам
+	if req.Visibility != nil && *req.Visibility == VisibilityPublic {
+		h.Notifier.VideoPublished(v)
+	}
+
+	// Название, описание, язык и теги входят в поисковый вектор
+	if req.Title != nil || req.Description != nil || req.Language != nil || req.Tags != nil {
+		if err := UpdateSearchVector(h.DB, v.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to index video", "details": err.Error()})
+			return
+		}
+	}
+
+	tagNames, err := videoTagNames(h.DB, v.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"video_id":          v.ID,
+		"title":             v.Title,
+		"description":       v.Description,
+		"language":          v.Language,
+		"tags":              tagNames,
+		"category_id":       v.CategoryID,
+		"visibility":        v.Visibility,
+		"is_paid":           v.IsPaid,
+		"comments_disabled": v.CommentsDisabled,
+	})
+}
+
+type GrantEntitlementRequest struct {
+	Username  string `json:"username" binding:"required"`
+	ExpiresIn int    `json:"expires_in_days"` // 0 - бессрочно
+}
+
+// GrantEntitlement выдаёт пользователю доступ к платному видео.
+func (h *Handler) GrantEntitlement(c *gin.Context) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireOwner(c, v) {
+		return
+	}
+
+	var req GrantEntitlementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var u user.User
+	if err := h.DB.Where("username = ?", req.Username).First(&u).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user", "details": err.Error()})
+		return
+	}
+
+	entitlement := Entitlement{VideoID: v.ID, UserID: u.ID}
+	if req.ExpiresIn > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresIn)
+		entitlement.ExpiresAt = &expiresAt
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("video_id = ? AND user_id = ?", v.ID, u.ID).Delete(&Entitlement{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&entitlement).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant access", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Access granted", "user_id": u.ID, "expires_at": entitlement.ExpiresAt})
+}
+
+// RevokeEntitlement отзывает доступ пользователя к платному видео.
+func (h *Handler) RevokeEntitlement(c *gin.Context) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireOwner(c, v) {
+		return
+	}
+
+	if err := h.DB.Where("video_id = ? AND user_id = ?", v.ID, c.Param("userID")).Delete(&Entitlement{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access revoked"})
+}
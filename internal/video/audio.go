@@ -0,0 +1,160 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+// Папка с извлечёнными аудиофайлами внутри MediaDir
+const audioDir = "audio"
+
+// ErrAudioBusy - все слоты извлечения заняты, запрос стоит повторить позже.
+var ErrAudioBusy = errors.New("too many audio extractions in progress")
+
+// Символы, недопустимые в имени файла из Content-Disposition
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9-]`)
+
+// AudioExtractor извлекает аудиодорожки по запросу: одна дорожка извлекается
+// одним ffmpeg, сколько бы зрителей её ни ждали, а число одновременных запусков ограничено.
+type AudioExtractor struct {
+	group singleflight.Group
+	slots chan struct{}
+}
+
+// NewAudioExtractor создаёт AudioExtractor, допускающий concurrency одновременных запусков ffmpeg.
+func NewAudioExtractor(concurrency int) *AudioExtractor {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &AudioExtractor{slots: make(chan struct{}, concurrency)}
+}
+
+// Extract вызывает run для файла dst, если его ещё никто не извлекает, иначе ждёт
+// уже идущее извлечение. Извлечение не зависит от ctx: отменённый запрос не обрывает
+// работу для остальных ожидающих. Если свободных слотов нет, возвращается ErrAudioBusy.
+func (e *AudioExtractor) Extract(ctx context.Context, dst string, run func(ctx context.Context) error) error {
+	result := e.group.DoChan(dst, func() (interface{}, error) {
+		select {
+		case e.slots <- struct{}{}:
+		default:
+			return nil, ErrAudioBusy
+		}
+		defer func() { <-e.slots }()
+
+		// Пока ждали слот, файл мог появиться
+		if _, err := os.Stat(dst); err == nil {
+			return nil, nil
+		}
+
+		runCtx, cancel := context.WithTimeout(context.Background(), audioExtractTimeout)
+		defer cancel()
+		return nil, run(runCtx)
+	})
+
+	select {
+	case r := <-result:
+		return r.Err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DownloadAudio отдаёт аудиодорожку видео отдельным файлом M4A.
+// Номер дорожки задаётся параметром track, по умолчанию - основная дорожка.
+// Файл извлекается при первом запросе и дальше отдаётся с диска. Пока дорожка
+// извлекается, остальные запросы к ней ждут того же ffmpeg.
+func (h *Handler) DownloadAudio(c *gin.Context) {
+	v, ok := h.loadWatchableVideo(c)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Where("video_id = ? AND type = ?", v.ID, RenditionAudio)
+	if track := c.Query("track"); track != "" {
+		index, err := strconv.Atoi(track)
+		if err != nil || index < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid track"})
+			return
+		}
+		query = query.Where("stream_index = ?", index)
+	} else {
+		query = query.Order("is_default DESC, stream_index")
+	}
+
+	var rendition Rendition
+	if err := query.First(&rendition).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Audio track not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audio track", "details": err.Error()})
+		return
+	}
+
+	filePath := v.MediaPath(path.Join(audioDir, fmt.Sprintf("track_%d.m4a", rendition.StreamIndex)))
+	if _, err := os.Stat(filePath); err != nil {
+		err := h.Audio.Extract(c.Request.Context(), filePath, func(ctx context.Context) error {
+			return h.extractAudio(ctx, v, rendition.StreamIndex, filePath)
+		})
+		if errors.Is(err, ErrAudioBusy) {
+			c.Header("Retry-After", "30")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Audio extraction is busy, try again later"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to extract audio", "details": err.Error()})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "audio/mp4")
+	// Язык приходит из тегов исходника, в заголовок попадают только безопасные символы
+	language := unsafeFilenameChars.ReplaceAllString(rendition.Language, "")
+	if language == "" {
+		language = "und"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="video_%d_%s.m4a"`, v.ID, language))
+	c.File(filePath)
+}
+
+// extractAudio извлекает аудиодорожку в M4A. Запись идёт во временный файл,
+// чтобы параллельные запросы не получили недописанный результат.
+func (h *Handler) extractAudio(ctx context.Context, v *Video, index int, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "extract_*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpName)
+
+	if err := h.FFmpeg.Run(ctx,
+		"-i", v.FilePath,
+		"-map", fmt.Sprintf("0:a:%d", index),
+		"-vn",
+		"-c:a", "aac",
+		"-b:a", "192k",
+		"-movflags", "+faststart",
+		"-f", "mp4",
+		tmpName,
+	); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpName, dst)
+}
@@ -0,0 +1,500 @@
+package video
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Ограничения на теги видео
+const (
+	maxTagsPerVideo = 20
+	maxTagLength    = 32
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Tag - тег видео. Имя хранится нормализованным: в нижнем регистре, без #.
+type Tag struct {
+	ID        uint      `gorm:"primaryKey"`
+	Name      string    `gorm:"unique;not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// VideoTag - связь видео с тегом.
+type VideoTag struct {
+	VideoID uint `gorm:"primaryKey;autoIncrement:false"`
+	TagID   uint `gorm:"primaryKey;autoIncrement:false"`
+}
+
+func (VideoTag) TableName() string {
+	return "video_tags"
+}
+
+// Category - раздел каталога. Разделы образуют дерево и редактируются администраторами.
+type Category struct {
+	ID        uint      `gorm:"primaryKey"`
+	ParentID  *uint     // nil - раздел верхнего уровня
+	Slug      string    `gorm:"unique;not null"`
+	Name      string    `gorm:"not null"`
+	Position  int       `gorm:"not null;default:0"` // Порядок среди соседних разделов
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+// normalizeTags приводит теги к единому виду, убирает повторы и проверяет ограничения.
+func normalizeTags(raw []string) ([]string, error) {
+	seen := map[string]bool{}
+	var tags []string
+	for _, item := range raw {
+		tag := strings.ToLower(strings.Join(strings.Fields(strings.TrimLeft(strings.TrimSpace(item), "#")), " "))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len([]rune(tag)) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxTagLength)
+		}
+		for _, r := range tag {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && r != '-' && r != '_' {
+				return nil, fmt.Errorf("tag %q may contain only letters, digits, spaces, - and _", tag)
+			}
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTagsPerVideo {
+		return nil, fmt.Errorf("a video can have at most %d tags", maxTagsPerVideo)
+	}
+	return tags, nil
+}
+
+// splitTags разбирает теги из поля формы: через запятую.
+func splitTags(value string) []string {
+	return strings.Split(value, ",")
+}
+
+// setVideoTags заменяет теги видео. Недостающие теги создаются.
+func setVideoTags(tx *gorm.DB, videoID uint, names []string) error {
+	if err := tx.Where("video_id = ?", videoID).Delete(&VideoTag{}).Error; err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	tags := make([]Tag, 0, len(names))
+	for _, name := range names {
+		tags = append(tags, Tag{Name: name})
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+		return err
+	}
+
+	// При конфликте ID не возвращается, поэтому перечитываем теги по именам
+	if err := tx.Where("name IN ?", names).Find(&tags).Error; err != nil {
+		return err
+	}
+	links := make([]VideoTag, 0, len(tags))
+	for _, t := range tags {
+		links = append(links, VideoTag{VideoID: videoID, TagID: t.ID})
+	}
+	return tx.Create(&links).Error
+}
+
+// videoTagNames возвращает теги видео по алфавиту.
+func videoTagNames(db *gorm.DB, videoID uint) ([]string, error) {
+	names := []string{}
+	err := db.Table("tags t").
+		Joins("JOIN video_tags vt ON vt.tag_id = t.id").
+		Where("vt.video_id = ?", videoID).
+		Order("t.name").
+		Pluck("t.name", &names).Error
+	return names, err
+}
+
+// categoryBySlug ищет раздел. nil без ошибки - раздела нет.
+func categoryBySlug(db *gorm.DB, slug string) (*Category, error) {
+	var cat Category
+	err := db.Where("slug = ?", slug).First(&cat).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cat, nil
+}
+
+// Сортировки списков каталога
+var catalogOrders = map[string]string{
+	"new":      "v.created_at DESC, v.id DESC",
+	"popular":  "views DESC, v.id DESC",
+	"trending": "recent_views DESC, views DESC, v.id DESC",
+}
+
+// Колонки catalogRow для выборки из videos v
+const catalogColumns = `v.id, v.title, v.description, v.author_id, v.duration, v.thumbnail_key, v.is_paid, v.created_at,
+	(SELECT COUNT(*) FROM video_views vv WHERE vv.video_id = v.id) AS views`
+
+// catalogRow - видео в списке каталога.
+type catalogRow struct {
+	ID           uint
+	Title        string
+	Description  string
+	AuthorID     uint
+	Duration     float64
+	ThumbnailKey string
+	IsPaid       bool
+	CreatedAt    time.Time
+	Views        int64
+}
+
+func (r *catalogRow) response() gin.H {
+	thumbnailURL := ""
+	if r.ThumbnailKey != "" {
+		thumbnailURL = fmt.Sprintf("/videos/%d/thumbnail", r.ID)
+	}
+	return gin.H{
+		"video_id":      r.ID,
+		"title":         r.Title,
+		"description":   r.Description,
+		"author_id":     r.AuthorID,
+		"duration":      r.Duration,
+		"thumbnail_url": thumbnailURL,
+		"is_paid":       r.IsPaid,
+		"views":         r.Views,
+		"created_at":    r.CreatedAt,
+	}
+}
+
+// publicVideosByID загружает публичные готовые видео в порядке ids.
+// На месте видео, ставших непубличными или недоступными, в результате nil.
+func (h *Handler) publicVideosByID(ids []uint) ([]*catalogRow, error) {
+	result := make([]*catalogRow, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	var rows []catalogRow
+	err := h.DB.Table("videos v").
+		Select(catalogColumns).
+		Where("v.id IN ? AND v.visibility = ? AND v.status = ? AND v.moderation_status = ''", ids, VisibilityPublic, StatusReady).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]*catalogRow, len(rows))
+	for i := range rows {
+		byID[rows[i].ID] = &rows[i]
+	}
+	for i, id := range ids {
+		result[i] = byID[id]
+	}
+	return result, nil
+}
+
+// listCatalog отдаёт страницу публичных готовых видео, отобранных filter, в порядке из параметра sort.
+func (h *Handler) listCatalog(c *gin.Context, filter func(*gorm.DB) *gorm.DB, extra gin.H) {
+	sort := c.DefaultQuery("sort", "new")
+	order, ok := catalogOrders[sort]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be new, popular or trending"})
+		return
+	}
+
+	page, perPage, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	base := func() *gorm.DB {
+		q := h.DB.Table("videos v").Where("v.visibility = ? AND v.status = ? AND v.moderation_status = ''", VisibilityPublic, StatusReady)
+		return filter(q)
+	}
+
+	var total int64
+	if err := base().Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count videos", "details": err.Error()})
+		return
+	}
+
+	var rows []catalogRow
+	err := base().
+		Select(catalogColumns+`,
+			(SELECT COUNT(*) FROM video_views vv WHERE vv.video_id = v.id AND vv.created_at > ?) AS recent_views`,
+			time.Now().Add(-catalogTrendingWindow)).
+		Order(order).
+		Limit(perPage).
+		Offset((page - 1) * perPage).
+		Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch videos", "details": err.Error()})
+		return
+	}
+
+	videos := make([]gin.H, 0, len(rows))
+	for i := range rows {
+		videos = append(videos, rows[i].response())
+	}
+
+	resp := gin.H{
+		"sort":     sort,
+		"page":     page,
+		"per_page": perPage,
+		"total":    total,
+		"videos":   videos,
+	}
+	for k, v := range extra {
+		resp[k] = v
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListCategoryVideos отдаёт видео раздела вместе с видео всех его подразделов.
+func (h *Handler) ListCategoryVideos(c *gin.Context) {
+	cat, err := categoryBySlug(h.DB, c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category", "details": err.Error()})
+		return
+	}
+	if cat == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	h.listCatalog(c, func(q *gorm.DB) *gorm.DB {
+		return q.Where(`v.category_id IN (
+			WITH RECURSIVE sub AS (
+				SELECT id FROM categories WHERE id = ?
+				UNION ALL
+				SELECT c.id FROM categories c JOIN sub ON c.parent_id = sub.id
+			)
+			SELECT id FROM sub)`, cat.ID)
+	}, gin.H{"category": newCategoryResponse(cat)})
+}
+
+// ListTagVideos отдаёт видео с тегом.
+func (h *Handler) ListTagVideos(c *gin.Context) {
+	tags, err := normalizeTags([]string{c.Param("tag")})
+	if err != nil || len(tags) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag"})
+		return
+	}
+
+	h.listCatalog(c, func(q *gorm.DB) *gorm.DB {
+		return q.Where(`EXISTS (
+			SELECT 1 FROM video_tags vt JOIN tags t ON t.id = vt.tag_id
+			WHERE vt.video_id = v.id AND t.name = ?)`, tags[0])
+	}, gin.H{"tag": tags[0]})
+}
+
+type categoryResponse struct {
+	ID       uint                `json:"id"`
+	ParentID *uint               `json:"parent_id"`
+	Slug     string              `json:"slug"`
+	Name     string              `json:"name"`
+	Position int                 `json:"position"`
+	Children []*categoryResponse `json:"children,omitempty"`
+}
+
+func newCategoryResponse(cat *Category) *categoryResponse {
+	return &categoryResponse{
+		ID:       cat.ID,
+		ParentID: cat.ParentID,
+		Slug:     cat.Slug,
+		Name:     cat.Name,
+		Position: cat.Position,
+	}
+}
+
+// ListCategories отдаёт дерево разделов.
+func (h *Handler) ListCategories(c *gin.Context) {
+	var cats []Category
+	if err := h.DB.Order("position, name").Find(&cats).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories", "details": err.Error()})
+		return
+	}
+
+	nodes := make(map[uint]*categoryResponse, len(cats))
+	for i := range cats {
+		nodes[cats[i].ID] = newCategoryResponse(&cats[i])
+	}
+
+	roots := []*categoryResponse{}
+	for i := range cats {
+		node := nodes[cats[i].ID]
+		if parent, ok := nodes[derefUint(cats[i].ParentID)]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": roots})
+}
+
+func derefUint(p *uint) uint {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+type CategoryRequest struct {
+	Slug     *string `json:"slug"`
+	Name     *string `json:"name"`
+	ParentID *uint   `json:"parent_id"` // 0 - перенести на верхний уровень
+	Position *int    `json:"position"`
+}
+
+// applyCategoryRequest проверяет запрос и переносит поля в раздел.
+func (h *Handler) applyCategoryRequest(cat *Category, req *CategoryRequest) error {
+	if req.Slug != nil {
+		if !slugPattern.MatchString(*req.Slug) {
+			return errors.New("slug may contain only lowercase latin letters, digits and single dashes")
+		}
+		cat.Slug = *req.Slug
+	}
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			return errors.New("name must not be empty")
+		}
+		cat.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Position != nil {
+		cat.Position = *req.Position
+	}
+	if req.ParentID == nil {
+		return nil
+	}
+	if *req.ParentID == 0 {
+		cat.ParentID = nil
+		return nil
+	}
+
+	// Новый родитель должен существовать и не быть самим разделом или его потомком
+	parentID := *req.ParentID
+	for id := parentID; id != 0; {
+		if cat.ID != 0 && id == cat.ID {
+			return errors.New("category cannot be moved into itself")
+		}
+		var parent Category
+		if err := h.DB.First(&parent, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("parent category not found")
+			}
+			return err
+		}
+		id = derefUint(parent.ParentID)
+	}
+	cat.ParentID = &parentID
+	return nil
+}
+
+// CreateCategory создаёт раздел каталога.
+func (h *Handler) CreateCategory(c *gin.Context) {
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Slug == nil || req.Name == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slug and name are required"})
+		return
+	}
+
+	var cat Category
+	if err := h.applyCategoryRequest(&cat, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if existing, err := categoryBySlug(h.DB, cat.Slug); err != nil || existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Category with this slug already exists"})
+		return
+	}
+
+	if err := h.DB.Create(&cat).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, newCategoryResponse(&cat))
+}
+
+// loadCategory ищет раздел по параметру id и при ошибке сам отвечает клиенту.
+func (h *Handler) loadCategory(c *gin.Context) (*Category, bool) {
+	var cat Category
+	if err := h.DB.First(&cat, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category", "details": err.Error()})
+		return nil, false
+	}
+	return &cat, true
+}
+
+// UpdateCategory переименовывает или переносит раздел.
+func (h *Handler) UpdateCategory(c *gin.Context) {
+	cat, ok := h.loadCategory(c)
+	if !ok {
+		return
+	}
+
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	oldSlug := cat.Slug
+	if err := h.applyCategoryRequest(cat, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if cat.Slug != oldSlug {
+		if existing, err := categoryBySlug(h.DB, cat.Slug); err != nil || existing != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Category with this slug already exists"})
+			return
+		}
+	}
+
+	if err := h.DB.Select("slug", "name", "parent_id", "position").Save(cat).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newCategoryResponse(cat))
+}
+
+// DeleteCategory удаляет пустой раздел. Видео раздела остаются без раздела.
+func (h *Handler) DeleteCategory(c *gin.Context) {
+	cat, ok := h.loadCategory(c)
+	if !ok {
+		return
+	}
+
+	var children int64
+	if err := h.DB.Model(&Category{}).Where("parent_id = ?", cat.ID).Count(&children).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check subcategories", "details": err.Error()})
+		return
+	}
+	if children > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Category has subcategories"})
+		return
+	}
+
+	if err := h.DB.Delete(cat).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category", "details": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
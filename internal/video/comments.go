@@ -0,0 +1,470 @@
+package video
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Ограничения комментариев
+const (
+	maxCommentDepth  = 2 // Ответы на ответы второго уровня прикрепляются к тому же родителю
+	commentsPerPage  = 20
+	commentsMaxLimit = 100
+)
+
+// Comment - комментарий к видео или ответ на комментарий.
+type Comment struct {
+	ID        uint   `gorm:"primaryKey"`
+	VideoID   uint   `gorm:"not null"`
+	AuthorID  uint   `gorm:"not null"`
+	ParentID  *uint  // nil - комментарий к видео
+	Depth     int    `gorm:"not null;default:0"` // 0 - комментарий к видео, 1-2 - ответы
+	Body      string `gorm:"not null"`
+	Pinned    bool   `gorm:"not null;default:false"` // Закреплён автором видео, только комментарии к видео
+	EditedAt  *time.Time
+	DeletedAt *time.Time // Удалённый комментарий остаётся заглушкой, пока у него есть ответы
+	CreatedAt time.Time  `gorm:"autoCreateTime"`
+}
+
+// blocklist - запрещённые слова в комментариях, без учёта регистра.
+type blocklist map[string]bool
+
+func newBlocklist(words []string) blocklist {
+	b := blocklist{}
+	for _, w := range words {
+		b[strings.ToLower(w)] = true
+	}
+	return b
+}
+
+// contains проверяет, есть ли в тексте запрещённое слово целиком.
+func (b blocklist) contains(text string) bool {
+	if len(b) == 0 {
+		return false
+	}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if b[w] {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCommentBody проверяет текст комментария и возвращает его без пробелов по краям.
+func validateCommentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", errors.New("comment must not be empty")
+	}
+	if len([]rune(body)) > commentMaxLength {
+		return "", fmt.Errorf("comment must not exceed %d characters", commentMaxLength)
+	}
+	if commentBlocklist.contains(body) {
+		return "", errors.New("comment contains blocked words")
+	}
+	return body, nil
+}
+
+// commentRow - комментарий с именем автора и числом ответов.
+type commentRow struct {
+	Comment
+	AuthorName string
+	ReplyCount int64
+}
+
+const commentColumns = `c.*, u.username AS author_name,
+	(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id AND r.deleted_at IS NULL) AS reply_count`
+
+func (r *commentRow) response() gin.H {
+	body, author := r.Body, gin.H{"id": r.AuthorID, "username": r.AuthorName}
+	if r.DeletedAt != nil {
+		body, author = "", nil
+	}
+	return gin.H{
+		"id":          r.ID,
+		"video_id":    r.VideoID,
+		"parent_id":   r.ParentID,
+		"depth":       r.Depth,
+		"author":      author,
+		"body":        body,
+		"pinned":      r.Pinned,
+		"deleted":     r.DeletedAt != nil,
+		"edited_at":   r.EditedAt,
+		"created_at":  r.CreatedAt,
+		"reply_count": r.ReplyCount,
+	}
+}
+
+// commentQuery выбирает видимые комментарии: удалённые показываются, только пока у них есть ответы.
+func (h *Handler) commentQuery() *gorm.DB {
+	return h.DB.Table("comments c").
+		Select(commentColumns).
+		Joins("JOIN users u ON u.id = c.author_id").
+		Where("c.deleted_at IS NULL OR EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.id AND r.deleted_at IS NULL)")
+}
+
+// cursorParams разбирает cursor (ID последнего полученного комментария) и limit.
+func cursorParams(c *gin.Context) (cursor uint64, limit int, ok bool) {
+	limit = commentsPerPage
+	if s := c.Query("cursor"); s != "" {
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return 0, 0, false
+		}
+		cursor = v
+	}
+	if s := c.Query("limit"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 || v > commentsMaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", commentsMaxLimit)})
+			return 0, 0, false
+		}
+		limit = v
+	}
+	return cursor, limit, true
+}
+
+// commentPage превращает limit+1 строк в страницу и курсор следующей страницы.
+func commentPage(rows []commentRow, limit int) ([]gin.H, *string) {
+	var next *string
+	if len(rows) > limit {
+		rows = rows[:limit]
+		s := strconv.FormatUint(uint64(rows[limit-1].ID), 10)
+		next = &s
+	}
+	items := make([]gin.H, 0, len(rows))
+	for i := range rows {
+		items = append(items, rows[i].response())
+	}
+	return items, next
+}
+
+// ListComments отдаёт комментарии к видео, новые первыми. Закреплённый комментарий идёт отдельно на первой странице.
+func (h *Handler) ListComments(c *gin.Context) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireViewer(c, v) {
+		return
+	}
+	cursor, limit, ok := cursorParams(c)
+	if !ok {
+		return
+	}
+	if v.CommentsDisabled {
+		c.JSON(http.StatusOK, gin.H{"video_id": v.ID, "comments_disabled": true, "comments": []gin.H{}, "next_cursor": nil})
+		return
+	}
+
+	query := h.commentQuery().Where("c.video_id = ? AND c.depth = 0 AND NOT c.pinned", v.ID)
+	if cursor > 0 {
+		query = query.Where("c.id < ?", cursor)
+	}
+	var rows []commentRow
+	if err := query.Order("c.id DESC").Limit(limit + 1).Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comments", "details": err.Error()})
+		return
+	}
+	comments, next := commentPage(rows, limit)
+
+	var pinned gin.H
+	if cursor == 0 {
+		var pinnedRows []commentRow
+		if err := h.commentQuery().Where("c.video_id = ? AND c.pinned", v.ID).Limit(1).Scan(&pinnedRows).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comments", "details": err.Error()})
+			return
+		}
+		if len(pinnedRows) > 0 {
+			pinned = pinnedRows[0].response()
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"video_id":          v.ID,
+		"comments_disabled": false,
+		"pinned":            pinned,
+		"comments":          comments,
+		"next_cursor":       next,
+	})
+}
+
+// loadComment ищет комментарий по параметру id вместе с видео и проверяет права зрителя на видео.
+func (h *Handler) loadComment(c *gin.Context) (*Comment, *Video, bool) {
+	var comment Comment
+	if err := h.DB.First(&comment, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comment", "details": err.Error()})
+		return nil, nil, false
+	}
+
+	var v Video
+	if err := h.DB.First(&v, comment.VideoID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch video", "details": err.Error()})
+		return nil, nil, false
+	}
+	if !h.requireViewer(c, &v) {
+		return nil, nil, false
+	}
+	return &comment, &v, true
+}
+
+// requireCommentsEnabled отвечает 403, если автор отключил комментарии к видео.
+// Удалять и откреплять комментарии можно и при отключённых комментариях.
+func requireCommentsEnabled(c *gin.Context, v *Video) bool {
+	if v.CommentsDisabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Comments are disabled for this video"})
+		return false
+	}
+	return true
+}
+
+// ListReplies отдаёт ответы на комментарий в порядке публикации.
+func (h *Handler) ListReplies(c *gin.Context) {
+	parent, v, ok := h.loadComment(c)
+	if !ok || !requireCommentsEnabled(c, v) {
+		return
+	}
+	cursor, limit, ok := cursorParams(c)
+	if !ok {
+		return
+	}
+
+	query := h.commentQuery().Where("c.parent_id = ?", parent.ID)
+	if cursor > 0 {
+		query = query.Where("c.id > ?", cursor)
+	}
+	var rows []commentRow
+	if err := query.Order("c.id").Limit(limit + 1).Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch replies", "details": err.Error()})
+		return
+	}
+	replies, next := commentPage(rows, limit)
+
+	c.JSON(http.StatusOK, gin.H{"comment_id": parent.ID, "replies": replies, "next_cursor": next})
+}
+
+type CreateCommentRequest struct {
+	Body     string `json:"body" binding:"required"`
+	ParentID *uint  `json:"parent_id"` // Ответ на комментарий
+}
+
+// checkCommentRate проверяет частоту комментариев пользователя и при превышении сам отвечает 429.
+func (h *Handler) checkCommentRate(c *gin.Context, userID uint) bool {
+	limits := []struct {
+		max    int64
+		period time.Duration
+	}{
+		{commentRatePerMinute, time.Minute},
+		{commentRatePerHour, time.Hour},
+	}
+	for _, l := range limits {
+		if l.max <= 0 {
+			continue
+		}
+		var count int64
+		if err := h.DB.Model(&Comment{}).
+			Where("author_id = ? AND created_at > ?", userID, time.Now().Add(-l.period)).
+			Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check comment rate", "details": err.Error()})
+			return false
+		}
+		if count >= l.max {
+			c.Header("Retry-After", strconv.Itoa(int(l.period.Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("No more than %d comments per %s", l.max, l.period)})
+			return false
+		}
+	}
+	return true
+}
+
+// CreateComment публикует комментарий или ответ и рассылает его зрителям видео по WebSocket.
+func (h *Handler) CreateComment(c *gin.Context) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireViewer(c, v) || !requireCommentsEnabled(c, v) {
+		return
+	}
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req CreateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body, err := validateCommentBody(req.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	comment := Comment{VideoID: v.ID, AuthorID: u.ID, Body: body}
+	var parent *Comment // Комментарий, на который отвечают
+	if req.ParentID != nil {
+		parent = &Comment{}
+		if err := h.DB.Where("id = ? AND video_id = ?", *req.ParentID, v.ID).First(parent).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Parent comment not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comment", "details": err.Error()})
+			return
+		}
+		if parent.DeletedAt != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot reply to a deleted comment"})
+			return
+		}
+		if parent.Depth >= maxCommentDepth {
+			comment.ParentID, comment.Depth = parent.ParentID, parent.Depth
+		} else {
+			comment.ParentID, comment.Depth = &parent.ID, parent.Depth+1
+		}
+	}
+
+	if !h.checkCommentRate(c, u.ID) {
+		return
+	}
+	if err := h.DB.Create(&comment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save comment", "details": err.Error()})
+		return
+	}
+
+	row := commentRow{Comment: comment, AuthorName: u.Username}
+	resp := row.response()
+	h.ActiveViewers.Send(videoRoom(v.ID), gin.H{"type": "comment", "comment": resp})
+	h.Notifier.CommentPosted(v, &comment, parent)
+	c.JSON(http.StatusCreated, resp)
+}
+
+type UpdateCommentRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// UpdateComment изменяет текст комментария. Доступно только автору комментария.
+func (h *Handler) UpdateComment(c *gin.Context) {
+	comment, v, ok := h.loadComment(c)
+	if !ok || !requireCommentsEnabled(c, v) {
+		return
+	}
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if comment.AuthorID != u.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author can edit the comment"})
+		return
+	}
+	if comment.DeletedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	var req UpdateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body, err := validateCommentBody(req.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	if err := h.DB.Model(comment).Updates(map[string]interface{}{"body": body, "edited_at": now}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment", "details": err.Error()})
+		return
+	}
+
+	row := commentRow{Comment: *comment, AuthorName: u.Username}
+	c.JSON(http.StatusOK, row.response())
+}
+
+// DeleteComment удаляет комментарий. Удалить может автор комментария, автор видео или администратор.
+func (h *Handler) DeleteComment(c *gin.Context) {
+	comment, v, ok := h.loadComment(c)
+	if !ok {
+		return
+	}
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if comment.AuthorID != u.ID && v.AuthorID != u.ID && !u.IsModerator() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot delete this comment"})
+		return
+	}
+	if comment.DeletedAt != nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	if err := eraseComment(h.DB, comment); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment", "details": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// eraseComment удаляет комментарий: текст стирается сразу, а сама запись остаётся, чтобы не терять ветку ответов.
+func eraseComment(db *gorm.DB, comment *Comment) error {
+	return db.Model(comment).Updates(map[string]interface{}{
+		"body":       "",
+		"pinned":     false,
+		"deleted_at": time.Now(),
+	}).Error
+}
+
+// setPinned закрепляет или открепляет комментарий. Доступно только автору видео.
+func (h *Handler) setPinned(c *gin.Context, pinned bool) {
+	comment, v, ok := h.loadComment(c)
+	if !ok || !h.requireOwner(c, v) {
+		return
+	}
+	if pinned && (comment.Depth != 0 || comment.DeletedAt != nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only a comment to the video can be pinned"})
+		return
+	}
+
+	// У видео закреплён не больше одного комментария
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if pinned {
+			if err := tx.Model(&Comment{}).Where("video_id = ? AND pinned", v.ID).Update("pinned", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(comment).Update("pinned", pinned).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin comment", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": comment.ID, "pinned": pinned})
+}
+
+// PinComment закрепляет комментарий над остальными.
+func (h *Handler) PinComment(c *gin.Context) {
+	h.setPinned(c, true)
+}
+
+// UnpinComment открепляет комментарий.
+func (h *Handler) UnpinComment(c *gin.Context) {
+	h.setPinned(c, false)
+}
@@ -0,0 +1,133 @@
+package video
+
+import (
+	"time"
+
+	"github.com/toxanetoxa/gohls/internal/media"
+	"github.com/toxanetoxa/gohls/pkg/env"
+)
+
+// Настройки пакета. Читаются из окружения в loadConfig, которую вызывает NewVideoHandler:
+// при инициализации пакета .env ещё не загружен.
+var (
+	// Позиции кадров-кандидатов для обложки в долях от длительности видео
+	posterPositions []float64
+
+	// Спрайты раскадровки: интервал между кадрами в секундах, размер сетки и ширина кадра
+	storyboardInterval float64
+	storyboardColumns  int
+	storyboardRows     int
+	storyboardWidth    int
+
+	// Упаковка: высоты лестницы качеств и длительность сегмента в секундах
+	hlsLadder          []string
+	hlsSegmentDuration int
+	hlsQuickPublish    bool
+	hlsQuickRetention  time.Duration // Сколько быстрая публикация живёт после готовности лестницы сверх длительности видео
+
+	// Извлечение аудиодорожек в M4A: сколько ffmpeg может работать одновременно и сколько длится один запуск
+	audioExtractConcurrency int
+	audioExtractTimeout     time.Duration
+
+	// Шифрование HLS: включено ли оно и сколько сегментов шифруется одним ключом (0 - без ротации).
+	// Выключено по умолчанию: с ним зашифрованные видео недоступны по DASH
+	hlsEncryption  bool
+	hlsKeyRotation int
+
+	// Какие контейнеры принимаются при загрузке. Запрет сильнее разрешения.
+	uploadAllowedTypes []string
+	uploadDeniedTypes  []string
+
+	// Заражённые файлы переносятся сюда, вне uploads, чтобы их не отдавал ни nginx, ни приложение
+	quarantineDir string
+	scanTimeout   time.Duration
+
+	// Пока clamd недоступен, проверка повторяется через scanRetryDelay, не больше scanMaxAttempts раз
+	scanRetryDelay  time.Duration
+	scanMaxAttempts int
+
+	// Окно, за которое считаются просмотры для сортировки trending в каталоге
+	catalogTrendingWindow time.Duration
+
+	// Тренды и похожие видео
+	recommendInterval     time.Duration // Как часто пересчитываются тренды
+	trendingHalfLife      time.Duration // За это время вес просмотра падает вдвое
+	trendingWindow        time.Duration // Более старые просмотры не учитываются
+	trendingLimit         int           // Сколько видео хранится в трендах
+	trendingLikeWeight    float64       // Вклад лайка относительно просмотра
+	trendingDislikeWeight float64       // Дизлайк уменьшает оценку
+	relatedLimit          int           // Сколько похожих видео отдаётся
+	relatedTagWeight      float64       // Вес сходства по тегам
+	relatedCoviewWeight   float64       // Вес совместных просмотров
+	relatedCoviewSample   int           // Сколько последних зрителей видео учитывается
+	relatedCacheTTL       time.Duration // Сколько живёт посчитанный список похожих
+
+	// История просмотра
+	historyCompletePercent float64 // С какого процента видео считается досмотренным
+	historyResumeMin       float64 // С какой секунды предлагать продолжить просмотр
+
+	// Комментарии
+	commentMaxLength     int
+	commentRatePerMinute int64 // 0 - без ограничения
+	commentRatePerHour   int64 // 0 - без ограничения
+	commentBlocklist     blocklist
+
+	// Лента подписок
+	feedCacheTTL  time.Duration // Сколько живёт закешированное начало ленты
+	feedCacheSize int           // Сколько первых видео ленты кешируется
+)
+
+func loadConfig() {
+	posterPositions = env.FloatList("THUMBNAIL_POSITIONS", []float64{0.1, 0.3, 0.5, 0.7, 0.9})
+
+	storyboardInterval = env.Float("STORYBOARD_INTERVAL", 5)
+	storyboardColumns = env.Int("STORYBOARD_COLUMNS", 10)
+	storyboardRows = env.Int("STORYBOARD_ROWS", 10)
+	storyboardWidth = env.Int("STORYBOARD_TILE_WIDTH", 160)
+
+	hlsLadder = env.List("HLS_LADDER", []string{"1080", "720", "480", "360"})
+	hlsSegmentDuration = env.Int("HLS_SEGMENT_DURATION", 6)
+	hlsQuickPublish = env.Bool("HLS_QUICK_PUBLISH", true)
+	hlsQuickRetention = env.Duration("HLS_QUICK_RETENTION", time.Hour)
+
+	audioExtractConcurrency = env.Int("AUDIO_EXTRACT_CONCURRENCY", 2)
+	audioExtractTimeout = env.Duration("AUDIO_EXTRACT_TIMEOUT", 10*time.Minute)
+
+	hlsEncryption = env.Bool("HLS_ENCRYPTION", false)
+	hlsKeyRotation = env.Int("HLS_KEY_ROTATION", 0)
+
+	uploadAllowedTypes = env.List("UPLOAD_ALLOWED_TYPES", []string{
+		media.MimeMP4, media.MimeQuickTime, media.MimeWebM, media.MimeMatroska, media.MimeMPEGTS,
+	})
+	uploadDeniedTypes = env.List("UPLOAD_DENIED_TYPES", nil)
+
+	quarantineDir = env.String("QUARANTINE_DIR", "quarantine")
+	scanTimeout = env.Duration("SCAN_TIMEOUT", 10*time.Minute)
+	scanRetryDelay = env.Duration("SCAN_RETRY_DELAY", time.Minute)
+	scanMaxAttempts = env.Int("SCAN_MAX_ATTEMPTS", 10)
+
+	catalogTrendingWindow = env.Duration("CATALOG_TRENDING_WINDOW", 72*time.Hour)
+
+	recommendInterval = env.Duration("RECOMMEND_INTERVAL", 10*time.Minute)
+	trendingHalfLife = env.Duration("TRENDING_HALF_LIFE", 24*time.Hour)
+	trendingWindow = env.Duration("TRENDING_WINDOW", 7*24*time.Hour)
+	trendingLimit = env.Int("TRENDING_LIMIT", 100)
+	trendingLikeWeight = env.Float("TRENDING_LIKE_WEIGHT", 2)
+	trendingDislikeWeight = env.Float("TRENDING_DISLIKE_WEIGHT", 1)
+	relatedLimit = env.Int("RELATED_LIMIT", 20)
+	relatedTagWeight = env.Float("RELATED_TAG_WEIGHT", 1)
+	relatedCoviewWeight = env.Float("RELATED_COVIEW_WEIGHT", 1)
+	relatedCoviewSample = env.Int("RELATED_COVIEW_SAMPLE", 1000)
+	relatedCacheTTL = env.Duration("RELATED_CACHE_TTL", time.Hour)
+
+	historyCompletePercent = env.Float("HISTORY_COMPLETE_PERCENT", 90)
+	historyResumeMin = env.Float("HISTORY_RESUME_MIN", 10)
+
+	commentMaxLength = env.Int("COMMENT_MAX_LENGTH", 2000)
+	commentRatePerMinute = env.Int64("COMMENT_RATE_PER_MINUTE", 5)
+	commentRatePerHour = env.Int64("COMMENT_RATE_PER_HOUR", 100)
+	commentBlocklist = newBlocklist(env.List("COMMENT_BLOCKLIST", nil))
+
+	feedCacheTTL = env.Duration("FEED_CACHE_TTL", time.Minute)
+	feedCacheSize = env.Int("FEED_CACHE_SIZE", 200)
+}
@@ -0,0 +1,290 @@
+package video
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Манифест MPEG-DASH строится из тех же CMAF-сегментов, что и HLS: init.mp4 и seg_NNNNN.m4s
+// каждого представления. Сегменты, зашифрованные AES-128 для HLS, DASH-плееры воспроизвести
+// не могут (нужен CENC), поэтому для зашифрованных видео манифест не отдаётся.
+
+type mpd struct {
+	XMLName                   xml.Name  `xml:"MPD"`
+	Xmlns                     string    `xml:"xmlns,attr"`
+	Profiles                  string    `xml:"profiles,attr"`
+	Type                      string    `xml:"type,attr"`
+	MediaPresentationDuration string    `xml:"mediaPresentationDuration,attr"`
+	MinBufferTime             string    `xml:"minBufferTime,attr"`
+	BaseURL                   string    `xml:"BaseURL"`
+	Period                    mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	ID             string             `xml:"id,attr"`
+	Start          string             `xml:"start,attr"`
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	ContentType      string              `xml:"contentType,attr"`
+	MimeType         string              `xml:"mimeType,attr"`
+	Lang             string              `xml:"lang,attr,omitempty"`
+	SegmentAlignment string              `xml:"segmentAlignment,attr,omitempty"`
+	Label            string              `xml:"Label,omitempty"`
+	Role             *mpdRole            `xml:"Role,omitempty"`
+	Representations  []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdRole struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+type mpdRepresentation struct {
+	ID              string              `xml:"id,attr"`
+	Bandwidth       int                 `xml:"bandwidth,attr"`
+	Codecs          string              `xml:"codecs,attr,omitempty"`
+	Width           int                 `xml:"width,attr,omitempty"`
+	Height          int                 `xml:"height,attr,omitempty"`
+	AudioChannels   *mpdAudioChannels   `xml:"AudioChannelConfiguration,omitempty"`
+	BaseURL         string              `xml:"BaseURL,omitempty"`
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate,omitempty"`
+}
+
+type mpdAudioChannels struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+type mpdSegmentTemplate struct {
+	Timescale      int            `xml:"timescale,attr"`
+	Initialization string         `xml:"initialization,attr"`
+	Media          string         `xml:"media,attr"`
+	StartNumber    int            `xml:"startNumber,attr"`
+	Timeline       []mpdTimelineS `xml:"SegmentTimeline>S"`
+}
+
+type mpdTimelineS struct {
+	T *int64 `xml:"t,attr,omitempty"`
+	D int64  `xml:"d,attr"`
+	R int    `xml:"r,attr,omitempty"`
+}
+
+// Единиц времени в секунде для SegmentTimeline
+const dashTimescale = 1000
+
+// errNotCMAF - видео упаковано в MPEG-TS до перехода на CMAF, DASH для него недоступен до переупаковки
+var errNotCMAF = errors.New("video is not packaged as CMAF")
+
+// GetDASHManifest отдаёт манифест MPEG-DASH с адаптациями для видео, каждой аудиодорожки и субтитров.
+func (h *Handler) GetDASHManifest(c *gin.Context) {
+	v, ok := h.loadWatchableVideo(c)
+	if !ok {
+		return
+	}
+
+	encrypted, err := h.isEncrypted(v)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch keys", "details": err.Error()})
+		return
+	}
+	if encrypted {
+		// Не 404: видео есть, но упаковано для HLS по выбору HLS_ENCRYPTION
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "DASH is not available for encrypted videos, use HLS",
+			"details": "segments are encrypted with AES-128 for HLS (HLS_ENCRYPTION), DASH players require CENC",
+			"hls_url": fmt.Sprintf("/videos/%d/hls/master.m3u8", v.ID),
+		})
+		return
+	}
+
+	manifest, err := h.buildDASHManifest(c, v)
+	if errors.Is(err, errNotCMAF) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "DASH is not available for this video, use HLS"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build DASH manifest", "details": err.Error()})
+		return
+	}
+	if manifest == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "DASH is not ready yet"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "application/dash+xml", manifest)
+}
+
+// isEncrypted проверяет, зашифрованы ли сегменты видео.
+func (h *Handler) isEncrypted(v *Video) (bool, error) {
+	var count int64
+	err := h.DB.Model(&ContentKey{}).Where("video_id = ?", v.ID).Count(&count).Error
+	return count > 0, err
+}
+
+// buildDASHManifest собирает MPD. nil означает, что видео ещё не упаковано.
+func (h *Handler) buildDASHManifest(c *gin.Context, v *Video) ([]byte, error) {
+	var renditions []Rendition
+	if err := h.DB.Where("video_id = ?", v.ID).Order("height DESC, stream_index").Find(&renditions).Error; err != nil {
+		return nil, err
+	}
+
+	var tracks []SubtitleTrack
+	if err := h.DB.Where("video_id = ?", v.ID).Order("id").Find(&tracks).Error; err != nil {
+		return nil, err
+	}
+
+	// Подпись сегментов дописывается к шаблонам: одна подпись на префикс hls/ видео
+	query := ""
+	if h.Signer != nil {
+		query = "?" + h.Signer.Sign(hlsURLPrefix(v.ID), c.ClientIP()).Encode()
+	}
+
+	videoSet := mpdAdaptationSet{ContentType: "video", MimeType: "video/mp4", SegmentAlignment: "true"}
+	var audioSets []mpdAdaptationSet
+	duration := v.Duration
+
+	for _, r := range renditions {
+		template, total, err := h.dashSegmentTemplate(v, r, query)
+		if err != nil {
+			return nil, err
+		}
+		if duration <= 0 {
+			duration = total
+		}
+
+		rep := mpdRepresentation{
+			ID:              r.Name,
+			Bandwidth:       r.Bandwidth,
+			Codecs:          r.Codecs,
+			SegmentTemplate: template,
+		}
+
+		if r.Type != RenditionAudio {
+			rep.Width, rep.Height = r.Width, r.Height
+			videoSet.Representations = append(videoSet.Representations, rep)
+			continue
+		}
+
+		rep.AudioChannels = &mpdAudioChannels{
+			SchemeIDURI: "urn:mpeg:dash:23003:3:audio_channel_configuration:2011",
+			Value:       "2",
+		}
+		set := mpdAdaptationSet{
+			ContentType:     "audio",
+			MimeType:        "audio/mp4",
+			Lang:            r.Language,
+			Label:           r.Label,
+			Representations: []mpdRepresentation{rep},
+		}
+		if r.IsDefault {
+			set.Role = &mpdRole{SchemeIDURI: "urn:mpeg:dash:role:2011", Value: "main"}
+		}
+		audioSets = append(audioSets, set)
+	}
+
+	if len(videoSet.Representations) == 0 {
+		return nil, nil
+	}
+
+	period := mpdPeriod{ID: "0", Start: "PT0S"}
+	period.AdaptationSets = append(period.AdaptationSets, videoSet)
+	period.AdaptationSets = append(period.AdaptationSets, audioSets...)
+
+	// Субтитры подключаются целиком как внешние WebVTT-файлы
+	for _, t := range tracks {
+		role := "subtitle"
+		if t.IsDefault {
+			role = "main"
+		}
+		period.AdaptationSets = append(period.AdaptationSets, mpdAdaptationSet{
+			ContentType: "text",
+			MimeType:    "text/vtt",
+			Lang:        t.Language,
+			Label:       t.Label,
+			Role:        &mpdRole{SchemeIDURI: "urn:mpeg:dash:role:2011", Value: role},
+			Representations: []mpdRepresentation{{
+				ID:        fmt.Sprintf("sub_%d", t.ID),
+				Bandwidth: 256,
+				BaseURL:   fmt.Sprintf("/videos/%d/subtitles/%d.vtt", v.ID, t.ID),
+			}},
+		})
+	}
+
+	manifest := mpd{
+		Xmlns:                     "urn:mpeg:dash:schema:mpd:2011",
+		Profiles:                  "urn:mpeg:dash:profile:isoff-live:2011",
+		Type:                      "static",
+		MediaPresentationDuration: fmt.Sprintf("PT%.3fS", duration),
+		MinBufferTime:             fmt.Sprintf("PT%dS", hlsSegmentDuration),
+		BaseURL:                   hlsURLPrefix(v.ID),
+		Period:                    period,
+	}
+
+	out, err := xml.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// dashSegmentTemplate строит SegmentTemplate представления по длительностям сегментов из его HLS-плейлиста.
+// Возвращает также общую длительность представления в секундах.
+func (h *Handler) dashSegmentTemplate(v *Video, r Rendition, query string) (*mpdSegmentTemplate, float64, error) {
+	lines, err := readLines(v.MediaPath(path.Join(hlsDir, r.Playlist)))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	template := &mpdSegmentTemplate{
+		Timescale:      dashTimescale,
+		Initialization: r.Name + "/" + hlsInitName + query,
+		Media:          r.Name + "/seg_$Number%05d$.m4s" + query,
+		StartNumber:    0,
+	}
+
+	var total float64
+	var t int64
+	for _, line := range lines {
+		if strings.HasSuffix(line, ".ts") {
+			return nil, 0, errNotCMAF
+		}
+		if !strings.HasPrefix(line, "#EXTINF:") {
+			continue
+		}
+		value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, 0, err
+		}
+		total += seconds
+
+		// Время считаем от накопленной суммы, чтобы ошибки округления не копились
+		end := int64(total*dashTimescale + 0.5)
+		d := end - t
+		t = end
+
+		timeline := template.Timeline
+		if n := len(timeline); n > 0 && timeline[n-1].D == d {
+			timeline[n-1].R++
+			continue
+		}
+		s := mpdTimelineS{D: d}
+		if len(timeline) == 0 {
+			zero := int64(0)
+			s.T = &zero
+		}
+		template.Timeline = append(timeline, s)
+	}
+
+	return template, total, nil
+}
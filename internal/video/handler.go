@@ -3,11 +3,16 @@ package video
 import (
 	"errors"
 	"fmt"
+	"github.com/toxanetoxa/gohls/internal/media"
+	"github.com/toxanetoxa/gohls/internal/quota"
+	"github.com/toxanetoxa/gohls/internal/scan"
+	"github.com/toxanetoxa/gohls/internal/signedurl"
 	"github.com/toxanetoxa/gohls/internal/user"
+	"github.com/toxanetoxa/gohls/pkg/env"
+	"github.com/toxanetoxa/gohls/pkg/logger"
 	"io"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,14 +25,38 @@ import (
 
 // TODO перенести сигнатуры в video.go
 
+// Очередь исходящих сообщений одного соединения и время на запись одного сообщения.
+// Клиент, который не успевает читать, отключается и не задерживает остальных.
+const (
+	viewerSendQueue    = 16
+	viewerWriteTimeout = 10 * time.Second
+)
+
 type ActiveViewers struct {
 	mu      sync.Mutex
-	viewers map[string]map[*websocket.Conn]bool // videoID -> connections
+	viewers map[string]map[*websocket.Conn]*viewer // videoID -> connections
+}
+
+// viewer - соединение зрителя со своей очередью: пишет в него только writeLoop,
+// поэтому медленный клиент не блокирует рассылку остальным.
+type viewer struct {
+	conn *websocket.Conn
+	send chan interface{}
+}
+
+func (v *viewer) writeLoop() {
+	for msg := range v.send {
+		_ = v.conn.SetWriteDeadline(time.Now().Add(viewerWriteTimeout))
+		if err := v.conn.WriteJSON(msg); err != nil {
+			// Чтение в serve получит ошибку и уберёт зрителя, очередь дочитываем до закрытия
+			v.conn.Close()
+		}
+	}
 }
 
 func NewActiveViewers() *ActiveViewers {
 	return &ActiveViewers{
-		viewers: make(map[string]map[*websocket.Conn]bool),
+		viewers: make(map[string]map[*websocket.Conn]*viewer),
 	}
 }
 
@@ -37,9 +66,14 @@ func (av *ActiveViewers) AddViewer(videoID string, conn *websocket.Conn) {
 	defer av.mu.Unlock()
 
 	if av.viewers[videoID] == nil {
-		av.viewers[videoID] = make(map[*websocket.Conn]bool)
+		av.viewers[videoID] = make(map[*websocket.Conn]*viewer)
+	}
+	if av.viewers[videoID][conn] != nil {
+		return
 	}
-	av.viewers[videoID][conn] = true
+	v := &viewer{conn: conn, send: make(chan interface{}, viewerSendQueue)}
+	av.viewers[videoID][conn] = v
+	go v.writeLoop()
 }
 
 // RemoveViewer удаляет зрителя для указанного видео.
@@ -47,32 +81,154 @@ func (av *ActiveViewers) RemoveViewer(videoID string, conn *websocket.Conn) {
 	av.mu.Lock()
 	defer av.mu.Unlock()
 
+	if v := av.viewers[videoID][conn]; v != nil {
+		close(v.send)
+	}
 	delete(av.viewers[videoID], conn)
 	if len(av.viewers[videoID]) == 0 {
 		delete(av.viewers, videoID)
 	}
 }
 
-// GetViewers возвращает количество активных зрителей для указанного видео.
-func (av *ActiveViewers) GetViewers(videoID string) int {
+// GetViewers возвращает количество активных зрителей комнаты.
+func (av *ActiveViewers) GetViewers(room string) int {
 	av.mu.Lock()
 	defer av.mu.Unlock()
 
-	return len(av.viewers[videoID])
+	return len(av.viewers[room])
 }
 
 // Handler обрабатывает запросы, связанные с видео.
 type Handler struct {
 	DB            *gorm.DB
 	ActiveViewers *ActiveViewers
+	FFmpeg        *media.FFmpeg
+	Pipeline      *Pipeline
+	Keys          *KeyVault         // nil - шифрование HLS выключено
+	Signer        *signedurl.Signer // nil - подпись ссылок выключена
+	Scanner       scan.Scanner      // nil - антивирусная проверка выключена
+	Notifier      Notifier
+	Recommender   *Recommender
+	Feeds         *FeedCache
+	Audio         *AudioExtractor
 }
 
 // NewVideoHandler создаёт новый экземпляр Handler.
 func NewVideoHandler(db *gorm.DB) *Handler {
-	return &Handler{
+	loadConfig()
+
+	h := &Handler{
 		DB:            db,
 		ActiveViewers: NewActiveViewers(),
+		FFmpeg:        media.NewFFmpeg(),
+		Signer:        signedurl.NewSignerFromEnv(),
+		Scanner:       scan.NewScannerFromEnv(),
+		Recommender:   NewRecommender(db),
+		Feeds:         NewFeedCache(),
+		Audio:         NewAudioExtractor(audioExtractConcurrency),
 	}
+
+	if hlsEncryption {
+		keys, err := NewKeyVault(os.Getenv("HLS_MASTER_KEY"))
+		if err != nil {
+			// Шифрование включено явно: упаковывать приватные и платные видео открытыми нельзя
+			logger.Logger.Fatalw("HLS encryption is enabled but the master key is unusable", "error", err)
+		}
+		h.Keys = keys
+		logger.Logger.Infow("HLS encryption is enabled, new videos will be available over HLS only, not DASH")
+	}
+
+	h.Notifier = &NotificationCenter{DB: db, Rooms: h.ActiveViewers}
+	go h.sweepQuickMedia()
+	go backfillFileSizes(db)
+
+	h.Pipeline = &Pipeline{
+		DB:         db,
+		OnDone:     func(v *Video) { h.Notifier.VideoProcessed(v) },
+		Timeout:    env.Duration("PROCESSING_TIMEOUT", time.Hour),
+		RetryDelay: scanRetryDelay,
+		Steps: []Step{
+			h.scanStep(),
+			h.faststartStep(),
+			h.probeStep(),
+			h.quickHLSStep(),
+			h.posterFramesStep(),
+			h.storyboardStep(),
+			h.hlsStep(),
+		},
+	}
+	if h.Scanner != nil {
+		go h.resumeScans()
+	}
+
+	return h
+}
+
+// loadVideo ищет видео по параметру id и при ошибке сам отвечает клиенту.
+func (h *Handler) loadVideo(c *gin.Context) (*Video, bool) {
+	videoID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid video ID"})
+		return nil, false
+	}
+
+	var v Video
+	if err := h.DB.First(&v, videoID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Video not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch video", "details": err.Error()})
+		return nil, false
+	}
+
+	return &v, true
+}
+
+// loadWatchableVideo ищет видео и проверяет, что текущий зритель может его смотреть.
+func (h *Handler) loadWatchableVideo(c *gin.Context) (*Video, bool) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireAccess(c, v) {
+		return nil, false
+	}
+	return v, true
+}
+
+// signedURL подписывает ссылку на файл для текущего клиента, если подпись включена.
+func (h *Handler) signedURL(c *gin.Context, p string) string {
+	if h.Signer == nil {
+		return p
+	}
+	return h.Signer.SignURL(p, p, c.ClientIP())
+}
+
+// currentUser возвращает пользователя, установленного AuthMiddleware.
+func (h *Handler) currentUser(c *gin.Context) (*user.User, error) {
+	username := c.GetString("username")
+	if username == "" {
+		return nil, errors.New("user not authenticated")
+	}
+
+	var u user.User
+	if err := h.DB.Where("username = ?", username).First(&u).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// requireOwner проверяет, что текущий пользователь - автор видео.
+func (h *Handler) requireOwner(c *gin.Context, v *Video) bool {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return false
+	}
+
+	if u.ID != v.AuthorID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author can modify this video"})
+		return false
+	}
+	return true
 }
 
 // UploadVideo обрабатывает загрузку видео.
@@ -83,57 +239,193 @@ func (h *Handler) UploadVideo(c *gin.Context) {
 		return
 	}
 
-	// Получаем файл из запроса
-	file, err := c.FormFile("file")
+	// Получаем имя пользователя из контекста (установленного в middleware)
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Ищем пользователя по имени
+	var u user.User
+	if err := h.DB.Where("username = ?", username).First(&u).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user", "details": err.Error()})
+		return
+	}
+
+	// Квоту проверяем до чтения тела: число видео и свободное место известны заранее
+	limits, err := quota.LimitsFor(h.DB, &u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quota", "details": err.Error()})
+		return
+	}
+	usage, err := quota.UsageOf(h.DB, u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage", "details": err.Error()})
+		return
+	}
+	if limits.MaxVideos > 0 && usage.Videos >= limits.MaxVideos {
+		quota.Respond(c, quota.NewExceeded(quota.ReasonVideos, limits, usage))
+		return
+	}
+	// Файл больше StreamMaxLength clamd проверить не сможет, такой файл не принимаем
+	if limit := scan.MaxSize(h.Scanner); limit > 0 && (limits.MaxFileSize == 0 || limits.MaxFileSize > limit) {
+		limits.MaxFileSize = limit
+	}
+	maxSize := quota.MaxUploadSize(limits, usage)
+	if maxSize < 0 {
+		quota.Respond(c, quota.NewExceeded(quota.ReasonBytes, limits, usage))
+		return
+	}
+	if maxSize > 0 && c.Request.ContentLength > maxSize+multipartOverhead {
+		quota.Respond(c, sizeExceeded(limits, usage, c.Request.ContentLength-multipartOverhead))
+		return
+	}
+
+	// Принимаем файл потоком, обрывая приём при превышении лимита
+	up, err := receiveUpload(c, maxSize)
+	if errors.Is(err, errFileTooLarge) {
+		quota.Respond(c, sizeExceeded(limits, usage, maxSize+1))
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get file", "details": err.Error()})
 		return
 	}
 
 	// Получаем заголовок видео
-	title := c.PostForm("title")
-	if title == "" {
+	if up.Title == "" {
+		up.discard()
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Title is required"})
 		return
 	}
-
-	// Получаем имя пользователя из контекста (установленного в middleware)
-	username := c.GetString("username")
-	if username == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	if len([]rune(up.Description)) > maxDescriptionLength {
+		up.discard()
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Description must not exceed %d characters", maxDescriptionLength)})
+		return
+	}
+	language, err := normalizeLanguage(up.Language, up.Title, up.Description)
+	if err != nil {
+		up.discard()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	tags, err := normalizeTags(up.Tags)
+	if err != nil {
+		up.discard()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var category *Category
+	if up.Category != "" {
+		category, err = categoryBySlug(h.DB, up.Category)
+		if err != nil {
+			up.discard()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category", "details": err.Error()})
+			return
+		}
+		if category == nil {
+			up.discard()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
+			return
+		}
+	}
 
-	// Ищем пользователя по имени
-	var u user.User
-	if err := h.DB.Where("username = ?", username).First(&u).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user", "details": err.Error()})
+	// Тип определяем по содержимому: расширению и Content-Type клиента не доверяем
+	mimeType, err := detectUploadType(up.TmpPath)
+	if err != nil {
+		up.discard()
+		switch {
+		case errors.Is(err, media.ErrUnknownContainer):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "File is not a supported video", "details": err.Error()})
+		case errors.Is(err, errTypeNotAllowed):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Video type is not allowed", "details": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file", "details": err.Error()})
+		}
 		return
 	}
 
-	// Сохраняем файл на сервере
-	filePath := filepath.Join("uploads", file.Filename)
-	if err := c.SaveUploadedFile(file, filePath); err != nil {
+	// Длительность известна только после приёма файла
+	if limits.MaxDuration > 0 {
+		probe, err := h.FFmpeg.Probe(c.Request.Context(), up.TmpPath)
+		if err == nil && probe.Duration() > limits.MaxDuration {
+			up.discard()
+			quota.Respond(c, quota.NewExceeded(quota.ReasonDuration, limits, usage))
+			return
+		}
+	}
+
+	// Сохраняем файл на сервере под собственным именем
+	filePath, err := storedUploadPath(mimeType)
+	if err == nil {
+		err = os.Rename(up.TmpPath, filePath)
+	}
+	if err != nil {
+		up.discard()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file", "details": err.Error()})
 		return
 	}
 
 	// Создаём запись о видео в базе данных
 	video := Video{
-		Title:    title,
-		FilePath: filePath,
-		AuthorID: u.ID,
-	}
-
-	if err := h.DB.Create(&video).Error; err != nil {
+		Title:       up.Title,
+		Description: up.Description,
+		Language:    language,
+		FilePath:    filePath,
+		FileSize:    up.Size,
+		MimeType:    mimeType,
+		AuthorID:    u.ID,
+		Status:      StatusProcessing,
+	}
+	if h.Scanner != nil {
+		video.ScanStatus = ScanPending
+	}
+	if category != nil {
+		video.CategoryID = &category.ID
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		// Проверка до приёма файла видела снимок квоты: за время загрузки место могли занять
+		// параллельные загрузки, поэтому под блокировкой пользователя проверяем ещё раз
+		if err := quota.Lock(tx, u.ID); err != nil {
+			return err
+		}
+		usage, err := quota.UsageOf(tx, u.ID)
+		if err != nil {
+			return err
+		}
+		if exceeded := quota.CheckUpload(limits, usage, up.Size); exceeded != nil {
+			return exceeded
+		}
+		if err := tx.Create(&video).Error; err != nil {
+			return err
+		}
+		if err := setVideoTags(tx, video.ID, tags); err != nil {
+			return err
+		}
+		// Индекс обновляется в той же транзакции: иначе при ошибке видео осталось бы в processing без обработки
+		return UpdateSearchVector(tx, video.ID)
+	})
+	if err != nil {
+		os.Remove(filePath)
+		var exceeded *quota.Exceeded
+		if errors.As(err, &exceeded) {
+			quota.Respond(c, exceeded)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save video metadata", "details": err.Error()})
 		return
 	}
 
+	// Запускаем обработку (длительность, обложки и т. д.) в фоне
+	h.Pipeline.Process(video.ID)
+
 	// Возвращаем успешный ответ
 	c.JSON(http.StatusOK, gin.H{
 		"message":  "Video uploaded successfully",
 		"video_id": video.ID,
+		"status":   video.Status,
 	})
 }
 
@@ -157,6 +449,11 @@ func (h *Handler) StreamVideo(c *gin.Context) {
 		return
 	}
 
+	// Проверяем видимость и права зрителя
+	if !h.requireAccess(c, &v) {
+		return
+	}
+
 	// Получаем IP-адрес пользователя
 	ip := c.ClientIP()
 
@@ -202,7 +499,7 @@ func (h *Handler) StreamVideo(c *gin.Context) {
 
 	// Устанавливаем заголовки для стриминга
 	c.Header("Accept-Ranges", "bytes")
-	c.Header("Content-Type", "video/mp4") // Укажите правильный MIME-тип для вашего видео
+	c.Header("Content-Type", v.MimeType)
 	c.Header("Content-Length", strconv.FormatInt(fileInfo.Size(), 10))
 
 	// Используем http.ServeContent для обработки Range-запросов
@@ -212,12 +509,7 @@ func (h *Handler) StreamVideo(c *gin.Context) {
 	go func() {
 		for {
 			time.Sleep(5 * time.Second) // Обновляем каждые 5 секунд
-			activeViewers := h.ActiveViewers.GetViewers(videoID)
-			for conn := range h.ActiveViewers.viewers[videoID] {
-				if err := conn.WriteJSON(gin.H{"active_viewers": activeViewers}); err != nil {
-					h.ActiveViewers.RemoveViewer(videoID, conn)
-				}
-			}
+			h.ActiveViewers.Broadcast(videoRoom(v.ID))
 		}
 	}()
 }
@@ -246,13 +538,34 @@ var upgrader = websocket.Upgrader{
 }
 
 // ActiveViewersWS обрабатывает WebSocket-соединения для отслеживания активных зрителей.
+// В комнату видео приходят и новые комментарии, поэтому подключиться может только тот, кто может смотреть видео.
 func (h *Handler) ActiveViewersWS(c *gin.Context) {
-	videoID := c.Param("id")
-	if videoID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Video ID is required"})
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireViewer(c, v) {
 		return
 	}
 
+	h.ActiveViewers.ServeWS(c, videoRoom(v.ID))
+}
+
+// videoRoom - комната зрителей и новых комментариев видео. Префикс отделяет её от комнат
+// пользователей (user:<id>) и трансляций (live:<id>).
+func videoRoom(videoID uint) string {
+	return fmt.Sprintf("video:%d", videoID)
+}
+
+// ServeWS подключает зрителя комнаты по WebSocket и держит соединение, пока клиент его не закроет.
+// Комната - "video:<id>" для видео, "live:<id>" для прямой трансляции.
+func (av *ActiveViewers) ServeWS(c *gin.Context, room string) {
+	av.serve(c, room, true)
+}
+
+// Listen подключает клиента к комнате только для получения сообщений Send, без счётчика зрителей.
+func (av *ActiveViewers) Listen(c *gin.Context, room string) {
+	av.serve(c, room, false)
+}
+
+func (av *ActiveViewers) serve(c *gin.Context, room string, announce bool) {
 	// Обновляем HTTP-соединение до WebSocket
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -261,9 +574,17 @@ func (h *Handler) ActiveViewersWS(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	// Добавляем зрителя
-	h.ActiveViewers.AddViewer(videoID, conn)
-	defer h.ActiveViewers.RemoveViewer(videoID, conn)
+	// Добавляем зрителя и сообщаем всем новое количество
+	av.AddViewer(room, conn)
+	if announce {
+		av.Broadcast(room)
+	}
+	defer func() {
+		av.RemoveViewer(room, conn)
+		if announce {
+			av.Broadcast(room)
+		}
+	}()
 
 	// Бесконечный цикл для поддержания соединения
 	for {
@@ -273,6 +594,32 @@ func (h *Handler) ActiveViewersWS(c *gin.Context) {
 	}
 }
 
+// Broadcast отправляет зрителям комнаты текущее количество активных зрителей.
+func (av *ActiveViewers) Broadcast(room string) {
+	av.mu.Lock()
+	defer av.mu.Unlock()
+	av.enqueue(room, gin.H{"active_viewers": len(av.viewers[room])})
+}
+
+// Send отправляет сообщение всем зрителям комнаты, например новый комментарий.
+func (av *ActiveViewers) Send(room string, msg interface{}) {
+	av.mu.Lock()
+	defer av.mu.Unlock()
+	av.enqueue(room, msg)
+}
+
+// enqueue ставит сообщение в очереди соединений комнаты, не дожидаясь записи. Вызывается под av.mu.
+func (av *ActiveViewers) enqueue(room string, msg interface{}) {
+	for conn, v := range av.viewers[room] {
+		select {
+		case v.send <- msg:
+		default:
+			// Очередь переполнена - клиент не читает, отключаем его
+			conn.Close()
+		}
+	}
+}
+
 // GetVideoInfo возвращает информацию о видео.
 func (h *Handler) GetVideoInfo(c *gin.Context) {
 	videoID := c.Param("id")
@@ -292,6 +639,11 @@ func (h *Handler) GetVideoInfo(c *gin.Context) {
 		return
 	}
 
+	// Проверяем видимость и права зрителя; отклонённое видео описываем, но ссылки на него не работают
+	if !h.requireViewer(c, &v) {
+		return
+	}
+
 	// Получаем информацию о файле
 	fileInfo, err := os.Stat(v.FilePath)
 	if err != nil {
@@ -299,12 +651,100 @@ func (h *Handler) GetVideoInfo(c *gin.Context) {
 		return
 	}
 
+	// Ссылка на обложку появляется после обработки
+	thumbnailURL := ""
+	if v.ThumbnailKey != "" {
+		thumbnailURL = fmt.Sprintf("/videos/%d/thumbnail", v.ID)
+	}
+
+	// Ссылка на HLS появляется после упаковки, остальные ссылки подписываются при включённой подписи
+	var renditions int64
+	if err := h.DB.Model(&Rendition{}).Where("video_id = ?", v.ID).Count(&renditions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch renditions", "details": err.Error()})
+		return
+	}
+	hlsURL, dashURL := "", ""
+	if renditions == 0 && hasQuickPlaylist(&v) {
+		hlsURL = fmt.Sprintf("/videos/%d/hls/master.m3u8", v.ID)
+	}
+	if renditions > 0 {
+		hlsURL = fmt.Sprintf("/videos/%d/hls/master.m3u8", v.ID)
+
+		// DASH-плееры не умеют сегменты, зашифрованные AES-128 для HLS
+		encrypted, err := h.isEncrypted(&v)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch keys", "details": err.Error()})
+			return
+		}
+		if !encrypted {
+			dashURL = fmt.Sprintf("/videos/%d/dash/manifest.mpd", v.ID)
+		}
+	}
+
+	// Теги и раздел каталога
+	tags, err := videoTagNames(h.DB, v.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags", "details": err.Error()})
+		return
+	}
+	var category *categoryResponse
+	if v.CategoryID != nil {
+		var cat Category
+		if err := h.DB.First(&cat, *v.CategoryID).Error; err == nil {
+			category = newCategoryResponse(&cat)
+		}
+	}
+
+	// Позиция, с которой авторизованный зритель продолжит просмотр, и его реакция
+	var resume, myReaction interface{}
+	if u, err := h.currentUser(c); err == nil {
+		entry, err := h.watchEntry(u.ID, v.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch watch history", "details": err.Error()})
+			return
+		}
+		resume = resumeAt(entry, v.Duration)
+
+		reaction, err := h.myReaction(u.ID, v.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reaction", "details": err.Error()})
+			return
+		}
+		if reaction != "" {
+			myReaction = reaction
+		}
+	}
+
 	// Возвращаем информацию о видео
 	c.JSON(http.StatusOK, gin.H{
-		"video_id":  v.ID,
-		"title":     v.Title,
-		"file_size": fileInfo.Size(),
-		"duration":  "TODO: Добавьте логику для получения длительности видео", // TODO: Добавьте логику для получения длительности видео
+		"video_id":          v.ID,
+		"title":             v.Title,
+		"description":       v.Description,
+		"language":          v.Language,
+		"tags":              tags,
+		"category":          category,
+		"status":            v.Status,
+		"scan_status":       v.ScanStatus,
+		"rejection_reason":  v.RejectionReason,
+		"visibility":        v.Visibility,
+		"is_paid":           v.IsPaid,
+		"likes":             v.LikeCount,
+		"dislikes":          v.DislikeCount,
+		"my_reaction":       myReaction,
+		"comments_disabled": v.CommentsDisabled,
+		"moderation_status": v.ModerationStatus,
+		"moderation_reason": v.ModerationReason,
+		"age_restricted":    v.AgeRestricted,
+		"file_size":         fileInfo.Size(),
+		"duration":          v.Duration,
+		"mime_type":         v.MimeType,
+		"thumbnail_url":     thumbnailURL,
+		"hls_url":           hlsURL,
+		"dash_url":          dashURL,
+		"stream_url":        h.signedURL(c, fmt.Sprintf("/videos/%d/stream", v.ID)),
+		"chunk_url":         h.signedURL(c, fmt.Sprintf("/video/%d/chunk", v.ID)),
+		"audio_url":         h.signedURL(c, fmt.Sprintf("/videos/%d/audio", v.ID)),
+		"resume_at":         resume,
 	})
 }
 
@@ -327,6 +767,11 @@ func (h *Handler) GetVideoChunk(c *gin.Context) {
 		return
 	}
 
+	// Проверяем видимость и права зрителя
+	if !h.requireAccess(c, &v) {
+		return
+	}
+
 	// Открываем файл
 	file, err := os.Open(v.FilePath)
 	if err != nil {
@@ -363,6 +808,7 @@ func (h *Handler) GetVideoChunk(c *gin.Context) {
 
 		// Устанавливаем заголовки для частичного контента
 		c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, fileInfo.Size()))
+		c.Header("Content-Type", v.MimeType)
 		c.Header("Content-Length", strconv.FormatInt(end-start+1, 10))
 		c.Status(http.StatusPartialContent)
 
@@ -0,0 +1,213 @@
+package video
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WatchHistory - прогресс просмотра видео пользователем, обновляется heartbeat-запросами плеера.
+type WatchHistory struct {
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false"`
+	VideoID   uint      `gorm:"primaryKey;autoIncrement:false"`
+	Position  float64   `gorm:"not null"` // Последняя позиция в секундах
+	Percent   float64   `gorm:"not null"` // Максимальная просмотренная доля видео в процентах
+	Completed bool      `gorm:"not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	WatchedAt time.Time `gorm:"not null"` // Время последнего heartbeat
+}
+
+func (WatchHistory) TableName() string {
+	return "watch_history"
+}
+
+type HeartbeatRequest struct {
+	Position *float64 `json:"position" binding:"required"` // Текущая позиция в секундах
+	Ended    bool     `json:"ended"`                       // Плеер дошёл до конца
+}
+
+// resumeAt возвращает позицию, с которой стоит продолжить просмотр, или 0, если начинать сначала.
+func resumeAt(entry *WatchHistory, duration float64) float64 {
+	if entry == nil || entry.Position < historyResumeMin {
+		return 0
+	}
+	if duration > 0 && entry.Position >= duration*historyCompletePercent/100 {
+		return 0
+	}
+	return entry.Position
+}
+
+// watchEntry возвращает запись истории или nil, если пользователь видео не смотрел.
+func (h *Handler) watchEntry(userID, videoID uint) (*WatchHistory, error) {
+	var entries []WatchHistory
+	if err := h.DB.Where("user_id = ? AND video_id = ?", userID, videoID).Limit(1).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return &entries[0], nil
+}
+
+// Heartbeat сохраняет позицию просмотра текущего пользователя.
+func (h *Handler) Heartbeat(c *gin.Context) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireAccess(c, v) {
+		return
+	}
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req HeartbeatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	position := *req.Position
+	if position < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Position must not be negative"})
+		return
+	}
+
+	percent := 0.0
+	if v.Duration > 0 {
+		position = min(position, v.Duration)
+		percent = position / v.Duration * 100
+	}
+	if req.Ended {
+		percent = 100
+	}
+
+	entry := WatchHistory{
+		UserID:    u.ID,
+		VideoID:   v.ID,
+		Position:  position,
+		Percent:   percent,
+		Completed: percent >= historyCompletePercent,
+		WatchedAt: time.Now(),
+	}
+	// Доля и отметка о досмотре только растут: перемотка назад их не сбрасывает
+	err = h.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "video_id"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "position"}, Value: gorm.Expr("excluded.position")},
+			{Column: clause.Column{Name: "percent"}, Value: gorm.Expr("GREATEST(watch_history.percent, excluded.percent)")},
+			{Column: clause.Column{Name: "completed"}, Value: gorm.Expr("watch_history.completed OR excluded.completed")},
+			{Column: clause.Column{Name: "watched_at"}, Value: gorm.Expr("excluded.watched_at")},
+		},
+	}).Create(&entry).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save watch progress", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"video_id": v.ID, "position": position, "resume_at": resumeAt(&entry, v.Duration)})
+}
+
+// historyRow - запись истории вместе с видео.
+type historyRow struct {
+	catalogRow
+	Position  float64
+	Percent   float64
+	Completed bool
+	WatchedAt time.Time
+}
+
+// GetHistory отдаёт историю просмотра текущего пользователя, последние просмотры первыми.
+// Видео, ставшие недоступными (чужие приватные, отклонённые, снятые модерацией), в истории не показываются.
+func (h *Handler) GetHistory(c *gin.Context) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	page, perPage, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	base := func() *gorm.DB {
+		return h.DB.Table("watch_history wh").
+			Joins("JOIN videos v ON v.id = wh.video_id").
+			Where("wh.user_id = ?", u.ID).
+			Where("(v.visibility <> ? OR v.author_id = ?) AND v.status <> ? AND v.moderation_status <> ?", VisibilityPrivate, u.ID, StatusRejected, ModerationTakenDown)
+	}
+
+	var total int64
+	if err := base().Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count history", "details": err.Error()})
+		return
+	}
+
+	var rows []historyRow
+	err = base().
+		Select(catalogColumns + ", wh.position, wh.percent, wh.completed, wh.watched_at").
+		Order("wh.watched_at DESC").
+		Limit(perPage).
+		Offset((page - 1) * perPage).
+		Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch history", "details": err.Error()})
+		return
+	}
+
+	items := make([]gin.H, 0, len(rows))
+	for i := range rows {
+		r := &rows[i]
+		item := r.response()
+		item["position"] = r.Position
+		item["percent"] = r.Percent
+		item["completed"] = r.Completed
+		item["watched_at"] = r.WatchedAt
+		item["resume_at"] = resumeAt(&WatchHistory{Position: r.Position}, r.Duration)
+		items = append(items, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"page":     page,
+		"per_page": perPage,
+		"total":    total,
+		"history":  items,
+	})
+}
+
+// DeleteHistory очищает историю просмотра текущего пользователя.
+func (h *Handler) DeleteHistory(c *gin.Context) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.DB.Where("user_id = ?", u.ID).Delete(&WatchHistory{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete history", "details": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteHistoryEntry убирает одно видео из истории просмотра текущего пользователя.
+func (h *Handler) DeleteHistoryEntry(c *gin.Context) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	result := h.DB.Where("user_id = ? AND video_id = ?", u.ID, c.Param("videoID")).Delete(&WatchHistory{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete history", "details": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Video is not in the history"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
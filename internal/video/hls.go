@@ -0,0 +1,502 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toxanetoxa/gohls/internal/media"
+	"gorm.io/gorm"
+)
+
+// Папка с HLS-представлениями внутри MediaDir и инициализационный сегмент CMAF в папке представления
+const (
+	hlsDir      = "hls"
+	hlsInitName = "init.mp4"
+)
+
+// Битрейт видео в кбит/с для стандартных высот
+var ladderBitrates = map[int]int{
+	2160: 14000,
+	1440: 9000,
+	1080: 5000,
+	720:  2800,
+	480:  1400,
+	360:  800,
+	240:  400,
+}
+
+// Битрейт аудио в кбит/с
+const audioBitrate = 128
+
+// Типы представлений
+const (
+	RenditionVideo = "video"
+	RenditionAudio = "audio"
+)
+
+// Rendition - одно представление видео в HLS: качество из лестницы битрейтов или аудиодорожка.
+type Rendition struct {
+	ID          uint      `gorm:"primaryKey"`
+	VideoID     uint      `gorm:"not null"`
+	Type        string    `gorm:"not null;default:video"`
+	Name        string    `gorm:"not null"` // Например, 720p или audio_0
+	Width       int       `gorm:"not null"`
+	Height      int       `gorm:"not null"`
+	Bandwidth   int       `gorm:"not null"` // Пиковый битрейт в бит/с
+	Codecs      string    `gorm:"not null"`
+	Playlist    string    `gorm:"not null"` // Путь к плейлисту относительно папки hls
+	Language    string    // Только для аудио
+	Label       string    // Только для аудио
+	IsDefault   bool      // Только для аудио
+	StreamIndex int       // Номер аудиодорожки в исходнике
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+func (Rendition) TableName() string {
+	return "video_renditions"
+}
+
+// ladderFor возвращает высоты представлений, не превышающие высоту исходника.
+func ladderFor(sourceHeight int) []int {
+	var heights []int
+	for _, item := range hlsLadder {
+		height, err := strconv.Atoi(item)
+		if err == nil && height > 0 && height <= sourceHeight {
+			heights = append(heights, height)
+		}
+	}
+
+	// Исходник меньше самого низкого качества - упаковываем как есть
+	if len(heights) == 0 {
+		heights = append(heights, sourceHeight/2*2)
+	}
+	return heights
+}
+
+// videoBitrate возвращает битрейт видео в кбит/с для заданной высоты.
+func videoBitrate(height int) int {
+	if kbps, ok := ladderBitrates[height]; ok {
+		return kbps
+	}
+	return height * height / 230
+}
+
+// hlsStep перекодирует видео в лестницу качеств, а каждую аудиодорожку - в отдельное
+// аудиопредставление, и нарезает HLS-сегменты.
+func (h *Handler) hlsStep() Step {
+	return Step{
+		Name: "hls",
+		Run: func(ctx context.Context, v *Video) error {
+			probe, err := h.FFmpeg.Probe(ctx, v.FilePath)
+			if err != nil {
+				return err
+			}
+			stream := probe.VideoStream()
+			if stream == nil || stream.Height == 0 {
+				return errors.New("no video stream found")
+			}
+
+			// Переупаковка заменяет предыдущий результат целиком
+			if err := cleanHLSDir(v); err != nil {
+				return err
+			}
+
+			var renditions []Rendition
+			for _, height := range ladderFor(stream.Height) {
+				rendition, err := h.packageVideoRendition(ctx, v, height, stream.Width, stream.Height)
+				if err != nil {
+					return err
+				}
+				renditions = append(renditions, *rendition)
+			}
+
+			audioStreams := probe.AudioStreams()
+			defaultAudio := defaultAudioIndex(audioStreams)
+			for i, audio := range audioStreams {
+				rendition, err := h.packageAudioRendition(ctx, v, i, &audio, i == defaultAudio)
+				if err != nil {
+					return err
+				}
+				renditions = append(renditions, *rendition)
+			}
+
+			if h.Keys != nil {
+				if err := h.encryptRenditions(v, renditions); err != nil {
+					return err
+				}
+			}
+
+			err = h.DB.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Where("video_id = ?", v.ID).Delete(&Rendition{}).Error; err != nil {
+					return err
+				}
+				return tx.Create(&renditions).Error
+			})
+			if err != nil {
+				return err
+			}
+
+			// Лестница опубликована, быстрая публикация больше не нужна
+			scheduleQuickCleanup(v)
+			return nil
+		},
+	}
+}
+
+// hlsOutputArgs возвращает общие аргументы ffmpeg для нарезки в папку dir.
+// Сегменты CMAF (fMP4) используются и плейлистом HLS, и манифестом DASH.
+func hlsOutputArgs(dir string) []string {
+	return []string{
+		// Таймкоды с нуля, на это рассчитан X-TIMESTAMP-MAP в сегментах субтитров
+		"-muxdelay", "0",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(hlsSegmentDuration),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_type", "fmp4",
+		"-hls_fmp4_init_filename", hlsInitName,
+		"-hls_segment_filename", filepath.Join(dir, "seg_%05d.m4s"),
+		filepath.Join(dir, "index.m3u8"),
+	}
+}
+
+// packageVideoRendition кодирует видеопредставление заданной высоты (без звука,
+// аудио подключается группой #EXT-X-MEDIA в мастер-плейлисте).
+func (h *Handler) packageVideoRendition(ctx context.Context, v *Video, height, srcWidth, srcHeight int) (*Rendition, error) {
+	name := fmt.Sprintf("%dp", height)
+	dir := v.MediaPath(path.Join(hlsDir, name))
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	kbps := videoBitrate(height)
+	maxrate := kbps * 107 / 100
+
+	args := []string{
+		"-i", v.FilePath,
+		"-map", "0:v:0",
+		"-an",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-profile:v", "high",
+		"-level", "4.0",
+		"-vf", fmt.Sprintf("scale=-2:%d", height),
+		"-b:v", fmt.Sprintf("%dk", kbps),
+		"-maxrate", fmt.Sprintf("%dk", maxrate),
+		"-bufsize", fmt.Sprintf("%dk", kbps*3/2),
+		// Ключевой кадр на границе каждого сегмента, чтобы представления переключались без разрывов
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", hlsSegmentDuration),
+	}
+
+	if err := h.FFmpeg.Run(ctx, append(args, hlsOutputArgs(dir)...)...); err != nil {
+		return nil, err
+	}
+
+	return &Rendition{
+		VideoID:   v.ID,
+		Type:      RenditionVideo,
+		Name:      name,
+		Width:     srcWidth * height / srcHeight / 2 * 2,
+		Height:    height,
+		Bandwidth: maxrate * 1000,
+		Codecs:    "avc1.640028",
+		Playlist:  path.Join(name, "index.m3u8"),
+	}, nil
+}
+
+// packageAudioRendition кодирует index-ю аудиодорожку исходника в AAC-стерео.
+func (h *Handler) packageAudioRendition(ctx context.Context, v *Video, index int, stream *media.Stream, isDefault bool) (*Rendition, error) {
+	name := fmt.Sprintf("audio_%d", index)
+	dir := v.MediaPath(path.Join(hlsDir, name))
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"-i", v.FilePath,
+		"-map", fmt.Sprintf("0:a:%d", index),
+		"-vn",
+		"-c:a", "aac",
+		"-b:a", fmt.Sprintf("%dk", audioBitrate),
+		"-ac", "2",
+	}
+
+	if err := h.FFmpeg.Run(ctx, append(args, hlsOutputArgs(dir)...)...); err != nil {
+		return nil, err
+	}
+
+	language := media.ShortLanguage(stream.Language())
+	label := stream.Tags["title"]
+	if label == "" {
+		label = fmt.Sprintf("%s (%d)", language, index+1)
+	}
+
+	return &Rendition{
+		VideoID:     v.ID,
+		Type:        RenditionAudio,
+		Name:        name,
+		Language:    language,
+		Label:       label,
+		IsDefault:   isDefault,
+		StreamIndex: index,
+		Bandwidth:   audioBitrate * 1000,
+		Codecs:      "mp4a.40.2",
+		Playlist:    path.Join(name, "index.m3u8"),
+	}, nil
+}
+
+// defaultAudioIndex возвращает дорожку, помеченную в исходнике как основная, или первую.
+func defaultAudioIndex(streams []media.Stream) int {
+	for i, s := range streams {
+		if s.Disposition["default"] == 1 {
+			return i
+		}
+	}
+	return 0
+}
+
+// ServeHLS отдаёт мастер-плейлист, плейлисты субтитров и файлы представлений (плейлисты и сегменты CMAF).
+func (h *Handler) ServeHLS(c *gin.Context) {
+	// Путь с . и .. не принимаем: подпись проверяется по тому же пути, что и отдаётся
+	raw := c.Param("path")
+	if path.Clean(raw) != raw {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+
+	v, ok := h.loadWatchableVideo(c)
+	if !ok {
+		return
+	}
+
+	p := strings.TrimPrefix(raw, "/")
+	switch {
+	case p == "master.m3u8":
+		h.serveMasterPlaylist(c, v)
+	case strings.HasPrefix(p, subtitlesHLSDir+"/"):
+		h.serveSubtitleHLS(c, v, strings.TrimPrefix(p, subtitlesHLSDir+"/"))
+	default:
+		h.serveHLSFile(c, v, p)
+	}
+}
+
+func (h *Handler) serveMasterPlaylist(c *gin.Context, v *Video) {
+	playlist, err := h.buildMasterPlaylist(v)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build master playlist", "details": err.Error()})
+		return
+	}
+	if playlist == "" {
+		// Лестница качеств ещё не готова - отдаём быструю публикацию, если она есть
+		playlist = buildQuickMasterPlaylist(v)
+	}
+	if playlist == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "HLS is not ready yet"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(playlist))
+}
+
+// buildMasterPlaylist собирает мастер-плейлист из представлений, аудиодорожек и субтитров.
+// Пустая строка означает, что видео ещё не упаковано.
+func (h *Handler) buildMasterPlaylist(v *Video) (string, error) {
+	var renditions []Rendition
+	if err := h.DB.Where("video_id = ?", v.ID).Order("height DESC, stream_index").Find(&renditions).Error; err != nil {
+		return "", err
+	}
+
+	var videos, audios []Rendition
+	for _, r := range renditions {
+		if r.Type == RenditionAudio {
+			audios = append(audios, r)
+		} else {
+			videos = append(videos, r)
+		}
+	}
+	if len(videos) == 0 {
+		return "", nil
+	}
+
+	var tracks []SubtitleTrack
+	if err := h.DB.Where("video_id = ?", v.ID).Order("id").Find(&tracks).Error; err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+
+	// Аудиогруппа: видеопредставления без звука, звук выбирается отдельно
+	var defaultAudio *Rendition
+	audioBandwidth := 0
+	for i, a := range audios {
+		fmt.Fprintf(&b, "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",NAME=%s,LANGUAGE=%s,DEFAULT=%s,AUTOSELECT=YES,CHANNELS=\"2\",URI=%s\n",
+			quoteAttr(a.Label), quoteAttr(a.Language), yesNo(a.IsDefault), quoteAttr(a.Playlist))
+		if a.IsDefault || defaultAudio == nil {
+			defaultAudio = &audios[i]
+		}
+		if a.Bandwidth > audioBandwidth {
+			audioBandwidth = a.Bandwidth
+		}
+	}
+
+	for _, t := range tracks {
+		fmt.Fprintf(&b, "#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"subs\",NAME=%s,LANGUAGE=%s,DEFAULT=%s,AUTOSELECT=YES,URI=\"%s/%d/index.m3u8\"\n",
+			quoteAttr(t.Label), quoteAttr(t.Language), yesNo(t.IsDefault), subtitlesHLSDir, t.ID)
+	}
+
+	groups := ""
+	if len(audios) > 0 {
+		groups += ",AUDIO=\"audio\""
+	}
+	if len(tracks) > 0 {
+		groups += ",SUBTITLES=\"subs\""
+	}
+
+	for _, r := range videos {
+		codecs := r.Codecs
+		if defaultAudio != nil {
+			codecs += "," + defaultAudio.Codecs
+		}
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,CODECS=%s%s\n%s\n",
+			r.Bandwidth+audioBandwidth, r.Width, r.Height, quoteAttr(codecs), groups, r.Playlist)
+	}
+
+	// Вариант только со звуком для мобильного режима "только аудио"
+	if defaultAudio != nil {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=%s,AUDIO=\"audio\"\n%s\n",
+			audioBandwidth, quoteAttr(defaultAudio.Codecs), defaultAudio.Playlist)
+	}
+
+	return b.String(), nil
+}
+
+// serveHLSFile отдаёт плейлист или сегмент представления с диска.
+func (h *Handler) serveHLSFile(c *gin.Context, v *Video, p string) {
+	if p == "" || strings.HasPrefix(p, "..") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+
+	filePath := v.MediaPath(path.Join(hlsDir, p))
+	if _, err := os.Stat(filePath); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	c.Header("Content-Type", hlsContentType(p))
+	if path.Ext(p) != ".m3u8" {
+		c.Header("Cache-Control", cacheControl(v, 365*24*time.Hour, "immutable"))
+		c.File(filePath)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	if h.Signer == nil {
+		c.File(filePath)
+		return
+	}
+
+	// Подписываем ссылки на сегменты: одна подпись на префикс hls/ этого видео
+	lines, err := readLines(filePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read playlist", "details": err.Error()})
+		return
+	}
+	query := h.Signer.Sign(hlsURLPrefix(v.ID), c.ClientIP()).Encode()
+	c.Data(http.StatusOK, hlsContentType(p), []byte(signPlaylist(lines, query)))
+}
+
+// signPlaylist дописывает параметры подписи к URI сегментов и #EXT-X-MAP.
+func signPlaylist(lines []string, query string) string {
+	var b strings.Builder
+	for _, line := range lines {
+		switch {
+		case line != "" && !strings.HasPrefix(line, "#"):
+			line += "?" + query
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			line = signURIAttr(line, query)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// signURIAttr дописывает подпись к атрибуту URI="..." строки-тега.
+func signURIAttr(line, query string) string {
+	start := strings.Index(line, `URI="`)
+	if start < 0 {
+		return line
+	}
+	end := strings.Index(line[start+5:], `"`)
+	if end < 0 {
+		return line
+	}
+	end += start + 5
+	return line[:end] + "?" + query + line[end:]
+}
+
+// hlsURLPrefix - подписываемый префикс пути всех файлов HLS видео.
+func hlsURLPrefix(videoID uint) string {
+	return fmt.Sprintf("/videos/%d/%s/", videoID, hlsDir)
+}
+
+// HLSSignedPrefix возвращает префикс подписи для запроса к HLS. Плейлисты и сегменты
+// субтитров собираются приложением и подписи не требуют, сегменты видео и аудио - требуют.
+// Путь, который меняется при нормализации (subs/../720p/...), всегда требует подписи.
+func HLSSignedPrefix(c *gin.Context) string {
+	videoID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return ""
+	}
+	prefix := hlsURLPrefix(uint(videoID))
+
+	raw := c.Param("path")
+	p := path.Clean(raw)
+	if p != raw {
+		return prefix
+	}
+	if path.Ext(p) == ".m3u8" || strings.HasPrefix(p, "/"+subtitlesHLSDir+"/") {
+		return ""
+	}
+	return prefix
+}
+
+func hlsContentType(p string) string {
+	switch path.Ext(p) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	case ".m4s":
+		return "video/iso.segment"
+	case ".mp4":
+		return "video/mp4"
+	case ".vtt":
+		return "text/vtt"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
+
+// quoteAttr оформляет строковый атрибут плейлиста: кавычки и переводы строк в нём недопустимы.
+func quoteAttr(s string) string {
+	s = strings.NewReplacer("\"", "'", "\n", " ", "\r", " ").Replace(s)
+	return "\"" + s + "\""
+}
@@ -0,0 +1,54 @@
+package video
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHLSSignedPrefix(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "master playlist", path: "/master.m3u8", want: ""},
+		{name: "rendition playlist", path: "/720p/index.m3u8", want: ""},
+		{name: "subtitle segment", path: "/subs/3/seg_00000.vtt", want: ""},
+		{name: "video segment", path: "/720p/seg_00000.m4s", want: "/videos/1/hls/"},
+		{name: "init segment", path: "/720p/init.mp4", want: "/videos/1/hls/"},
+		{name: "segment through subs", path: "/subs/../720p/seg_00000.m4s", want: "/videos/1/hls/"},
+		{name: "playlist through subs", path: "/subs/../720p/index.m3u8", want: "/videos/1/hls/"},
+		{name: "dot segment", path: "/subs/./3/seg_00000.vtt", want: "/videos/1/hls/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Params = gin.Params{{Key: "id", Value: "1"}, {Key: "path", Value: tt.path}}
+			if got := HLSSignedPrefix(c); got != tt.want {
+				t.Fatalf("HLSSignedPrefix(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeHLSRejectsUncleanPath(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Путь проверяется раньше, чем видео ищется в базе, поэтому обработчику база не нужна
+	h := &Handler{}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/videos/1/hls/subs/../720p/seg_00000.m4s", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}, {Key: "path", Value: "/subs/../720p/seg_00000.m4s"}}
+
+	h.ServeHLS(c)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,249 @@
+package video
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ContentKey - ключ шифрования сегментов видео. Хранится зашифрованным мастер-ключом.
+type ContentKey struct {
+	ID           uint      `gorm:"primaryKey"`
+	VideoID      uint      `gorm:"not null"`
+	KID          string    `gorm:"column:kid;unique;not null"` // Идентификатор ключа в URI
+	IV           string    `gorm:"column:iv;not null"`         // Вектор инициализации в hex
+	EncryptedKey []byte    `gorm:"not null"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+func (ContentKey) TableName() string {
+	return "video_keys"
+}
+
+// KeyVault шифрует ключи контента мастер-ключом (AES-256-GCM) для хранения в базе.
+type KeyVault struct {
+	aead cipher.AEAD
+}
+
+// NewKeyVault создаёт хранилище по мастер-ключу в hex (32 байта).
+func NewKeyVault(masterKeyHex string) (*KeyVault, error) {
+	masterKey, err := hex.DecodeString(masterKeyHex)
+	if err != nil || len(masterKey) != 32 {
+		return nil, errors.New("master key must be 32 bytes in hex")
+	}
+
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyVault{aead: aead}, nil
+}
+
+// Seal шифрует ключ контента, kid используется как дополнительные данные,
+// чтобы зашифрованный ключ нельзя было подставить под другой идентификатор.
+func (kv *KeyVault) Seal(kid string, key []byte) ([]byte, error) {
+	nonce := make([]byte, kv.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return kv.aead.Seal(nonce, nonce, key, []byte(kid)), nil
+}
+
+// Open расшифровывает ключ контента.
+func (kv *KeyVault) Open(kid string, sealed []byte) ([]byte, error) {
+	size := kv.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, errors.New("sealed key is too short")
+	}
+	return kv.aead.Open(nil, sealed[:size], sealed[size:], []byte(kid))
+}
+
+// encryptRenditions шифрует сегменты всех представлений методом AES-128
+// и прописывает #EXT-X-KEY в их плейлисты. Сегменты представлений выровнены по времени,
+// поэтому N-й ключ используется для одних и тех же сегментов во всех представлениях.
+func (h *Handler) encryptRenditions(v *Video, renditions []Rendition) error {
+	playlists := make([][]string, len(renditions))
+	maxSegments := 0
+	for i, r := range renditions {
+		lines, err := readLines(v.MediaPath(path.Join(hlsDir, r.Playlist)))
+		if err != nil {
+			return err
+		}
+		playlists[i] = lines
+		if n := countSegments(lines); n > maxSegments {
+			maxSegments = n
+		}
+	}
+
+	perKey := hlsKeyRotation
+	if perKey <= 0 {
+		perKey = maxSegments
+	}
+	if perKey == 0 {
+		return nil
+	}
+
+	keys, err := h.createContentKeys(v, (maxSegments+perKey-1)/perKey)
+	if err != nil {
+		return err
+	}
+
+	for i, r := range renditions {
+		dir := path.Dir(r.Playlist)
+		var out []string
+		segment := 0
+		for _, line := range playlists[i] {
+			if strings.HasPrefix(line, "#EXTINF") && segment%perKey == 0 {
+				k := keys[segment/perKey]
+				out = append(out, fmt.Sprintf("#EXT-X-KEY:METHOD=AES-128,URI=\"/videos/%d/keys/%s\",IV=0x%s", v.ID, k.kid, hex.EncodeToString(k.iv)))
+			}
+			if line != "" && !strings.HasPrefix(line, "#") {
+				k := keys[segment/perKey]
+				if err := encryptSegment(v.MediaPath(path.Join(hlsDir, dir, line)), k.key, k.iv); err != nil {
+					return err
+				}
+				segment++
+			}
+			out = append(out, line)
+		}
+
+		playlistPath := v.MediaPath(path.Join(hlsDir, r.Playlist))
+		if err := os.WriteFile(playlistPath, []byte(strings.Join(out, "\n")+"\n"), 0o644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type plainKey struct {
+	kid string
+	key []byte
+	iv  []byte
+}
+
+// createContentKeys генерирует count ключей, заменяя ранее выданные ключи видео.
+func (h *Handler) createContentKeys(v *Video, count int) ([]plainKey, error) {
+	var keys []plainKey
+	var records []ContentKey
+	for i := 0; i < count; i++ {
+		buf := make([]byte, 48)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		k := plainKey{kid: hex.EncodeToString(buf[:16]), key: buf[16:32], iv: buf[32:48]}
+
+		sealed, err := h.Keys.Seal(k.kid, k.key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+		records = append(records, ContentKey{VideoID: v.ID, KID: k.kid, IV: hex.EncodeToString(k.iv), EncryptedKey: sealed})
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("video_id = ?", v.ID).Delete(&ContentKey{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+	return keys, err
+}
+
+// encryptSegment шифрует файл сегмента на месте: AES-128-CBC с дополнением PKCS#7, как требует HLS.
+func encryptSegment(filePath string, key, iv []byte) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	data = append(data, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	tmp := filePath + ".enc"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filePath)
+}
+
+func readLines(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+func countSegments(lines []string) int {
+	n := 0
+	for _, line := range lines {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			n++
+		}
+	}
+	return n
+}
+
+// GetContentKey отдаёт ключ сегментов зрителю, прошедшему проверку видимости и прав доступа.
+func (h *Handler) GetContentKey(c *gin.Context) {
+	v, ok := h.loadWatchableVideo(c)
+	if !ok {
+		return
+	}
+
+	if h.Keys == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Key not found"})
+		return
+	}
+
+	var record ContentKey
+	if err := h.DB.Where("video_id = ? AND kid = ?", v.ID, c.Param("kid")).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Key not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch key", "details": err.Error()})
+		return
+	}
+
+	key, err := h.Keys.Open(record.KID, record.EncryptedKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt key"})
+		return
+	}
+
+	// Ключ нельзя кешировать промежуточным прокси: доступ проверяется для каждого зрителя
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, "application/octet-stream", key)
+}
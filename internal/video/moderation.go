@@ -0,0 +1,578 @@
+package video
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Состояние модерации видео
+const (
+	ModerationNone      = ""
+	ModerationHidden    = "hidden"     // Убрано из списков, поиска и лент, доступно по ссылке
+	ModerationTakenDown = "taken_down" // Снято: файлы не отдаются никому, 451
+)
+
+// Объекты жалоб
+const (
+	ReportTargetVideo   = "video"
+	ReportTargetComment = "comment"
+)
+
+// Статусы жалоб
+const (
+	ReportOpen      = "open"
+	ReportActioned  = "actioned"  // Модератор принял меры
+	ReportDismissed = "dismissed" // Модератор отклонил жалобу
+)
+
+// Решения модератора
+const (
+	ModActionHide        = "hide"
+	ModActionAgeRestrict = "age_restrict" // Только стена входа: возраст пользователей сервис не знает
+	ModActionTakedown    = "takedown"
+	ModActionDismiss     = "dismiss"
+	ModActionRestore     = "restore" // Снимает с видео все ограничения модерации
+)
+
+// Причины жалоб
+var reportReasons = map[string]bool{
+	"spam":           true,
+	"harassment":     true,
+	"hate":           true,
+	"violence":       true,
+	"sexual":         true,
+	"child_safety":   true,
+	"copyright":      true,
+	"misinformation": true,
+	"other":          true,
+}
+
+// Решения, допустимые для каждого объекта жалобы
+var moderationActions = map[string]map[string]bool{
+	ReportTargetVideo: {
+		ModActionHide:        true,
+		ModActionAgeRestrict: true,
+		ModActionTakedown:    true,
+		ModActionDismiss:     true,
+		ModActionRestore:     true,
+	},
+	ReportTargetComment: {
+		ModActionHide:    true,
+		ModActionDismiss: true,
+	},
+}
+
+const maxReportDetailsLength = 1000
+
+// Report - жалоба пользователя на видео или комментарий. Открытая жалоба от пользователя на объект одна.
+type Report struct {
+	ID         uint   `gorm:"primaryKey"`
+	ReporterID uint   `gorm:"not null"`
+	TargetType string `gorm:"not null"` // video или comment
+	TargetID   uint   `gorm:"not null"`
+	VideoID    uint   `gorm:"not null"` // Видео жалобы или видео, к которому оставлен комментарий
+	Reason     string `gorm:"not null"`
+	Details    string `gorm:"not null;default:''"`
+	Status     string `gorm:"not null;default:open"`
+	ActionID   *uint  // Решение модератора, закрывшее жалобу
+	ResolvedAt *time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+// ModerationAction - запись журнала решений модераторов.
+type ModerationAction struct {
+	ID          uint      `gorm:"primaryKey"`
+	ModeratorID uint      `gorm:"not null"`
+	TargetType  string    `gorm:"not null"`
+	TargetID    uint      `gorm:"not null"`
+	Action      string    `gorm:"not null"`
+	Reason      string    `gorm:"not null;default:''"` // Пояснение модератора, для видео видно автору
+	Snapshot    string    `gorm:"not null;default:''"` // Текст скрытого комментария
+	Reports     int64     `gorm:"not null;default:0"`  // Сколько открытых жалоб закрыло решение
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+func (a *ModerationAction) response() gin.H {
+	return gin.H{
+		"id":           a.ID,
+		"moderator_id": a.ModeratorID,
+		"target_type":  a.TargetType,
+		"target_id":    a.TargetID,
+		"action":       a.Action,
+		"reason":       a.Reason,
+		"snapshot":     a.Snapshot,
+		"reports":      a.Reports,
+		"created_at":   a.CreatedAt,
+	}
+}
+
+type ReportRequest struct {
+	Reason  string `json:"reason" binding:"required"`
+	Details string `json:"details"`
+}
+
+type ModerateRequest struct {
+	Action string `json:"action" binding:"required"`
+	Reason string `json:"reason"`
+}
+
+// bindReport разбирает и проверяет жалобу.
+func bindReport(c *gin.Context) (*ReportRequest, bool) {
+	var req ReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if !reportReasons[req.Reason] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown report reason", "reason": req.Reason})
+		return nil, false
+	}
+	req.Details = strings.TrimSpace(req.Details)
+	if len([]rune(req.Details)) > maxReportDetailsLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Details must not exceed %d characters", maxReportDetailsLength)})
+		return nil, false
+	}
+	if req.Reason == "other" && req.Details == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Details are required for reason other"})
+		return nil, false
+	}
+	return &req, true
+}
+
+// saveReport создаёт жалобу. Повторная жалоба на тот же объект, пока первая открыта, заменяет её причину.
+func (h *Handler) saveReport(c *gin.Context, report *Report) {
+	err := h.DB.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "reporter_id"}, {Name: "target_type"}, {Name: "target_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "status = '" + ReportOpen + "'"}}},
+		DoUpdates:   clause.AssignmentColumns([]string{"reason", "details"}),
+	}).Create(report).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save report", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"report_id": report.ID, "status": ReportOpen})
+}
+
+// ReportVideo принимает жалобу на видео.
+func (h *Handler) ReportVideo(c *gin.Context) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireViewer(c, v) {
+		return
+	}
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if v.AuthorID == u.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot report your own video"})
+		return
+	}
+	req, ok := bindReport(c)
+	if !ok {
+		return
+	}
+
+	h.saveReport(c, &Report{
+		ReporterID: u.ID,
+		TargetType: ReportTargetVideo,
+		TargetID:   v.ID,
+		VideoID:    v.ID,
+		Reason:     req.Reason,
+		Details:    req.Details,
+	})
+}
+
+// ReportComment принимает жалобу на комментарий.
+func (h *Handler) ReportComment(c *gin.Context) {
+	comment, _, ok := h.loadComment(c)
+	if !ok {
+		return
+	}
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if comment.DeletedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+	if comment.AuthorID == u.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot report your own comment"})
+		return
+	}
+	req, ok := bindReport(c)
+	if !ok {
+		return
+	}
+
+	h.saveReport(c, &Report{
+		ReporterID: u.ID,
+		TargetType: ReportTargetComment,
+		TargetID:   comment.ID,
+		VideoID:    comment.VideoID,
+		Reason:     req.Reason,
+		Details:    req.Details,
+	})
+}
+
+// reportTarget разбирает объект жалобы из параметров :type и :id.
+func reportTarget(c *gin.Context) (string, uint, bool) {
+	targetType := c.Param("type")
+	if _, ok := moderationActions[targetType]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be video or comment"})
+		return "", 0, false
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target ID"})
+		return "", 0, false
+	}
+	return targetType, uint(id), true
+}
+
+// queueRow - жалобы на один объект, сгруппированные для очереди модерации.
+type queueRow struct {
+	TargetType      string
+	TargetID        uint
+	VideoID         uint
+	Reports         int64
+	Reasons         string
+	FirstReportedAt time.Time
+	LastReportedAt  time.Time
+}
+
+// ListReports отдаёт очередь модерации: жалобы, сгруппированные по объекту, сначала объекты с большим
+// числом жалоб. status: open (по умолчанию), actioned или dismissed; type: video или comment.
+func (h *Handler) ListReports(c *gin.Context) {
+	page, perPage, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	status := c.DefaultQuery("status", ReportOpen)
+	if status != ReportOpen && status != ReportActioned && status != ReportDismissed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be open, actioned or dismissed"})
+		return
+	}
+	base := func() *gorm.DB {
+		q := h.DB.Table("reports r").Where("r.status = ?", status)
+		if t := c.Query("type"); t != "" {
+			q = q.Where("r.target_type = ?", t)
+		}
+		return q.Group("r.target_type, r.target_id")
+	}
+
+	var total int64
+	if err := h.DB.Table("(?) g", base().Select("1")).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count reports", "details": err.Error()})
+		return
+	}
+
+	var rows []queueRow
+	err := base().
+		Select(`r.target_type, r.target_id, MAX(r.video_id) AS video_id, COUNT(*) AS reports,
+			STRING_AGG(DISTINCT r.reason, ',') AS reasons,
+			MIN(r.created_at) AS first_reported_at, MAX(r.created_at) AS last_reported_at`).
+		Order("reports DESC, last_reported_at DESC").
+		Limit(perPage).
+		Offset((page - 1) * perPage).
+		Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reports", "details": err.Error()})
+		return
+	}
+
+	targets, err := h.reportTargets(rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reported content", "details": err.Error()})
+		return
+	}
+
+	items := make([]gin.H, 0, len(rows))
+	for _, r := range rows {
+		items = append(items, gin.H{
+			"target_type":       r.TargetType,
+			"target_id":         r.TargetID,
+			"video_id":          r.VideoID,
+			"reports":           r.Reports,
+			"reasons":           strings.Split(r.Reasons, ","),
+			"first_reported_at": r.FirstReportedAt,
+			"last_reported_at":  r.LastReportedAt,
+			"target":            targets[r.TargetType+":"+strconv.FormatUint(uint64(r.TargetID), 10)],
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"page":     page,
+		"per_page": perPage,
+		"total":    total,
+		"queue":    items,
+	})
+}
+
+// reportTargets загружает краткое описание видео и комментариев очереди, ключ - "тип:id".
+func (h *Handler) reportTargets(rows []queueRow) (map[string]gin.H, error) {
+	var videoIDs, commentIDs []uint
+	for _, r := range rows {
+		if r.TargetType == ReportTargetVideo {
+			videoIDs = append(videoIDs, r.TargetID)
+		} else {
+			commentIDs = append(commentIDs, r.TargetID)
+		}
+	}
+
+	targets := make(map[string]gin.H, len(rows))
+	if len(videoIDs) > 0 {
+		var videos []Video
+		err := h.DB.Select("id", "title", "author_id", "visibility", "moderation_status", "age_restricted").
+			Where("id IN ?", videoIDs).Find(&videos).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range videos {
+			targets[fmt.Sprintf("%s:%d", ReportTargetVideo, v.ID)] = gin.H{
+				"title":             v.Title,
+				"author_id":         v.AuthorID,
+				"visibility":        v.Visibility,
+				"moderation_status": v.ModerationStatus,
+				"age_restricted":    v.AgeRestricted,
+			}
+		}
+	}
+	if len(commentIDs) > 0 {
+		var comments []Comment
+		if err := h.DB.Where("id IN ?", commentIDs).Find(&comments).Error; err != nil {
+			return nil, err
+		}
+		for _, cm := range comments {
+			targets[fmt.Sprintf("%s:%d", ReportTargetComment, cm.ID)] = gin.H{
+				"body":      cm.Body,
+				"author_id": cm.AuthorID,
+				"deleted":   cm.DeletedAt != nil,
+			}
+		}
+	}
+	return targets, nil
+}
+
+// reportRow - жалоба вместе с именем автора.
+type reportRow struct {
+	Report
+	ReporterName string
+}
+
+// ListTargetReports отдаёт все жалобы на объект и решения модераторов по нему.
+func (h *Handler) ListTargetReports(c *gin.Context) {
+	targetType, targetID, ok := reportTarget(c)
+	if !ok {
+		return
+	}
+
+	var reports []reportRow
+	err := h.DB.Table("reports r").
+		Select("r.*, u.username AS reporter_name").
+		Joins("LEFT JOIN users u ON u.id = r.reporter_id").
+		Where("r.target_type = ? AND r.target_id = ?", targetType, targetID).
+		Order("r.id DESC").
+		Scan(&reports).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reports", "details": err.Error()})
+		return
+	}
+
+	var actions []ModerationAction
+	if err := h.DB.Where("target_type = ? AND target_id = ?", targetType, targetID).Order("id DESC").Find(&actions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch moderation actions", "details": err.Error()})
+		return
+	}
+
+	reportItems := make([]gin.H, 0, len(reports))
+	for _, r := range reports {
+		reportItems = append(reportItems, gin.H{
+			"id":            r.ID,
+			"reporter_id":   r.ReporterID,
+			"reporter_name": r.ReporterName,
+			"reason":        r.Reason,
+			"details":       r.Details,
+			"status":        r.Status,
+			"action_id":     r.ActionID,
+			"resolved_at":   r.ResolvedAt,
+			"created_at":    r.CreatedAt,
+		})
+	}
+	actionItems := make([]gin.H, 0, len(actions))
+	for i := range actions {
+		actionItems = append(actionItems, actions[i].response())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"target_type": targetType,
+		"target_id":   targetID,
+		"reports":     reportItems,
+		"actions":     actionItems,
+	})
+}
+
+// Moderate применяет решение модератора к видео или комментарию, закрывает открытые жалобы на него
+// и записывает решение в журнал.
+func (h *Handler) Moderate(c *gin.Context) {
+	targetType, targetID, ok := reportTarget(c)
+	if !ok {
+		return
+	}
+	moderator, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req ModerateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !moderationActions[targetType][req.Action] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Action %q is not available for %s", req.Action, targetType)})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	action := ModerationAction{
+		ModeratorID: moderator.ID,
+		TargetType:  targetType,
+		TargetID:    targetID,
+		Action:      req.Action,
+		Reason:      req.Reason,
+	}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if targetType == ReportTargetVideo {
+			err = applyVideoAction(tx, targetID, req.Action, req.Reason)
+		} else {
+			action.Snapshot, err = applyCommentAction(tx, targetID, req.Action)
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&action).Error; err != nil {
+			return err
+		}
+		if req.Action == ModActionRestore {
+			return nil
+		}
+
+		status := ReportActioned
+		if req.Action == ModActionDismiss {
+			status = ReportDismissed
+		}
+		result := tx.Model(&Report{}).
+			Where("target_type = ? AND target_id = ? AND status = ?", targetType, targetID, ReportOpen).
+			Updates(map[string]interface{}{"status": status, "action_id": action.ID, "resolved_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		action.Reports = result.RowsAffected
+		return tx.Model(&action).Update("reports", action.Reports).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reported content not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply moderation action", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, action.response())
+}
+
+// applyVideoAction меняет состояние модерации видео.
+func applyVideoAction(tx *gorm.DB, videoID uint, action, reason string) error {
+	var v Video
+	if err := tx.Select("id").First(&v, videoID).Error; err != nil {
+		return err
+	}
+
+	var updates map[string]interface{}
+	switch action {
+	case ModActionHide:
+		updates = map[string]interface{}{"moderation_status": ModerationHidden, "moderation_reason": reason}
+	case ModActionTakedown:
+		updates = map[string]interface{}{"moderation_status": ModerationTakenDown, "moderation_reason": reason}
+	case ModActionAgeRestrict:
+		updates = map[string]interface{}{"age_restricted": true, "moderation_reason": reason}
+	case ModActionRestore:
+		updates = map[string]interface{}{"moderation_status": ModerationNone, "age_restricted": false, "moderation_reason": ""}
+	default:
+		return nil
+	}
+	return tx.Model(&v).Updates(updates).Error
+}
+
+// applyCommentAction скрывает комментарий и возвращает его текст для журнала.
+func applyCommentAction(tx *gorm.DB, commentID uint, action string) (string, error) {
+	var comment Comment
+	if err := tx.First(&comment, commentID).Error; err != nil {
+		return "", err
+	}
+	if action != ModActionHide || comment.DeletedAt != nil {
+		return comment.Body, nil
+	}
+	return comment.Body, eraseComment(tx, &comment)
+}
+
+// ListModerationActions отдаёт журнал решений модераторов, последние первыми.
+// Фильтры: target_type, target_id, moderator_id.
+func (h *Handler) ListModerationActions(c *gin.Context) {
+	page, perPage, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	base := func() *gorm.DB {
+		q := h.DB.Model(&ModerationAction{})
+		if t := c.Query("target_type"); t != "" {
+			q = q.Where("target_type = ?", t)
+		}
+		if id := c.Query("target_id"); id != "" {
+			q = q.Where("target_id = ?", id)
+		}
+		if id := c.Query("moderator_id"); id != "" {
+			q = q.Where("moderator_id = ?", id)
+		}
+		return q
+	}
+
+	var total int64
+	if err := base().Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count moderation actions", "details": err.Error()})
+		return
+	}
+
+	var actions []ModerationAction
+	if err := base().Order("id DESC").Limit(perPage).Offset((page - 1) * perPage).Find(&actions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch moderation actions", "details": err.Error()})
+		return
+	}
+
+	items := make([]gin.H, 0, len(actions))
+	for i := range actions {
+		items = append(items, actions[i].response())
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"page":     page,
+		"per_page": perPage,
+		"total":    total,
+		"actions":  items,
+	})
+}
@@ -0,0 +1,390 @@
+package video
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toxanetoxa/gohls/pkg/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Виды уведомлений. Каждый вид можно отключить в настройках.
+const (
+	NotifyVideoReady    = "video_ready"    // Видео обработано
+	NotifyVideoFailed   = "video_failed"   // Обработка видео не удалась
+	NotifyVideoRejected = "video_rejected" // Видео отклонено проверкой
+	NotifyComment       = "comment"        // Новый комментарий к видео пользователя
+	NotifyReply         = "reply"          // Ответ на комментарий пользователя
+	NotifyNewVideo      = "new_video"      // Новое видео канала из подписок
+)
+
+var notificationKinds = []string{
+	NotifyVideoReady, NotifyVideoFailed, NotifyVideoRejected, NotifyComment, NotifyReply, NotifyNewVideo,
+}
+
+// Notifier сообщает пользователям о событиях с видео и комментариями.
+type Notifier interface {
+	VideoRejected(v *Video, reason string)
+	// VideoProcessed вызывается после обработки, v.Status - ready или failed
+	VideoProcessed(v *Video)
+	// VideoPublished вызывается, когда видео могло стать публичным и готовым: после обработки и смены видимости
+	VideoPublished(v *Video)
+	// CommentPosted вызывается после публикации комментария; parent - комментарий, на который ответили, или nil
+	CommentPosted(v *Video, comment *Comment, parent *Comment)
+}
+
+// Notification - уведомление пользователя.
+type Notification struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null"`
+	Kind      string `gorm:"not null"`
+	VideoID   *uint
+	CommentID *uint
+	ActorID   *uint  // Пользователь, вызвавший событие
+	Text      string `gorm:"not null"`
+	ReadAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (n *Notification) response() gin.H {
+	return gin.H{
+		"id":         n.ID,
+		"kind":       n.Kind,
+		"video_id":   n.VideoID,
+		"comment_id": n.CommentID,
+		"actor_id":   n.ActorID,
+		"text":       n.Text,
+		"read":       n.ReadAt != nil,
+		"read_at":    n.ReadAt,
+		"created_at": n.CreatedAt,
+	}
+}
+
+// NotificationPreference - отключённый или включённый вид уведомлений. Без записи вид включён.
+type NotificationPreference struct {
+	UserID  uint   `gorm:"primaryKey;autoIncrement:false"`
+	Kind    string `gorm:"primaryKey"`
+	Enabled bool   `gorm:"not null"`
+}
+
+// userRoom - комната WebSocket с личными уведомлениями пользователя.
+func userRoom(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// NotificationCenter сохраняет уведомления и сразу отправляет их в личную комнату WebSocket пользователя.
+type NotificationCenter struct {
+	DB    *gorm.DB
+	Rooms *ActiveViewers
+}
+
+// enabled проверяет, не отключил ли пользователь этот вид уведомлений.
+func (nc *NotificationCenter) enabled(userID uint, kind string) bool {
+	var prefs []NotificationPreference
+	if err := nc.DB.Where("user_id = ? AND kind = ?", userID, kind).Limit(1).Find(&prefs).Error; err != nil {
+		logger.Logger.Errorw("Failed to fetch notification preferences", "user_id", userID, "error", err)
+		return true
+	}
+	return len(prefs) == 0 || prefs[0].Enabled
+}
+
+// push отправляет уведомление в WebSocket пользователя, если он подключён.
+func (nc *NotificationCenter) push(n *Notification) {
+	nc.Rooms.Send(userRoom(n.UserID), gin.H{"type": "notification", "notification": n.response()})
+}
+
+// notify сохраняет и отправляет уведомление с учётом настроек пользователя.
+func (nc *NotificationCenter) notify(n Notification) {
+	if !nc.enabled(n.UserID, n.Kind) {
+		return
+	}
+	if err := nc.DB.Create(&n).Error; err != nil {
+		logger.Logger.Errorw("Failed to save notification", "user_id", n.UserID, "kind", n.Kind, "error", err)
+		return
+	}
+	nc.push(&n)
+}
+
+func (nc *NotificationCenter) VideoRejected(v *Video, reason string) {
+	logger.Logger.Warnw("Video rejected", "video_id", v.ID, "author_id", v.AuthorID, "reason", reason)
+	nc.notify(Notification{
+		UserID:  v.AuthorID,
+		Kind:    NotifyVideoRejected,
+		VideoID: &v.ID,
+		Text:    fmt.Sprintf("Your video %q was rejected: %s", v.Title, reason),
+	})
+}
+
+func (nc *NotificationCenter) VideoProcessed(v *Video) {
+	if v.Status != StatusReady {
+		nc.notify(Notification{
+			UserID:  v.AuthorID,
+			Kind:    NotifyVideoFailed,
+			VideoID: &v.ID,
+			Text:    fmt.Sprintf("Processing of your video %q failed", v.Title),
+		})
+		return
+	}
+
+	nc.notify(Notification{
+		UserID:  v.AuthorID,
+		Kind:    NotifyVideoReady,
+		VideoID: &v.ID,
+		Text:    fmt.Sprintf("Your video %q is ready", v.Title),
+	})
+	nc.VideoPublished(v)
+}
+
+// VideoPublished уведомляет подписчиков, если видео впервые стало публичным и готовым.
+// Отметка published_at ставится условным UPDATE, поэтому уведомление уходит один раз,
+// даже если видео скрывали и снова открывали или вызовы пришли одновременно.
+func (nc *NotificationCenter) VideoPublished(v *Video) {
+	res := nc.DB.Model(&Video{}).
+		Where("id = ? AND published_at IS NULL AND visibility = ? AND status = ? AND moderation_status = ?",
+			v.ID, VisibilityPublic, StatusReady, ModerationNone).
+		UpdateColumn("published_at", time.Now())
+	if res.Error != nil {
+		logger.Logger.Errorw("Failed to mark video as published", "video_id", v.ID, "error", res.Error)
+		return
+	}
+	if res.RowsAffected == 0 {
+		return
+	}
+	nc.notifySubscribers(v)
+}
+
+// notifySubscribers одним запросом создаёт уведомления всем подписчикам канала, не отключившим их.
+func (nc *NotificationCenter) notifySubscribers(v *Video) {
+	var created []Notification
+	err := nc.DB.Raw(`
+		INSERT INTO notifications (user_id, kind, video_id, actor_id, text, created_at)
+		SELECT s.subscriber_id, ?, ?, ?, ?, NOW()
+		FROM subscriptions s
+		WHERE s.channel_id = ? AND NOT EXISTS (
+			SELECT 1 FROM notification_preferences p
+			WHERE p.user_id = s.subscriber_id AND p.kind = ? AND NOT p.enabled)
+		RETURNING *`,
+		NotifyNewVideo, v.ID, v.AuthorID, fmt.Sprintf("New video: %q", v.Title), v.AuthorID, NotifyNewVideo,
+	).Scan(&created).Error
+	if err != nil {
+		logger.Logger.Errorw("Failed to notify subscribers", "video_id", v.ID, "error", err)
+		return
+	}
+	for i := range created {
+		nc.push(&created[i])
+	}
+}
+
+func (nc *NotificationCenter) CommentPosted(v *Video, comment *Comment, parent *Comment) {
+	if parent != nil && parent.AuthorID != comment.AuthorID {
+		nc.notify(Notification{
+			UserID:    parent.AuthorID,
+			Kind:      NotifyReply,
+			VideoID:   &v.ID,
+			CommentID: &comment.ID,
+			ActorID:   &comment.AuthorID,
+			Text:      fmt.Sprintf("New reply to your comment on %q", v.Title),
+		})
+	}
+	// Автор видео, которому ответили на его же комментарий, получает одно уведомление об ответе
+	if v.AuthorID != comment.AuthorID && (parent == nil || parent.AuthorID != v.AuthorID) {
+		nc.notify(Notification{
+			UserID:    v.AuthorID,
+			Kind:      NotifyComment,
+			VideoID:   &v.ID,
+			CommentID: &comment.ID,
+			ActorID:   &comment.AuthorID,
+			Text:      fmt.Sprintf("New comment on your video %q", v.Title),
+		})
+	}
+}
+
+// ListNotifications отдаёт уведомления текущего пользователя, новые первыми.
+// status: all (по умолчанию), unread или read. Листается курсором, как комментарии.
+func (h *Handler) ListNotifications(c *gin.Context) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	cursor, limit, ok := cursorParams(c)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Where("user_id = ?", u.ID)
+	switch c.DefaultQuery("status", "all") {
+	case "all":
+	case "unread":
+		query = query.Where("read_at IS NULL")
+	case "read":
+		query = query.Where("read_at IS NOT NULL")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be all, unread or read"})
+		return
+	}
+	if cursor > 0 {
+		query = query.Where("id < ?", cursor)
+	}
+
+	var notifications []Notification
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications", "details": err.Error()})
+		return
+	}
+
+	var unread int64
+	if err := h.DB.Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", u.ID).Count(&unread).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count notifications", "details": err.Error()})
+		return
+	}
+
+	var next *string
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		s := fmt.Sprint(notifications[limit-1].ID)
+		next = &s
+	}
+	items := make([]gin.H, 0, len(notifications))
+	for i := range notifications {
+		items = append(items, notifications[i].response())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unread": unread, "notifications": items, "next_cursor": next})
+}
+
+type MarkReadRequest struct {
+	IDs []uint `json:"ids"` // Пусто - все уведомления
+}
+
+// MarkNotificationRead отмечает одно уведомление прочитанным.
+func (h *Handler) MarkNotificationRead(c *gin.Context) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var n Notification
+	if err := h.DB.Where("id = ? AND user_id = ?", c.Param("id"), u.ID).First(&n).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	if n.ReadAt == nil {
+		now := time.Now()
+		if err := h.DB.Model(&n).Update("read_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification", "details": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, n.response())
+}
+
+// MarkNotificationsRead отмечает прочитанными перечисленные или все уведомления текущего пользователя.
+func (h *Handler) MarkNotificationsRead(c *gin.Context) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req MarkReadRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	query := h.DB.Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", u.ID)
+	if len(req.IDs) > 0 {
+		query = query.Where("id IN ?", req.IDs)
+	}
+	result := query.Update("read_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications", "details": result.Error.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"marked": result.RowsAffected})
+}
+
+// GetNotificationPreferences отдаёт, какие виды уведомлений включены у текущего пользователя.
+func (h *Handler) GetNotificationPreferences(c *gin.Context) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	h.preferencesResponse(c, u.ID)
+}
+
+func (h *Handler) preferencesResponse(c *gin.Context, userID uint) {
+	var prefs []NotificationPreference
+	if err := h.DB.Where("user_id = ?", userID).Find(&prefs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch preferences", "details": err.Error()})
+		return
+	}
+
+	result := make(map[string]bool, len(notificationKinds))
+	for _, kind := range notificationKinds {
+		result[kind] = true
+	}
+	for _, p := range prefs {
+		result[p.Kind] = p.Enabled
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// UpdateNotificationPreferences включает или отключает виды уведомлений: {"comment": false, ...}.
+// Не перечисленные виды не меняются.
+func (h *Handler) UpdateNotificationPreferences(c *gin.Context) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req map[string]bool
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	known := make(map[string]bool, len(notificationKinds))
+	for _, kind := range notificationKinds {
+		known[kind] = true
+	}
+	prefs := make([]NotificationPreference, 0, len(req))
+	for kind, enabled := range req {
+		if !known[kind] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown notification kind %q", kind)})
+			return
+		}
+		prefs = append(prefs, NotificationPreference{UserID: u.ID, Kind: kind, Enabled: enabled})
+	}
+
+	if len(prefs) > 0 {
+		if err := h.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "kind"}},
+			DoUpdates: clause.AssignmentColumns([]string{"enabled"}),
+		}).Create(&prefs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save preferences", "details": err.Error()})
+			return
+		}
+	}
+	h.preferencesResponse(c, u.ID)
+}
+
+// NotificationsWS подключает личный WebSocket пользователя: новые уведомления приходят
+// сообщениями {"type": "notification", "notification": {...}}.
+func (h *Handler) NotificationsWS(c *gin.Context) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	h.ActiveViewers.Listen(c, userRoom(u.ID))
+}
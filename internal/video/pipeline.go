@@ -0,0 +1,120 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/toxanetoxa/gohls/internal/mp4"
+	"github.com/toxanetoxa/gohls/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// Step - шаг конвейера обработки загруженного видео.
+type Step struct {
+	Name string
+	// Required - при ошибке обязательного шага обработка прекращается, видео помечается как failed
+	Required bool
+	Run      func(ctx context.Context, v *Video) error
+}
+
+// ErrRetry - шаг не смог выполниться по временной причине, обработка будет запущена заново через RetryDelay.
+var ErrRetry = errors.New("retry processing later")
+
+// Pipeline последовательно выполняет шаги обработки видео после загрузки.
+type Pipeline struct {
+	DB      *gorm.DB
+	Steps   []Step
+	Timeout time.Duration
+	// RetryDelay - через сколько повторяется обработка, шаг которой вернул ErrRetry
+	RetryDelay time.Duration
+	// OnDone вызывается после того, как видео получило статус ready или failed
+	OnDone func(v *Video)
+}
+
+// Process запускает обработку видео в фоне.
+func (p *Pipeline) Process(videoID uint) {
+	go p.run(videoID)
+}
+
+func (p *Pipeline) run(videoID uint) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+
+	var v Video
+	if err := p.DB.First(&v, videoID).Error; err != nil {
+		logger.Logger.Errorw("Failed to load video for processing", "video_id", videoID, "error", err)
+		return
+	}
+
+	for _, step := range p.Steps {
+		if err := step.Run(ctx, &v); err != nil {
+			if errors.Is(err, ErrRejected) {
+				// Статус и причину выставил сам шаг
+				logger.Logger.Infow("Video rejected during processing", "video_id", videoID, "step", step.Name)
+				return
+			}
+			if errors.Is(err, ErrRetry) {
+				// Видео остаётся в processing, его состояние шаг сохранил сам
+				logger.Logger.Warnw("Processing step will be retried", "video_id", videoID, "step", step.Name, "retry_in", p.RetryDelay, "error", err)
+				time.AfterFunc(p.RetryDelay, func() { p.run(videoID) })
+				return
+			}
+			logger.Logger.Errorw("Processing step failed", "video_id", videoID, "step", step.Name, "error", err)
+			if step.Required {
+				p.setStatus(&v, StatusFailed)
+				return
+			}
+		}
+	}
+
+	p.setStatus(&v, StatusReady)
+}
+
+func (p *Pipeline) setStatus(v *Video, status string) {
+	if err := p.DB.Model(v).Update("status", status).Error; err != nil {
+		logger.Logger.Errorw("Failed to update video status", "video_id", v.ID, "error", err)
+		return
+	}
+	v.Status = status
+	if p.OnDone != nil {
+		p.OnDone(v)
+	}
+}
+
+// probeStep определяет длительность видео с помощью ffprobe.
+func (h *Handler) probeStep() Step {
+	return Step{
+		Name:     "probe",
+		Required: true,
+		Run: func(ctx context.Context, v *Video) error {
+			probe, err := h.FFmpeg.Probe(ctx, v.FilePath)
+			if err != nil {
+				return err
+			}
+			return h.DB.Model(v).Update("duration", probe.Duration()).Error
+		},
+	}
+}
+
+// faststartStep переносит moov в начало MP4/MOV, чтобы StreamVideo и GetVideoChunk
+// можно было воспроизводить, не дожидаясь загрузки конца файла.
+func (h *Handler) faststartStep() Step {
+	return Step{
+		Name: "faststart",
+		Run: func(ctx context.Context, v *Video) error {
+			changed, err := mp4.Faststart(v.FilePath)
+			if errors.Is(err, mp4.ErrNotMP4) {
+				// WebM, MKV и другие контейнеры не переписываем
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if changed {
+				logger.Logger.Infow("Moved moov atom to the beginning of the file", "video_id", v.ID)
+			}
+			return nil
+		},
+	}
+}
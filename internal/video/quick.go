@@ -0,0 +1,191 @@
+package video
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/toxanetoxa/gohls/internal/mp4"
+	"github.com/toxanetoxa/gohls/pkg/logger"
+)
+
+// Быстрая публикация: исходный MP4 переупаковывается во фрагментированный без перекодирования
+// и отдаётся одним файлом через #EXT-X-BYTERANGE, пока не готова лестница качеств.
+const (
+	quickDir       = "quick"
+	quickMediaName = "quick.mp4"
+)
+
+// quickHLSStep готовит плейлист быстрой публикации. Файлы не в MP4/MOV и кодеки,
+// которые HLS-плееры не воспроизводят (например, VP9), пропускаются до полной упаковки.
+func (h *Handler) quickHLSStep() Step {
+	return Step{
+		Name: "quick_hls",
+		Run: func(ctx context.Context, v *Video) error {
+			// Сегменты быстрой публикации не шифруются, поэтому при шифровании HLS шаг выключен
+			if !hlsQuickPublish || h.Keys != nil {
+				return nil
+			}
+
+			dir := v.MediaPath(path.Join(hlsDir, quickDir))
+			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+				return err
+			}
+
+			layout, err := writeQuickMedia(v.FilePath, filepath.Join(dir, quickMediaName))
+			if errors.Is(err, mp4.ErrNotMP4) || errors.Is(err, mp4.ErrUnsupported) {
+				logger.Logger.Infow("Quick HLS publish skipped", "video_id", v.ID, "reason", err)
+				return os.RemoveAll(dir)
+			}
+			if err != nil {
+				return err
+			}
+
+			playlist := buildQuickPlaylist(layout)
+			tmp := filepath.Join(dir, "index.m3u8.tmp")
+			if err := os.WriteFile(tmp, []byte(playlist), 0o644); err != nil {
+				return err
+			}
+			return os.Rename(tmp, filepath.Join(dir, "index.m3u8"))
+		},
+	}
+}
+
+// writeQuickMedia записывает фрагментированную копию src во временный файл и переименовывает его в dst.
+func writeQuickMedia(src, dst string) (*mp4.Fragmented, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriterSize(out, 1<<20)
+	layout, err := mp4.WriteFragmented(in, info.Size(), w, float64(hlsSegmentDuration))
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return layout, os.Rename(tmp, dst)
+}
+
+// buildQuickPlaylist собирает медиаплейлист HLS v7, в котором init-сегмент и фрагменты -
+// диапазоны байтов одного файла.
+func buildQuickPlaylist(layout *mp4.Fragmented) string {
+	target := 1.0
+	for _, f := range layout.Fragments {
+		target = math.Max(target, math.Ceil(f.Duration))
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:7\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(target))
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s\",BYTERANGE=\"%d@0\"\n", quickMediaName, layout.InitSize)
+	for _, f := range layout.Fragments {
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n#EXT-X-BYTERANGE:%d@%d\n%s\n", f.Duration, f.Size, f.Offset, quickMediaName)
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
+
+// buildQuickMasterPlaylist возвращает мастер-плейлист с единственным вариантом быстрой публикации
+// или пустую строку, если его нет.
+func buildQuickMasterPlaylist(v *Video) string {
+	info, err := os.Stat(v.MediaPath(path.Join(hlsDir, quickDir, quickMediaName)))
+	if err != nil || !hasQuickPlaylist(v) {
+		return ""
+	}
+
+	// Средний битрейт исходника; без длительности - консервативная оценка
+	bandwidth := 5_000_000
+	if v.Duration > 0 {
+		bandwidth = int(float64(info.Size()*8) / v.Duration * 1.2)
+	}
+
+	return fmt.Sprintf("#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-INDEPENDENT-SEGMENTS\n#EXT-X-STREAM-INF:BANDWIDTH=%d\n%s\n",
+		bandwidth, path.Join(quickDir, "index.m3u8"))
+}
+
+// scheduleQuickCleanup удаляет быструю публикацию после готовности лестницы качеств. Плееры,
+// открывшие её раньше, успевают досмотреть: файл живёт ещё длительность видео плюс HLS_QUICK_RETENTION.
+// Пока файл не удалён, он не учитывается в квоте автора.
+func scheduleQuickCleanup(v *Video) {
+	dir := v.MediaPath(path.Join(hlsDir, quickDir))
+	if _, err := os.Stat(dir); err != nil {
+		return
+	}
+
+	delay := hlsQuickRetention + time.Duration(v.Duration*float64(time.Second))
+	videoID := v.ID
+	time.AfterFunc(delay, func() {
+		if err := os.RemoveAll(dir); err != nil {
+			logger.Logger.Errorw("Failed to remove quick HLS publish", "video_id", videoID, "error", err)
+		}
+	})
+}
+
+// sweepQuickMedia планирует удаление быстрых публикаций, оставшихся у уже упакованных видео:
+// таймеры scheduleQuickCleanup не переживают перезапуск.
+func (h *Handler) sweepQuickMedia() {
+	var videos []Video
+	err := h.DB.Where("id IN (?)", h.DB.Model(&Rendition{}).Select("video_id")).
+		Select("id", "duration").Find(&videos).Error
+	if err != nil {
+		logger.Logger.Errorw("Failed to find videos with quick HLS publish", "error", err)
+		return
+	}
+	for i := range videos {
+		scheduleQuickCleanup(&videos[i])
+	}
+}
+
+// hasQuickPlaylist сообщает, готова ли быстрая публикация видео.
+func hasQuickPlaylist(v *Video) bool {
+	_, err := os.Stat(v.MediaPath(path.Join(hlsDir, quickDir, "index.m3u8")))
+	return err == nil
+}
+
+// cleanHLSDir удаляет результат предыдущей упаковки, сохраняя быструю публикацию:
+// плееры, открывшие её до готовности лестницы, продолжают воспроизведение.
+func cleanHLSDir(v *Video) error {
+	entries, err := os.ReadDir(v.MediaPath(hlsDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() == quickDir {
+			continue
+		}
+		if err := os.RemoveAll(v.MediaPath(path.Join(hlsDir, e.Name()))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package video
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Реакции на видео
+const (
+	ReactionLike    = "like"
+	ReactionDislike = "dislike"
+)
+
+// Счётчик в videos для каждой реакции
+var reactionCounters = map[string]string{
+	ReactionLike:    "like_count",
+	ReactionDislike: "dislike_count",
+}
+
+// Reaction - оценка видео пользователем, не больше одной на видео.
+type Reaction struct {
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false"`
+	VideoID   uint      `gorm:"primaryKey;autoIncrement:false"`
+	Kind      string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"` // Время последней смены реакции, учитывается в трендах
+}
+
+func (Reaction) TableName() string {
+	return "video_reactions"
+}
+
+// errReactionConflict - реакция изменилась параллельным запросом.
+var errReactionConflict = errors.New("reaction changed concurrently")
+
+type ReactionRequest struct {
+	Kind string `json:"kind" binding:"required"` // like или dislike
+}
+
+// setReaction ставит, меняет или снимает (kind == "") реакцию пользователя и обновляет счётчики видео
+// в той же транзакции. Возвращает итоговую реакцию.
+func (h *Handler) setReaction(userID, videoID uint, kind string) (string, error) {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var current []Reaction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND video_id = ?", userID, videoID).
+			Limit(1).Find(&current).Error; err != nil {
+			return err
+		}
+
+		counters := map[string]interface{}{}
+		switch {
+		case len(current) == 0 && kind == "":
+			return nil
+		case len(current) == 0:
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&Reaction{UserID: userID, VideoID: videoID, Kind: kind, CreatedAt: time.Now()})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errReactionConflict
+			}
+		case kind == "":
+			if err := tx.Delete(&current[0]).Error; err != nil {
+				return err
+			}
+			counters[reactionCounters[current[0].Kind]] = gorm.Expr(reactionCounters[current[0].Kind] + " - 1")
+		case current[0].Kind == kind:
+			return nil
+		default:
+			if err := tx.Model(&current[0]).Updates(map[string]interface{}{"kind": kind, "created_at": time.Now()}).Error; err != nil {
+				return err
+			}
+			counters[reactionCounters[current[0].Kind]] = gorm.Expr(reactionCounters[current[0].Kind] + " - 1")
+		}
+		if kind != "" {
+			counters[reactionCounters[kind]] = gorm.Expr(reactionCounters[kind] + " + 1")
+		}
+		return tx.Model(&Video{}).Where("id = ?", videoID).UpdateColumns(counters).Error
+	})
+	return kind, err
+}
+
+// reactionResponse описывает счётчики видео и реакцию пользователя.
+func (h *Handler) reactionResponse(c *gin.Context, videoID uint, reaction string) {
+	var v Video
+	if err := h.DB.Select("id", "like_count", "dislike_count").First(&v, videoID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch video", "details": err.Error()})
+		return
+	}
+
+	var my interface{}
+	if reaction != "" {
+		my = reaction
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"video_id":    v.ID,
+		"likes":       v.LikeCount,
+		"dislikes":    v.DislikeCount,
+		"my_reaction": my,
+	})
+}
+
+// React ставит реакцию на видео. Повторная такая же реакция снимает её, другая - заменяет.
+func (h *Handler) React(c *gin.Context) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireViewer(c, v) {
+		return
+	}
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req ReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := reactionCounters[req.Kind]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be like or dislike"})
+		return
+	}
+
+	current, err := h.myReaction(u.ID, v.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reaction", "details": err.Error()})
+		return
+	}
+	kind := req.Kind
+	if current == kind {
+		kind = ""
+	}
+
+	reaction, err := h.setReaction(u.ID, v.ID, kind)
+	if errors.Is(err, errReactionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Reaction was changed by another request, retry"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save reaction", "details": err.Error()})
+		return
+	}
+	h.reactionResponse(c, v.ID, reaction)
+}
+
+// Unreact снимает реакцию пользователя с видео.
+func (h *Handler) Unreact(c *gin.Context) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireViewer(c, v) {
+		return
+	}
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if _, err := h.setReaction(u.ID, v.ID, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove reaction", "details": err.Error()})
+		return
+	}
+	h.reactionResponse(c, v.ID, "")
+}
+
+// myReaction возвращает реакцию пользователя на видео или пустую строку.
+func (h *Handler) myReaction(userID, videoID uint) (string, error) {
+	var kinds []string
+	err := h.DB.Model(&Reaction{}).Where("user_id = ? AND video_id = ?", userID, videoID).Limit(1).Pluck("kind", &kinds).Error
+	if err != nil || len(kinds) == 0 {
+		return "", err
+	}
+	return kinds[0], nil
+}
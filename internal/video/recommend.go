@@ -0,0 +1,270 @@
+package video
+
+import (
+	"database/sql"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toxanetoxa/gohls/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// scoredVideo - видео с оценкой в списке рекомендаций.
+type scoredVideo struct {
+	ID    uint
+	Score float64
+}
+
+type relatedEntry struct {
+	videos    []scoredVideo
+	expiresAt time.Time
+}
+
+// Recommender считает тренды по затухающей скорости просмотров и похожие видео по тегам и совместным просмотрам.
+// Тренды пересчитываются в фоне раз в RECOMMEND_INTERVAL, похожие видео - при первом запросе и кешируются.
+type Recommender struct {
+	DB *gorm.DB
+
+	mu        sync.RWMutex
+	trending  []scoredVideo
+	updatedAt time.Time
+	related   map[uint]relatedEntry // videoID -> похожие видео
+}
+
+// NewRecommender создаёт Recommender и запускает фоновый пересчёт трендов.
+func NewRecommender(db *gorm.DB) *Recommender {
+	r := &Recommender{
+		DB:      db,
+		related: make(map[uint]relatedEntry),
+	}
+	go r.run()
+	return r
+}
+
+func (r *Recommender) run() {
+	r.refresh()
+
+	ticker := time.NewTicker(recommendInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.refresh()
+	}
+}
+
+// refresh пересчитывает тренды и выбрасывает устаревшие списки похожих видео.
+func (r *Recommender) refresh() {
+	trending, err := r.scoreTrending()
+	if err != nil {
+		logger.Logger.Errorw("Failed to score trending videos", "error", err)
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.trending = trending
+		r.updatedAt = now
+	}
+	for id, entry := range r.related {
+		if now.After(entry.expiresAt) {
+			delete(r.related, id)
+		}
+	}
+}
+
+// scoreTrending оценивает публичные готовые видео суммой просмотров и реакций за TRENDING_WINDOW,
+// где вес каждого события экспоненциально убывает с периодом полураспада TRENDING_HALF_LIFE.
+// Просмотр весит 1, лайк - TRENDING_LIKE_WEIGHT, дизлайк вычитает TRENDING_DISLIKE_WEIGHT.
+func (r *Recommender) scoreTrending() ([]scoredVideo, error) {
+	var scores []scoredVideo
+	err := r.DB.Raw(`
+		WITH events AS (
+			SELECT video_id, created_at, 1.0::float8 AS weight FROM video_views WHERE created_at > @since
+			UNION ALL
+			SELECT video_id, created_at, CASE kind WHEN 'like' THEN @like_weight ELSE -@dislike_weight END
+			FROM video_reactions WHERE created_at > @since
+		)
+		SELECT v.id, SUM(e.weight * EXP(-LN(2) * EXTRACT(EPOCH FROM (NOW() - e.created_at)) / @half_life)) AS score
+		FROM events e
+		JOIN videos v ON v.id = e.video_id
+		WHERE v.visibility = @visibility AND v.status = @status AND v.moderation_status = ''
+		GROUP BY v.id
+		HAVING SUM(e.weight) > 0
+		ORDER BY score DESC, v.id DESC
+		LIMIT @limit`,
+		sql.Named("like_weight", trendingLikeWeight),
+		sql.Named("dislike_weight", trendingDislikeWeight),
+		sql.Named("half_life", trendingHalfLife.Seconds()),
+		sql.Named("visibility", VisibilityPublic),
+		sql.Named("status", StatusReady),
+		sql.Named("since", time.Now().Add(-trendingWindow)),
+		sql.Named("limit", trendingLimit),
+	).Scan(&scores).Error
+	return scores, err
+}
+
+// Trending возвращает последний посчитанный список трендов и время расчёта.
+func (r *Recommender) Trending() ([]scoredVideo, time.Time) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.trending, r.updatedAt
+}
+
+// Related возвращает похожие видео из кеша или считает их.
+func (r *Recommender) Related(videoID uint) ([]scoredVideo, error) {
+	r.mu.RLock()
+	entry, ok := r.related[videoID]
+	r.mu.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.videos, nil
+	}
+
+	videos, err := r.scoreRelated(videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.related[videoID] = relatedEntry{videos: videos, expiresAt: time.Now().Add(relatedCacheTTL)}
+	r.mu.Unlock()
+	return videos, nil
+}
+
+// scoreRelated оценивает видео, похожие на videoID: коэффициент Жаккара по тегам
+// плюс доля зрителей videoID, посмотревших и кандидата (зритель определяется по IP).
+// Если похожих мало, список дополняется трендами.
+func (r *Recommender) scoreRelated(videoID uint) ([]scoredVideo, error) {
+	var scores []scoredVideo
+	err := r.DB.Raw(`
+		WITH src_tags AS (
+			SELECT tag_id FROM video_tags WHERE video_id = @id
+		),
+		by_tags AS (
+			SELECT vt.video_id,
+			       COUNT(*)::float / ((SELECT COUNT(*) FROM src_tags) +
+			           (SELECT COUNT(*) FROM video_tags o WHERE o.video_id = vt.video_id) - COUNT(*)) AS score
+			FROM video_tags vt
+			WHERE vt.tag_id IN (SELECT tag_id FROM src_tags) AND vt.video_id <> @id
+			GROUP BY vt.video_id
+		),
+		viewers AS (
+			SELECT ip_address FROM video_views WHERE video_id = @id ORDER BY created_at DESC LIMIT @sample
+		),
+		by_views AS (
+			SELECT vv.video_id, COUNT(DISTINCT vv.ip_address)::float / (SELECT COUNT(*) FROM viewers) AS score
+			FROM video_views vv
+			WHERE vv.ip_address IN (SELECT ip_address FROM viewers) AND vv.video_id <> @id
+			GROUP BY vv.video_id
+		)
+		SELECT v.id, @tag_weight * COALESCE(t.score, 0) + @coview_weight * COALESCE(w.score, 0) AS score
+		FROM by_tags t
+		FULL JOIN by_views w ON w.video_id = t.video_id
+		JOIN videos v ON v.id = COALESCE(t.video_id, w.video_id)
+		WHERE v.visibility = @visibility AND v.status = @status AND v.moderation_status = ''
+		ORDER BY score DESC, v.id DESC
+		LIMIT @limit`,
+		sql.Named("id", videoID),
+		sql.Named("sample", relatedCoviewSample),
+		sql.Named("tag_weight", relatedTagWeight),
+		sql.Named("coview_weight", relatedCoviewWeight),
+		sql.Named("visibility", VisibilityPublic),
+		sql.Named("status", StatusReady),
+		sql.Named("limit", relatedLimit),
+	).Scan(&scores).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Для новых видео без тегов и просмотров "смотреть далее" не должно быть пустым
+	seen := map[uint]bool{videoID: true}
+	for _, s := range scores {
+		seen[s.ID] = true
+	}
+	trending, _ := r.Trending()
+	for _, s := range trending {
+		if len(scores) >= relatedLimit {
+			break
+		}
+		if !seen[s.ID] {
+			seen[s.ID] = true
+			scores = append(scores, scoredVideo{ID: s.ID})
+		}
+	}
+	return scores, nil
+}
+
+// scoredResponse загружает видео списка рекомендаций, сохраняя порядок.
+// Видео, ставшие с момента расчёта непубличными или недоступными, пропускаются.
+func (h *Handler) scoredResponse(scores []scoredVideo) ([]gin.H, error) {
+	ids := make([]uint, 0, len(scores))
+	for _, s := range scores {
+		ids = append(ids, s.ID)
+	}
+
+	rows, err := h.publicVideosByID(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	videos := make([]gin.H, 0, len(rows))
+	for i, s := range scores {
+		if rows[i] == nil {
+			continue
+		}
+		item := rows[i].response()
+		item["score"] = s.Score
+		videos = append(videos, item)
+	}
+	return videos, nil
+}
+
+// GetTrending отдаёт страницу трендов из последнего расчёта.
+func (h *Handler) GetTrending(c *gin.Context) {
+	page, perPage, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	trending, updatedAt := h.Recommender.Trending()
+	total := len(trending)
+	start := min((page-1)*perPage, total)
+	end := min(start+perPage, total)
+
+	videos, err := h.scoredResponse(trending[start:end])
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch videos", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"page":       page,
+		"per_page":   perPage,
+		"total":      total,
+		"updated_at": updatedAt,
+		"videos":     videos,
+	})
+}
+
+// GetRelated отдаёт видео, которые стоит посмотреть после текущего.
+func (h *Handler) GetRelated(c *gin.Context) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireViewer(c, v) {
+		return
+	}
+
+	related, err := h.Recommender.Related(v.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to score related videos", "details": err.Error()})
+		return
+	}
+
+	videos, err := h.scoredResponse(related)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch videos", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"video_id": v.ID, "videos": videos})
+}
@@ -0,0 +1,141 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/toxanetoxa/gohls/internal/scan"
+	"github.com/toxanetoxa/gohls/pkg/logger"
+)
+
+// Состояния антивирусной проверки исходного файла. Пустое - файл загружен до появления проверки.
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+	ScanFailed   = "failed" // Файл не удалось проверить: сканер так и не ответил
+)
+
+// Перекрытие частей при проверке файлов больше лимита сканера
+const scanChunkOverlap = 1 << 20
+
+// ErrRejected - шаг отклонил видео и сам выставил статус, конвейер останавливается.
+var ErrRejected = errors.New("video rejected")
+
+// scanStep проверяет исходный файл антивирусом до любой другой обработки.
+// Заражённый файл уходит в карантин, видео получает статус rejected, автор - уведомление.
+// Пока сканер недоступен, видео остаётся pending и проверяется повторно; непроверенное видео не публикуется.
+func (h *Handler) scanStep() Step {
+	return Step{
+		Name:     "scan",
+		Required: true,
+		Run: func(ctx context.Context, v *Video) error {
+			if h.Scanner == nil {
+				return nil
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, scanTimeout)
+			defer cancel()
+
+			result, err := scan.ScanFile(ctx, h.Scanner, v.FilePath)
+			if errors.Is(err, scan.ErrTooLarge) {
+				// Загрузки не больше лимита сканера, сюда попадают записи эфиров: проверяем их частями
+				logger.Logger.Infow("File exceeds scanner stream limit, scanning in chunks", "video_id", v.ID)
+				result, err = scan.ScanFileChunks(ctx, h.Scanner, v.FilePath, scan.MaxSize(h.Scanner), scanChunkOverlap)
+			}
+			if errors.Is(err, scan.ErrUnavailable) && v.ScanAttempts+1 < scanMaxAttempts {
+				if err := h.DB.Model(v).Update("scan_attempts", v.ScanAttempts+1).Error; err != nil {
+					return err
+				}
+				return fmt.Errorf("%w: %w", ErrRetry, err)
+			}
+			if err != nil {
+				if updateErr := h.DB.Model(v).Updates(map[string]interface{}{
+					"scan_status":   ScanFailed,
+					"scan_attempts": v.ScanAttempts + 1,
+				}).Error; updateErr != nil {
+					return updateErr
+				}
+				return err
+			}
+			if !result.Infected {
+				return h.DB.Model(v).Update("scan_status", ScanClean).Error
+			}
+
+			quarantined, err := quarantine(v)
+			if err != nil {
+				return err
+			}
+
+			reason := fmt.Sprintf("malware detected: %s", result.Signature)
+			if err := h.DB.Model(v).Updates(map[string]interface{}{
+				"status":           StatusRejected,
+				"scan_status":      ScanInfected,
+				"rejection_reason": reason,
+				"file_path":        quarantined,
+			}).Error; err != nil {
+				return err
+			}
+
+			h.Notifier.VideoRejected(v, reason)
+			return ErrRejected
+		},
+	}
+}
+
+// resumeScans возобновляет проверку видео, которые ждали сканер: таймеры повтора не переживают перезапуск.
+func (h *Handler) resumeScans() {
+	var ids []uint
+	err := h.DB.Model(&Video{}).
+		Where("status = ? AND scan_status = ?", StatusProcessing, ScanPending).
+		Pluck("id", &ids).Error
+	if err != nil {
+		logger.Logger.Errorw("Failed to find videos waiting for malware scan", "error", err)
+		return
+	}
+	for _, id := range ids {
+		h.Pipeline.Process(id)
+	}
+}
+
+// quarantine переносит исходный файл видео в карантин и возвращает новый путь.
+func quarantine(v *Video) (string, error) {
+	if err := os.MkdirAll(quarantineDir, 0o700); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(quarantineDir, fmt.Sprintf("%d_%s", v.ID, filepath.Base(v.FilePath)))
+
+	err := os.Rename(v.FilePath, dst)
+	if err == nil {
+		return dst, os.Chmod(dst, 0o600)
+	}
+
+	// Карантин на другом разделе: копируем и удаляем исходник
+	if err := copyFile(v.FilePath, dst); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, os.Remove(v.FilePath)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,223 @@
+package video
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Языки с морфологией в поиске. Для остальных используется конфигурация simple (без стемминга).
+var searchLanguages = map[string]bool{
+	"ru": true,
+	"en": true,
+}
+
+// Ограничения на описание и размер страницы выдачи
+const (
+	maxDescriptionLength = 5000
+	searchPerPage        = 20
+	searchMaxPerPage     = 100
+)
+
+// Маркеры подсветки: ts_headline не экранирует HTML, поэтому текст экранируется в Go,
+// а маркеры заменяются на <mark> уже после экранирования
+const (
+	highlightStart = "{{mark}}"
+	highlightStop  = "{{/mark}}"
+)
+
+// Сортировки выдачи
+var searchOrders = map[string]string{
+	"relevance": "rank DESC, v.id DESC",
+	"date":      "v.created_at DESC, v.id DESC",
+	"views":     "views DESC, rank DESC, v.id DESC",
+}
+
+// DetectLanguage угадывает язык текста по алфавиту: кириллица - ru, латиница - en.
+func DetectLanguage(text string) string {
+	cyrillic, latin := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	switch {
+	case cyrillic > latin:
+		return "ru"
+	case latin > 0:
+		return "en"
+	default:
+		return ""
+	}
+}
+
+// normalizeLanguage проверяет язык, указанный автором, или определяет его по тексту.
+func normalizeLanguage(language, title, description string) (string, error) {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if language == "" {
+		return DetectLanguage(title + " " + description), nil
+	}
+	if !searchLanguages[language] {
+		return "", fmt.Errorf("language must be one of: ru, en")
+	}
+	return language, nil
+}
+
+// UpdateSearchVector пересчитывает поисковый вектор видео: название - вес A, теги - B, описание - C.
+// Вызывается после изменения любого из этих полей.
+func UpdateSearchVector(db *gorm.DB, videoID uint) error {
+	return db.Exec(`
+		UPDATE videos SET search_vector =
+			setweight(to_tsvector(video_search_config(language), title), 'A') ||
+			setweight(to_tsvector(video_search_config(language), COALESCE((
+				SELECT string_agg(t.name, ' ')
+				FROM video_tags vt JOIN tags t ON t.id = vt.tag_id
+				WHERE vt.video_id = videos.id), '')), 'B') ||
+			setweight(to_tsvector(video_search_config(language), description), 'C')
+		WHERE id = ?`, videoID).Error
+}
+
+// searchRow - строка выдачи поиска.
+type searchRow struct {
+	ID                   uint
+	Title                string
+	Description          string
+	Duration             float64
+	ThumbnailKey         string
+	IsPaid               bool
+	CreatedAt            time.Time
+	Rank                 float64
+	Views                int64
+	TitleHighlight       string
+	DescriptionHighlight string
+	Total                int64
+}
+
+// highlight экранирует фрагмент и превращает маркеры ts_headline в <mark>.
+func highlight(s string) string {
+	s = html.EscapeString(s)
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(s)
+}
+
+// pageParams разбирает page и per_page, по умолчанию первая страница по searchPerPage.
+func pageParams(c *gin.Context) (page, perPage int, ok bool) {
+	page, perPage = 1, searchPerPage
+	if s := c.Query("page"); s != "" {
+		p, err := strconv.Atoi(s)
+		if err != nil || p < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive integer"})
+			return 0, 0, false
+		}
+		page = p
+	}
+	if s := c.Query("per_page"); s != "" {
+		p, err := strconv.Atoi(s)
+		if err != nil || p < 1 || p > searchMaxPerPage {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("per_page must be between 1 and %d", searchMaxPerPage)})
+			return 0, 0, false
+		}
+		perPage = p
+	}
+	return page, perPage, true
+}
+
+// Search ищет публичные готовые видео по названию, тегам и описанию.
+// Запрос разбирается морфологией русского и английского, опечатки в названии находятся триграммами.
+func (h *Handler) Search(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter q is required"})
+		return
+	}
+
+	sort := c.DefaultQuery("sort", "relevance")
+	order, ok := searchOrders[sort]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be relevance, date or views"})
+		return
+	}
+
+	page, perPage, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	headline := fmt.Sprintf("StartSel=%q, StopSel=%q", highlightStart, highlightStop)
+	query := `
+		WITH q AS (
+			SELECT websearch_to_tsquery('russian', @q) ||
+			       websearch_to_tsquery('english', @q) ||
+			       websearch_to_tsquery('simple', @q) AS query
+		)
+		SELECT v.id, v.title, v.description, v.duration, v.thumbnail_key, v.is_paid, v.created_at,
+		       ts_rank_cd(v.search_vector, q.query) + word_similarity(@q, v.title) AS rank,
+		       (SELECT COUNT(*) FROM video_views vv WHERE vv.video_id = v.id) AS views,
+		       ts_headline(video_search_config(v.language), v.title, q.query, @title_opts) AS title_highlight,
+		       ts_headline(video_search_config(v.language), v.description, q.query, @description_opts) AS description_highlight,
+		       COUNT(*) OVER () AS total
+		FROM videos v, q
+		WHERE v.visibility = @visibility AND v.status = @status AND v.moderation_status = ''
+		  AND (v.search_vector @@ q.query OR @q <% v.title)
+		ORDER BY ` + order + `
+		LIMIT @limit OFFSET @offset`
+
+	var rows []searchRow
+	err := h.DB.Raw(query,
+		sql.Named("q", q),
+		sql.Named("title_opts", headline+", HighlightAll=true"),
+		sql.Named("description_opts", headline+", MaxWords=35, MinWords=15, MaxFragments=2"),
+		sql.Named("visibility", VisibilityPublic),
+		sql.Named("status", StatusReady),
+		sql.Named("limit", perPage),
+		sql.Named("offset", (page-1)*perPage),
+	).Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search videos", "details": err.Error()})
+		return
+	}
+
+	var total int64
+	results := make([]gin.H, 0, len(rows))
+	for _, r := range rows {
+		total = r.Total
+		thumbnailURL := ""
+		if r.ThumbnailKey != "" {
+			thumbnailURL = fmt.Sprintf("/videos/%d/thumbnail", r.ID)
+		}
+		results = append(results, gin.H{
+			"video_id":      r.ID,
+			"title":         r.Title,
+			"description":   r.Description,
+			"duration":      r.Duration,
+			"thumbnail_url": thumbnailURL,
+			"is_paid":       r.IsPaid,
+			"views":         r.Views,
+			"created_at":    r.CreatedAt,
+			"rank":          r.Rank,
+			"highlights": gin.H{
+				"title":       highlight(r.TitleHighlight),
+				"description": highlight(r.DescriptionHighlight),
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":    q,
+		"sort":     sort,
+		"page":     page,
+		"per_page": perPage,
+		"total":    total,
+		"results":  results,
+	})
+}
@@ -0,0 +1,126 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toxanetoxa/gohls/internal/media"
+)
+
+// Папка со спрайтами превью перемотки внутри MediaDir
+const storyboardDir = "storyboard"
+
+// storyboardStep нарезает спрайты превью и WebVTT-файл с координатами кадров.
+func (h *Handler) storyboardStep() Step {
+	return Step{
+		Name: "storyboard",
+		Run: func(ctx context.Context, v *Video) error {
+			if v.Duration <= 0 || storyboardInterval <= 0 {
+				return errors.New("storyboard requires a known duration and positive interval")
+			}
+
+			probe, err := h.FFmpeg.Probe(ctx, v.FilePath)
+			if err != nil {
+				return err
+			}
+			stream := probe.VideoStream()
+			if stream == nil || stream.Width == 0 {
+				return errors.New("no video stream found")
+			}
+
+			// Высота кадра с сохранением пропорций, кратная двум
+			tileW := storyboardWidth
+			tileH := int(math.Round(float64(tileW)*float64(stream.Height)/float64(stream.Width)/2)) * 2
+
+			dir := v.MediaPath(storyboardDir)
+			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+				return err
+			}
+
+			filter := fmt.Sprintf("fps=1/%g,scale=%d:%d,tile=%dx%d",
+				storyboardInterval, tileW, tileH, storyboardColumns, storyboardRows)
+			if err := h.FFmpeg.Run(ctx,
+				"-i", v.FilePath,
+				"-vf", filter,
+				"-q:v", "4",
+				filepath.Join(dir, "sprite_%03d.jpg"),
+			); err != nil {
+				return err
+			}
+
+			vtt := buildStoryboardVTT(v.Duration, storyboardInterval, tileW, tileH, storyboardColumns, storyboardRows)
+			return os.WriteFile(filepath.Join(dir, "storyboard.vtt"), []byte(vtt), 0o644)
+		},
+	}
+}
+
+// buildStoryboardVTT строит WebVTT-дорожку, где каждому интервалу соответствует
+// область спрайта в формате #xywh (поддерживается Video.js, Plyr и др.).
+func buildStoryboardVTT(duration, interval float64, tileW, tileH, columns, rows int) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+
+	perSheet := columns * rows
+	count := int(math.Ceil(duration / interval))
+	for i := 0; i < count; i++ {
+		start := float64(i) * interval
+		end := math.Min(start+interval, duration)
+
+		sheet := i/perSheet + 1
+		pos := i % perSheet
+		x := (pos % columns) * tileW
+		y := (pos / columns) * tileH
+
+		fmt.Fprintf(&b, "\n%s --> %s\n%s/sprite_%03d.jpg#xywh=%d,%d,%d,%d\n",
+			media.FormatVTTTimestamp(start), media.FormatVTTTimestamp(end), storyboardDir, sheet, x, y, tileW, tileH)
+	}
+
+	return b.String()
+}
+
+// GetStoryboardVTT отдаёт WebVTT-дорожку превью перемотки.
+func (h *Handler) GetStoryboardVTT(c *gin.Context) {
+	v, ok := h.loadWatchableVideo(c)
+	if !ok {
+		return
+	}
+
+	h.serveStoryboardFile(c, v, "storyboard.vtt", "text/vtt")
+}
+
+// GetStoryboardSprite отдаёт спрайт превью перемотки.
+func (h *Handler) GetStoryboardSprite(c *gin.Context) {
+	v, ok := h.loadWatchableVideo(c)
+	if !ok {
+		return
+	}
+
+	name := c.Param("file")
+	if name != path.Base(name) || !strings.HasPrefix(name, "sprite_") || path.Ext(name) != ".jpg" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sprite name"})
+		return
+	}
+
+	h.serveStoryboardFile(c, v, name, "image/jpeg")
+}
+
+func (h *Handler) serveStoryboardFile(c *gin.Context, v *Video, name, contentType string) {
+	filePath := v.MediaPath(path.Join(storyboardDir, name))
+	if _, err := os.Stat(filePath); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Storyboard is not ready yet"})
+		return
+	}
+
+	c.Header("Cache-Control", cacheControl(v, 24*time.Hour, ""))
+	c.Header("Content-Type", contentType)
+	c.File(filePath)
+}
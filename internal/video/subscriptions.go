@@ -0,0 +1,337 @@
+package video
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toxanetoxa/gohls/internal/user"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Subscription - подписка пользователя на канал (автора видео).
+type Subscription struct {
+	SubscriberID uint      `gorm:"primaryKey;autoIncrement:false"`
+	ChannelID    uint      `gorm:"primaryKey;autoIncrement:false"` // ID пользователя-автора
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+// FeedCache хранит начало ленты подписок каждого пользователя: лента собирается при чтении
+// одним запросом по подпискам, а повторные запросы и следующие страницы берутся из кеша.
+type FeedCache struct {
+	mu      sync.Mutex
+	entries map[uint]feedEntry // userID -> начало ленты
+}
+
+type feedEntry struct {
+	ids       []uint // ID видео, новые первыми
+	complete  bool   // В ids вся лента, а не только первые feedCacheSize видео
+	expiresAt time.Time
+}
+
+func NewFeedCache() *FeedCache {
+	return &FeedCache{entries: make(map[uint]feedEntry)}
+}
+
+func (fc *FeedCache) get(userID uint) (feedEntry, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	entry, ok := fc.entries[userID]
+	if !ok || time.Now().After(entry.expiresAt) {
+		delete(fc.entries, userID)
+		return feedEntry{}, false
+	}
+	return entry, true
+}
+
+func (fc *FeedCache) put(userID uint, entry feedEntry) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	// Попутно выбрасываем устаревшие записи, чтобы кеш не рос без ограничений
+	now := time.Now()
+	for id, e := range fc.entries {
+		if now.After(e.expiresAt) {
+			delete(fc.entries, id)
+		}
+	}
+	fc.entries[userID] = entry
+}
+
+// Invalidate сбрасывает закешированную ленту пользователя, например после смены подписок.
+func (fc *FeedCache) Invalidate(userID uint) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	delete(fc.entries, userID)
+}
+
+// loadChannel ищет пользователя-канал по параметру id и при ошибке сам отвечает клиенту.
+func (h *Handler) loadChannel(c *gin.Context) (*user.User, bool) {
+	var channel user.User
+	if err := h.DB.First(&channel, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch channel", "details": err.Error()})
+		return nil, false
+	}
+	return &channel, true
+}
+
+// isSubscribed проверяет подписку пользователя на канал.
+func (h *Handler) isSubscribed(subscriberID, channelID uint) (bool, error) {
+	var count int64
+	err := h.DB.Model(&Subscription{}).
+		Where("subscriber_id = ? AND channel_id = ?", subscriberID, channelID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetChannel отдаёт канал: число подписчиков, публичных видео и подписан ли текущий пользователь.
+func (h *Handler) GetChannel(c *gin.Context) {
+	channel, ok := h.loadChannel(c)
+	if !ok {
+		return
+	}
+
+	var videos int64
+	if err := h.DB.Model(&Video{}).
+		Where("author_id = ? AND visibility = ? AND status = ? AND moderation_status = ''", channel.ID, VisibilityPublic, StatusReady).
+		Count(&videos).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count videos", "details": err.Error()})
+		return
+	}
+
+	var subscribed interface{}
+	if u, err := h.currentUser(c); err == nil {
+		if subscribed, err = h.isSubscribed(u.ID, channel.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subscription", "details": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"channel_id":  channel.ID,
+		"username":    channel.Username,
+		"subscribers": channel.SubscriberCount,
+		"videos":      videos,
+		"subscribed":  subscribed,
+	})
+}
+
+// setSubscription подписывает или отписывает пользователя и обновляет счётчик подписчиков канала
+// в той же транзакции. Повторная подписка или отписка ничего не меняет.
+func (h *Handler) setSubscription(subscriberID, channelID uint, subscribe bool) error {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var result *gorm.DB
+		delta := "subscriber_count + 1"
+		if subscribe {
+			result = tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&Subscription{SubscriberID: subscriberID, ChannelID: channelID})
+		} else {
+			result = tx.Where("subscriber_id = ? AND channel_id = ?", subscriberID, channelID).Delete(&Subscription{})
+			delta = "subscriber_count - 1"
+		}
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&user.User{}).Where("id = ?", channelID).UpdateColumn("subscriber_count", gorm.Expr(delta)).Error
+	})
+	if err == nil {
+		h.Feeds.Invalidate(subscriberID)
+	}
+	return err
+}
+
+// subscriptionResponse отвечает состоянием подписки и актуальным числом подписчиков.
+func (h *Handler) subscriptionResponse(c *gin.Context, channelID uint, subscribed bool) {
+	var channel user.User
+	if err := h.DB.Select("id", "subscriber_count").First(&channel, channelID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch channel", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"channel_id": channelID, "subscribed": subscribed, "subscribers": channel.SubscriberCount})
+}
+
+// Subscribe подписывает текущего пользователя на канал.
+func (h *Handler) Subscribe(c *gin.Context) {
+	channel, ok := h.loadChannel(c)
+	if !ok {
+		return
+	}
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if u.ID == channel.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot subscribe to your own channel"})
+		return
+	}
+
+	if err := h.setSubscription(u.ID, channel.ID, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to subscribe", "details": err.Error()})
+		return
+	}
+	h.subscriptionResponse(c, channel.ID, true)
+}
+
+// Unsubscribe отписывает текущего пользователя от канала.
+func (h *Handler) Unsubscribe(c *gin.Context) {
+	channel, ok := h.loadChannel(c)
+	if !ok {
+		return
+	}
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.setSubscription(u.ID, channel.ID, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsubscribe", "details": err.Error()})
+		return
+	}
+	h.subscriptionResponse(c, channel.ID, false)
+}
+
+// ListSubscriptions отдаёт каналы, на которые подписан текущий пользователь, последние подписки первыми.
+func (h *Handler) ListSubscriptions(c *gin.Context) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	page, perPage, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	var total int64
+	if err := h.DB.Model(&Subscription{}).Where("subscriber_id = ?", u.ID).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count subscriptions", "details": err.Error()})
+		return
+	}
+
+	type channelRow struct {
+		ID              uint
+		Username        string
+		SubscriberCount int64
+		SubscribedAt    time.Time
+	}
+	var rows []channelRow
+	err = h.DB.Table("subscriptions s").
+		Select("u.id, u.username, u.subscriber_count, s.created_at AS subscribed_at").
+		Joins("JOIN users u ON u.id = s.channel_id").
+		Where("s.subscriber_id = ?", u.ID).
+		Order("s.created_at DESC").
+		Limit(perPage).
+		Offset((page - 1) * perPage).
+		Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subscriptions", "details": err.Error()})
+		return
+	}
+
+	channels := make([]gin.H, 0, len(rows))
+	for _, r := range rows {
+		channels = append(channels, gin.H{
+			"channel_id":    r.ID,
+			"username":      r.Username,
+			"subscribers":   r.SubscriberCount,
+			"subscribed_at": r.SubscribedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"page": page, "per_page": perPage, "total": total, "channels": channels})
+}
+
+// feedIDs возвращает ID видео ленты после cursor (0 - с начала), не больше limit+1.
+// Начало ленты берётся из кеша; дальше кеша лента читается из базы.
+func (h *Handler) feedIDs(userID uint, cursor uint64, limit int) ([]uint, error) {
+	entry, ok := h.Feeds.get(userID)
+	if !ok {
+		ids, err := h.queryFeed(userID, 0, feedCacheSize+1)
+		if err != nil {
+			return nil, err
+		}
+		entry = feedEntry{ids: ids, complete: len(ids) <= feedCacheSize, expiresAt: time.Now().Add(feedCacheTTL)}
+		if !entry.complete {
+			entry.ids = ids[:feedCacheSize]
+		}
+		h.Feeds.put(userID, entry)
+	}
+
+	start := 0
+	if cursor > 0 {
+		for start < len(entry.ids) && uint64(entry.ids[start]) >= cursor {
+			start++
+		}
+	}
+	if entry.complete || len(entry.ids)-start > limit {
+		return entry.ids[start:min(start+limit+1, len(entry.ids))], nil
+	}
+
+	// Страница выходит за закешированное начало ленты
+	return h.queryFeed(userID, cursor, limit+1)
+}
+
+// queryFeed читает ленту из базы: публичные готовые видео каналов из подписок, новые первыми.
+func (h *Handler) queryFeed(userID uint, cursor uint64, limit int) ([]uint, error) {
+	query := h.DB.Table("videos v").
+		Joins("JOIN subscriptions s ON s.channel_id = v.author_id").
+		Where("s.subscriber_id = ? AND v.visibility = ? AND v.status = ? AND v.moderation_status = ''", userID, VisibilityPublic, StatusReady)
+	if cursor > 0 {
+		query = query.Where("v.id < ?", cursor)
+	}
+
+	var ids []uint
+	err := query.Order("v.id DESC").Limit(limit).Pluck("v.id", &ids).Error
+	return ids, err
+}
+
+// GetFeed отдаёт новые публичные видео каналов, на которые подписан пользователь, новые первыми.
+// Листается курсором: next_cursor из ответа передаётся в cursor.
+func (h *Handler) GetFeed(c *gin.Context) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	cursor, limit, ok := cursorParams(c)
+	if !ok {
+		return
+	}
+
+	ids, err := h.feedIDs(u.ID, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feed", "details": err.Error()})
+		return
+	}
+
+	var next *string
+	if len(ids) > limit {
+		ids = ids[:limit]
+		s := strconv.FormatUint(uint64(ids[limit-1]), 10)
+		next = &s
+	}
+
+	rows, err := h.publicVideosByID(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch videos", "details": err.Error()})
+		return
+	}
+	videos := make([]gin.H, 0, len(rows))
+	for _, r := range rows {
+		if r != nil {
+			videos = append(videos, r.response())
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"videos": videos, "next_cursor": next})
+}
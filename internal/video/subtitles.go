@@ -0,0 +1,372 @@
+package video
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toxanetoxa/gohls/internal/media"
+	"gorm.io/gorm"
+)
+
+// Папка с субтитрами внутри MediaDir и префикс их плейлистов внутри hls/
+const (
+	subtitlesDir    = "subtitles"
+	subtitlesHLSDir = "subs"
+)
+
+// Максимальный размер файла субтитров
+const maxSubtitleSize = 2 << 20
+
+// Реплики не могут заканчиваться позже длительности видео плюс subtitleEndMargin,
+// а пока длительность неизвестна - позже maxSubtitleEnd. Это же ограничивает число сегментов HLS.
+const (
+	subtitleEndMargin = time.Minute
+	maxSubtitleEnd    = 24 * time.Hour
+)
+
+var languageRe = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// SubtitleTrack - дорожка субтитров видео. Хранится уже в формате WebVTT.
+type SubtitleTrack struct {
+	ID        uint   `gorm:"primaryKey"`
+	VideoID   uint   `gorm:"not null"`
+	Language  string `gorm:"not null"` // BCP 47, например en или ru
+	Label     string `gorm:"not null"`
+	IsDefault bool   `gorm:"not null;default:false"`
+	FileKey   string `gorm:"not null"` // Путь относительно MediaDir
+	// Конец последней реплики и длина сегментов, на которые дорожка нарезана для HLS (0 - не нарезана)
+	Duration        float64   `gorm:"not null;default:0"`
+	SegmentDuration int       `gorm:"not null;default:0"`
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+}
+
+func (SubtitleTrack) TableName() string {
+	return "subtitle_tracks"
+}
+
+type subtitleTrackResponse struct {
+	ID        uint   `json:"id"`
+	Language  string `json:"language"`
+	Label     string `json:"label"`
+	IsDefault bool   `json:"default"`
+	URL       string `json:"url"`
+}
+
+// ListSubtitles возвращает дорожки субтитров видео.
+func (h *Handler) ListSubtitles(c *gin.Context) {
+	v, ok := h.loadWatchableVideo(c)
+	if !ok {
+		return
+	}
+
+	var tracks []SubtitleTrack
+	if err := h.DB.Where("video_id = ?", v.ID).Order("id").Find(&tracks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subtitles", "details": err.Error()})
+		return
+	}
+
+	result := make([]subtitleTrackResponse, 0, len(tracks))
+	for _, t := range tracks {
+		result = append(result, subtitleTrackResponse{
+			ID:        t.ID,
+			Language:  t.Language,
+			Label:     t.Label,
+			IsDefault: t.IsDefault,
+			URL:       fmt.Sprintf("/videos/%d/subtitles/%d.vtt", v.ID, t.ID),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subtitles": result})
+}
+
+// UploadSubtitle принимает субтитры в SRT или WebVTT и сохраняет их как WebVTT.
+func (h *Handler) UploadSubtitle(c *gin.Context) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireOwner(c, v) {
+		return
+	}
+
+	language := c.PostForm("language")
+	if !languageRe.MatchString(language) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Valid language code is required (e.g. en, ru, pt-BR)"})
+		return
+	}
+
+	label := strings.TrimSpace(c.PostForm("label"))
+	if label == "" {
+		label = language
+	}
+	isDefault, _ := strconv.ParseBool(c.PostForm("default"))
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get file", "details": err.Error()})
+		return
+	}
+	if fileHeader.Size > maxSubtitleSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Subtitle file is too large"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file", "details": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSubtitleSize))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file", "details": err.Error()})
+		return
+	}
+
+	cues, err := media.ParseSubtitles(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid SRT or WebVTT file", "details": err.Error()})
+		return
+	}
+	if limit := subtitleEndLimit(v); cuesEnd(cues) > limit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Subtitle cues must end before %s", media.FormatVTTTimestamp(limit))})
+		return
+	}
+
+	if err := os.MkdirAll(v.MediaPath(subtitlesDir), os.ModePerm); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subtitles directory", "details": err.Error()})
+		return
+	}
+
+	track := SubtitleTrack{
+		VideoID:   v.ID,
+		Language:  language,
+		Label:     label,
+		IsDefault: isDefault,
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		// Дорожка по умолчанию может быть только одна
+		if isDefault {
+			if err := tx.Model(&SubtitleTrack{}).Where("video_id = ?", v.ID).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&track).Error; err != nil {
+			return err
+		}
+
+		track.FileKey = path.Join(subtitlesDir, fmt.Sprintf("%d.vtt", track.ID))
+		if err := os.WriteFile(v.MediaPath(track.FileKey), []byte(media.WriteVTT(cues, "")), 0o644); err != nil {
+			return err
+		}
+		if err := tx.Model(&track).Update("file_key", track.FileKey).Error; err != nil {
+			return err
+		}
+		return writeSubtitleSegments(tx, v, &track, cues)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save subtitles", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "Subtitles uploaded successfully",
+		"subtitle_id": track.ID,
+		"cues":        len(cues),
+	})
+}
+
+// DeleteSubtitle удаляет дорожку субтитров.
+func (h *Handler) DeleteSubtitle(c *gin.Context) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireOwner(c, v) {
+		return
+	}
+
+	track, ok := h.loadSubtitleTrack(c, v, c.Param("track"))
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Delete(track).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete subtitles", "details": err.Error()})
+		return
+	}
+	_ = os.Remove(v.MediaPath(track.FileKey))
+	_ = os.RemoveAll(v.MediaPath(subtitleSegmentsDir(track)))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Subtitles deleted"})
+}
+
+// GetSubtitle отдаёт дорожку субтитров целиком в формате WebVTT.
+func (h *Handler) GetSubtitle(c *gin.Context) {
+	v, ok := h.loadWatchableVideo(c)
+	if !ok {
+		return
+	}
+
+	track, ok := h.loadSubtitleTrack(c, v, strings.TrimSuffix(c.Param("track"), ".vtt"))
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/vtt")
+	c.Header("Cache-Control", cacheControl(v, time.Hour, ""))
+	c.File(v.MediaPath(track.FileKey))
+}
+
+func (h *Handler) loadSubtitleTrack(c *gin.Context, v *Video, trackID string) (*SubtitleTrack, bool) {
+	var track SubtitleTrack
+	if err := h.DB.Where("id = ? AND video_id = ?", trackID, v.ID).First(&track).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subtitle track not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subtitles", "details": err.Error()})
+		return nil, false
+	}
+	return &track, true
+}
+
+// serveSubtitleHLS отдаёт сегментированные субтитры для HLS: <track>/index.m3u8 и <track>/seg_N.vtt.
+// Сегменты нарезаны при загрузке по длительности видеосегментов, запросы файл субтитров не разбирают.
+func (h *Handler) serveSubtitleHLS(c *gin.Context, v *Video, p string) {
+	trackID, name := path.Split(p)
+	track, ok := h.loadSubtitleTrack(c, v, strings.TrimSuffix(trackID, "/"))
+	if !ok {
+		return
+	}
+
+	// Дорожки, загруженные до нарезки или при другой длине сегментов, нарезаются один раз при первом запросе
+	if track.SegmentDuration != hlsSegmentDuration {
+		if err := h.resegmentSubtitles(v, track); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to segment subtitles", "details": err.Error()})
+			return
+		}
+	}
+
+	// Плейлист субтитров совпадает по длине с видео, но не длиннее допустимого конца реплик
+	duration := math.Min(math.Max(v.Duration, track.Duration), subtitleEndLimit(v))
+	segment := float64(hlsSegmentDuration)
+	count := int(math.Ceil(duration / segment))
+
+	if name == "index.m3u8" {
+		var b strings.Builder
+		fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n", hlsSegmentDuration)
+		for i := 0; i < count; i++ {
+			fmt.Fprintf(&b, "#EXTINF:%.3f,\nseg_%05d.vtt\n", math.Min(segment, duration-float64(i)*segment), i)
+		}
+		b.WriteString("#EXT-X-ENDLIST\n")
+
+		c.Header("Cache-Control", "no-cache")
+		c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(b.String()))
+		return
+	}
+
+	var index int
+	if _, err := fmt.Sscanf(name, "seg_%05d.vtt", &index); err != nil || index < 0 || index >= count {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Segment not found"})
+		return
+	}
+
+	c.Header("Cache-Control", cacheControl(v, time.Hour, ""))
+	segmentPath := v.MediaPath(path.Join(subtitleSegmentsDir(track), subtitleSegmentName(index)))
+	if _, err := os.Stat(segmentPath); err != nil {
+		// Сегменты без реплик не сохраняются
+		c.Data(http.StatusOK, "text/vtt", []byte(media.WriteVTT(nil, subtitleTimestampMap)))
+		return
+	}
+	c.Header("Content-Type", "text/vtt")
+	c.File(segmentPath)
+}
+
+// Привязка времени WebVTT к видеосегментам HLS
+const subtitleTimestampMap = "X-TIMESTAMP-MAP=MPEGTS:0,LOCAL:00:00:00.000"
+
+func subtitleSegmentsDir(track *SubtitleTrack) string {
+	return path.Join(subtitlesDir, strconv.FormatUint(uint64(track.ID), 10))
+}
+
+func subtitleSegmentName(index int) string {
+	return fmt.Sprintf("seg_%05d.vtt", index)
+}
+
+// subtitleEndLimit возвращает, до какого момента могут идти реплики видео.
+func subtitleEndLimit(v *Video) float64 {
+	if v.Duration > 0 {
+		return v.Duration + subtitleEndMargin.Seconds()
+	}
+	return maxSubtitleEnd.Seconds()
+}
+
+// cuesEnd возвращает конец самой поздней реплики.
+func cuesEnd(cues []media.Cue) float64 {
+	var end float64
+	for _, cue := range cues {
+		end = max(end, cue.End)
+	}
+	return end
+}
+
+// writeSubtitleSegments нарезает реплики на сегменты длиной hlsSegmentDuration и запоминает параметры нарезки.
+// Реплики, пересекающие границу, попадают в оба сегмента - плееры это учитывают.
+func writeSubtitleSegments(db *gorm.DB, v *Video, track *SubtitleTrack, cues []media.Cue) error {
+	dir := v.MediaPath(subtitleSegmentsDir(track))
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	// Реплики за пределом допустимого конца (старые дорожки) в сегменты не попадают
+	limit := subtitleEndLimit(v)
+	segment := float64(hlsSegmentDuration)
+	segments := map[int][]media.Cue{}
+	for _, cue := range cues {
+		if cue.Start >= limit {
+			continue
+		}
+		first := int(cue.Start / segment)
+		last := int(math.Ceil(math.Min(cue.End, limit)/segment)) - 1
+		for i := first; i <= max(first, last); i++ {
+			segments[i] = append(segments[i], cue)
+		}
+	}
+	for i, segmentCues := range segments {
+		data := media.WriteVTT(segmentCues, subtitleTimestampMap)
+		if err := os.WriteFile(filepath.Join(dir, subtitleSegmentName(i)), []byte(data), 0o644); err != nil {
+			return err
+		}
+	}
+
+	track.Duration = math.Min(cuesEnd(cues), limit)
+	track.SegmentDuration = hlsSegmentDuration
+	return db.Model(track).Updates(map[string]interface{}{
+		"duration":         track.Duration,
+		"segment_duration": track.SegmentDuration,
+	}).Error
+}
+
+// resegmentSubtitles нарезает сохранённую дорожку заново.
+func (h *Handler) resegmentSubtitles(v *Video, track *SubtitleTrack) error {
+	data, err := os.ReadFile(v.MediaPath(track.FileKey))
+	if err != nil {
+		return err
+	}
+	cues, err := media.ParseSubtitles(data)
+	if err != nil {
+		return err
+	}
+	return writeSubtitleSegments(h.DB, v, track, cues)
+}
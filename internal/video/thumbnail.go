@@ -0,0 +1,274 @@
+package video
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toxanetoxa/gohls/internal/media"
+)
+
+// Папка с обложками внутри MediaDir
+const thumbsDir = "thumbs"
+
+// Максимальный размер пользовательской обложки в пикселях, больше - отказ до декодирования
+const maxThumbnailPixels = 40_000_000
+
+// Допустимые ширины обложек, запрошенная ширина округляется вверх до ближайшей
+var thumbnailWidths = []int{160, 320, 640, 1280}
+
+// PosterFrameKeys возвращает ключи кадров-кандидатов.
+func (v *Video) PosterFrameKeys() []string {
+	if v.PosterFrames == "" {
+		return nil
+	}
+	return strings.Split(v.PosterFrames, ",")
+}
+
+// posterFramesStep извлекает кадры-кандидаты для обложки.
+func (h *Handler) posterFramesStep() Step {
+	return Step{
+		Name: "poster_frames",
+		Run: func(ctx context.Context, v *Video) error {
+			if err := os.MkdirAll(v.MediaPath(thumbsDir), os.ModePerm); err != nil {
+				return err
+			}
+
+			var keys []string
+			for i, pos := range posterPositions {
+				key := path.Join(thumbsDir, fmt.Sprintf("frame_%d.jpg", i))
+				if err := h.FFmpeg.ExtractFrame(ctx, v.FilePath, v.Duration*pos, v.MediaPath(key)); err != nil {
+					return err
+				}
+				keys = append(keys, key)
+			}
+
+			updates := map[string]interface{}{"poster_frames": strings.Join(keys, ",")}
+			// Обложку по умолчанию выставляем, только если автор ещё не выбрал свою
+			if v.ThumbnailKey == "" && len(keys) > 0 {
+				updates["thumbnail_key"] = keys[0]
+			}
+			return h.DB.Model(v).Updates(updates).Error
+		},
+	}
+}
+
+// ListThumbnails возвращает выбранную обложку и кадры-кандидаты.
+func (h *Handler) ListThumbnails(c *gin.Context) {
+	v, ok := h.loadWatchableVideo(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"selected":   v.ThumbnailKey,
+		"candidates": v.PosterFrameKeys(),
+	})
+}
+
+type SelectThumbnailRequest struct {
+	Key string `json:"key" binding:"required"`
+}
+
+// SelectThumbnail выбирает обложку из кадров-кандидатов.
+func (h *Handler) SelectThumbnail(c *gin.Context) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireOwner(c, v) {
+		return
+	}
+
+	var req SelectThumbnailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	found := false
+	for _, key := range v.PosterFrameKeys() {
+		if key == req.Key {
+			found = true
+			break
+		}
+	}
+	if !found {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown thumbnail key"})
+		return
+	}
+
+	if err := h.DB.Model(v).Update("thumbnail_key", req.Key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update thumbnail", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Thumbnail updated", "thumbnail_key": req.Key})
+}
+
+// UploadThumbnail загружает пользовательскую обложку (JPEG или PNG).
+func (h *Handler) UploadThumbnail(c *gin.Context) {
+	v, ok := h.loadVideo(c)
+	if !ok || !h.requireOwner(c, v) {
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get file", "details": err.Error()})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file", "details": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	img, err := media.DecodeImageLimited(file, maxThumbnailPixels)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is not a valid JPEG or PNG image", "details": err.Error()})
+		return
+	}
+
+	if err := os.MkdirAll(v.MediaPath(thumbsDir), os.ModePerm); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create thumbnails directory", "details": err.Error()})
+		return
+	}
+
+	// Случайный ключ: у каждой загрузки свой файл и свой кеш уменьшенных копий
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate thumbnail key", "details": err.Error()})
+		return
+	}
+	key := path.Join(thumbsDir, "custom_"+hex.EncodeToString(suffix)+".jpg")
+	out, err := os.Create(v.MediaPath(key))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save thumbnail", "details": err.Error()})
+		return
+	}
+	defer out.Close()
+
+	if err := media.EncodeJPEG(out, img); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode thumbnail", "details": err.Error()})
+		return
+	}
+
+	if err := h.DB.Model(v).Update("thumbnail_key", key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update thumbnail", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Thumbnail uploaded", "thumbnail_key": key})
+}
+
+// GetThumbnail отдаёт обложку видео, ширина задаётся параметром w.
+func (h *Handler) GetThumbnail(c *gin.Context) {
+	v, ok := h.loadWatchableVideo(c)
+	if !ok {
+		return
+	}
+
+	if v.ThumbnailKey == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Thumbnail is not ready yet"})
+		return
+	}
+
+	width := 0
+	if w := c.Query("w"); w != "" {
+		parsed, err := strconv.Atoi(w)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid width"})
+			return
+		}
+		width = snapWidth(parsed)
+	}
+
+	filePath, err := h.thumbnailFile(v, width)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare thumbnail", "details": err.Error()})
+		return
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open thumbnail", "details": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file info", "details": err.Error()})
+		return
+	}
+
+	// Ключ обложки меняется при выборе новой, поэтому ETag от него стабилен
+	c.Header("Cache-Control", cacheControl(v, 24*time.Hour, ""))
+	c.Header("ETag", fmt.Sprintf(`"%s-%d"`, strings.ReplaceAll(v.ThumbnailKey, "/", "-"), width))
+	c.Header("Content-Type", "image/jpeg")
+	http.ServeContent(c.Writer, c.Request, fileInfo.Name(), fileInfo.ModTime(), file)
+}
+
+// thumbnailFile возвращает путь к обложке нужной ширины, при необходимости масштабируя её.
+func (h *Handler) thumbnailFile(v *Video, width int) (string, error) {
+	original := v.MediaPath(v.ThumbnailKey)
+	if width == 0 {
+		return original, nil
+	}
+
+	base := strings.TrimSuffix(filepath.Base(original), filepath.Ext(original))
+	resized := v.MediaPath(path.Join(thumbsDir, "cache", fmt.Sprintf("%s_w%d.jpg", base, width)))
+	if _, err := os.Stat(resized); err == nil {
+		return resized, nil
+	}
+
+	src, err := os.Open(original)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	img, err := media.DecodeImage(src)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(resized), os.ModePerm); err != nil {
+		return "", err
+	}
+
+	// Пишем во временный файл, чтобы параллельный запрос не получил недописанную картинку
+	tmp := resized + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	if err := media.EncodeJPEG(out, media.ResizeToWidth(img, width)); err != nil {
+		out.Close()
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+
+	return resized, os.Rename(tmp, resized)
+}
+
+// snapWidth округляет ширину вверх до ближайшей допустимой.
+func snapWidth(w int) int {
+	for _, allowed := range thumbnailWidths {
+		if w <= allowed {
+			return allowed
+		}
+	}
+	return thumbnailWidths[len(thumbnailWidths)-1]
+}
@@ -0,0 +1,204 @@
+package video
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toxanetoxa/gohls/internal/media"
+	"github.com/toxanetoxa/gohls/internal/quota"
+	"github.com/toxanetoxa/gohls/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// errTypeNotAllowed - контейнер распознан, но запрещён настройками.
+var errTypeNotAllowed = errors.New("video type is not allowed")
+
+// Запас на заголовки multipart и текстовые поля при проверке Content-Length до чтения тела
+const multipartOverhead = 64 << 10
+
+// Максимальная длина текстового поля формы загрузки
+const maxFormFieldSize = 16 << 10
+
+// Расширения сохранённых файлов по определённому типу контейнера
+var uploadExtensions = map[string]string{
+	media.MimeMP4:       ".mp4",
+	media.MimeQuickTime: ".mov",
+	media.MimeWebM:      ".webm",
+	media.MimeMatroska:  ".mkv",
+	media.MimeMPEGTS:    ".ts",
+}
+
+// storedUploadPath придумывает имя файла в uploads. Имя клиента не используется:
+// одинаковые имена у разных пользователей перезаписывали бы чужие файлы.
+func storedUploadPath(mimeType string) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return filepath.Join("uploads", hex.EncodeToString(buf)+uploadExtensions[mimeType]), nil
+}
+
+// detectUploadType определяет MIME-тип сохранённого файла по содержимому и проверяет списки разрешений.
+func detectUploadType(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	mimeType, err := media.SniffContainer(f, info.Size())
+	if err != nil {
+		return "", err
+	}
+	if slices.Contains(uploadDeniedTypes, mimeType) || !slices.Contains(uploadAllowedTypes, mimeType) {
+		return mimeType, fmt.Errorf("%w: %s", errTypeNotAllowed, mimeType)
+	}
+	return mimeType, nil
+}
+
+// upload - принятая форма загрузки.
+type upload struct {
+	Title       string
+	Description string
+	Language    string
+	Tags        []string // Теги из всех полей tags, каждое через запятую
+	Category    string   // Slug раздела каталога
+	TmpPath     string   // Файл во временном имени, переименовывается после проверок
+	Size        int64
+}
+
+// errFileTooLarge - файл превысил допустимый размер во время приёма.
+var errFileTooLarge = errors.New("file is too large")
+
+// receiveUpload читает multipart-форму потоком и пишет файл на диск, обрывая приём, как только
+// файл превысит maxSize (0 - без ограничения). Форма целиком в памяти и во временных файлах не копится.
+func receiveUpload(c *gin.Context, maxSize int64) (*upload, error) {
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	u := &upload{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			u.discard()
+			return nil, err
+		}
+
+		switch part.FormName() {
+		case "title", "description", "language", "tags", "category":
+			data, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize))
+			if err != nil {
+				u.discard()
+				return nil, err
+			}
+			value := strings.TrimSpace(string(data))
+			switch part.FormName() {
+			case "title":
+				u.Title = value
+			case "description":
+				u.Description = value
+			case "language":
+				u.Language = value
+			case "tags":
+				u.Tags = append(u.Tags, splitTags(value)...)
+			case "category":
+				u.Category = value
+			}
+		case "file":
+			if u.TmpPath != "" {
+				u.discard()
+				return nil, errors.New("only one file can be uploaded")
+			}
+			if err := u.save(part, maxSize); err != nil {
+				u.discard()
+				return nil, err
+			}
+		}
+		part.Close()
+	}
+
+	if u.TmpPath == "" {
+		return nil, http.ErrMissingFile
+	}
+	return u, nil
+}
+
+// save копирует файл формы во временный файл в uploads.
+func (u *upload) save(r io.Reader, maxSize int64) error {
+	f, err := os.CreateTemp("uploads", "upload-*.part")
+	if err != nil {
+		return err
+	}
+	u.TmpPath = f.Name()
+
+	src := r
+	if maxSize > 0 {
+		// Читаем на байт больше лимита, чтобы отличить файл ровно по лимиту от превышения
+		src = io.LimitReader(r, maxSize+1)
+	}
+	u.Size, err = io.Copy(f, src)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && u.Size > maxSize {
+		return errFileTooLarge
+	}
+	return nil
+}
+
+// discard удаляет временный файл отклонённой загрузки.
+func (u *upload) discard() {
+	if u.TmpPath != "" {
+		os.Remove(u.TmpPath)
+	}
+}
+
+// sizeExceeded выбирает причину отказа по размеру: не хватило места или слишком большой файл.
+func sizeExceeded(limits quota.Limits, usage quota.Usage, size int64) *quota.Exceeded {
+	if limits.MaxFileSize > 0 && size > limits.MaxFileSize {
+		return quota.NewExceeded(quota.ReasonFileSize, limits, usage)
+	}
+	return quota.NewExceeded(quota.ReasonBytes, limits, usage)
+}
+
+// backfillFileSizes проставляет размер файлам видео, загруженных до появления квот,
+// чтобы они учитывались в занятом месте.
+func backfillFileSizes(db *gorm.DB) {
+	var videos []Video
+	if err := db.Where("file_size = 0").Select("id", "file_path").Find(&videos).Error; err != nil {
+		logger.Logger.Errorw("Failed to find videos without file size", "error", err)
+		return
+	}
+	for _, v := range videos {
+		info, err := os.Stat(v.FilePath)
+		if err != nil {
+			// Файл мог быть перенесён в карантин или удалён, место он больше не занимает
+			continue
+		}
+		if err := db.Model(&Video{}).Where("id = ?", v.ID).UpdateColumn("file_size", info.Size()).Error; err != nil {
+			logger.Logger.Errorw("Failed to backfill video file size", "video_id", v.ID, "error", err)
+		}
+	}
+}
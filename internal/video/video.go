@@ -3,17 +3,47 @@ package video
 import (
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 )
 
+// Статусы обработки видео
+const (
+	StatusProcessing = "processing"
+	StatusReady      = "ready"
+	StatusFailed     = "failed"
+	StatusRejected   = "rejected" // Отклонено проверкой, причина в RejectionReason
+)
+
 type Video struct {
-	ID        uint      `gorm:"primaryKey"`
-	Title     string    `gorm:"not null"`
-	FilePath  string    `gorm:"not null"`
-	AuthorID  uint      `gorm:"not null"`
-	CreatedAt time.Time `gorm:"autoCreateTime"`
-	UpdatedAt time.Time `gorm:"autoUpdateTime"`
-	Views     []View    `gorm:"foreignKey:VideoID"` // Связь с таблицей video_views
+	ID               uint   `gorm:"primaryKey"`
+	Title            string `gorm:"not null"`
+	Description      string `gorm:"not null;default:''"`
+	Language         string // Язык названия и описания (ru, en), от него зависит морфология поиска
+	CategoryID       *uint  // Раздел каталога, nil - без раздела
+	FilePath         string `gorm:"not null"`
+	FileSize         int64  // Размер исходного файла в байтах, учитывается в квоте автора
+	MimeType         string `gorm:"not null;default:video/mp4"` // Определяется по содержимому при загрузке
+	AuthorID         uint   `gorm:"not null"`
+	Status           string `gorm:"not null;default:processing"`
+	ScanStatus       string // pending, clean, infected, failed; пусто - проверка не проводилась
+	ScanAttempts     int    `gorm:"not null;default:0"` // Неудачные попытки проверки из-за недоступного сканера
+	RejectionReason  string
+	Visibility       string     `gorm:"not null;default:public"`
+	IsPaid           bool       `gorm:"not null;default:false"` // Смотреть могут только пользователи с Entitlement
+	LikeCount        int64      `gorm:"not null;default:0"`     // Счётчики реакций, меняются вместе с video_reactions
+	DislikeCount     int64      `gorm:"not null;default:0"`
+	CommentsDisabled bool       `gorm:"not null;default:false"` // Автор отключил комментарии
+	ModerationStatus string     `gorm:"not null;default:''"`    // hidden, taken_down; пусто - без ограничений модерации
+	ModerationReason string     `gorm:"not null;default:''"`    // Причина последнего решения модератора
+	AgeRestricted    bool       `gorm:"not null;default:false"` // Смотреть могут только авторизованные зрители, возраст не проверяется
+	Duration         float64    // Длительность в секундах, заполняется при обработке
+	PublishedAt      *time.Time // Когда видео впервые стало публичным и готовым; подписчики уведомляются один раз
+	ThumbnailKey     string     // Выбранная обложка, путь относительно MediaDir
+	PosterFrames     string     // Кадры-кандидаты для обложки через запятую
+	CreatedAt        time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt        time.Time  `gorm:"autoUpdateTime"`
+	Views            []View     `gorm:"foreignKey:VideoID"` // Связь с таблицей video_views
 }
 
 type View struct {
@@ -23,6 +53,10 @@ type View struct {
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 }
 
+func (View) TableName() string {
+	return "video_views"
+}
+
 // EnsureUploadsDir проверяет наличие папки uploads и создаёт её, если она отсутствует.
 func EnsureUploadsDir() error {
 	uploadsDir := filepath.Join(".", "uploads")
@@ -33,3 +67,13 @@ func EnsureUploadsDir() error {
 	}
 	return nil
 }
+
+// MediaDir возвращает папку с производными файлами видео (обложки, плейлисты и т. п.).
+func MediaDir(videoID uint) string {
+	return filepath.Join("uploads", "media", strconv.FormatUint(uint64(videoID), 10))
+}
+
+// MediaPath возвращает полный путь к производному файлу видео по его ключу.
+func (v *Video) MediaPath(key string) string {
+	return filepath.Join(MediaDir(v.ID), filepath.FromSlash(key))
+}
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id           SERIAL PRIMARY KEY,                  -- Автоинкрементируемый первичный ключ
+    user_id      INTEGER      NOT NULL,               -- Владелец ключа
+    name         VARCHAR(255) NOT NULL,               -- Название ключа
+    prefix       VARCHAR(32)  UNIQUE NOT NULL,        -- Видимый префикс ключа
+    key_hash     VARCHAR(64)  NOT NULL,               -- sha256-хеш ключа
+    scopes       TEXT         NOT NULL,               -- Области через запятую
+    expires_at   TIMESTAMP DEFAULT NULL,              -- Время истечения (NULL - бессрочный)
+    last_used_at TIMESTAMP DEFAULT NULL,              -- Время последнего использования
+    revoked_at   TIMESTAMP DEFAULT NULL,              -- Время отзыва
+    created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Время создания записи
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
@@ -0,0 +1,5 @@
+ALTER TABLE videos
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS duration,
+    DROP COLUMN IF EXISTS thumbnail_key,
+    DROP COLUMN IF EXISTS poster_frames;
@@ -0,0 +1,8 @@
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS status        VARCHAR(32)      NOT NULL DEFAULT 'processing', -- Статус обработки
+    ADD COLUMN IF NOT EXISTS duration      DOUBLE PRECISION NOT NULL DEFAULT 0,            -- Длительность в секундах
+    ADD COLUMN IF NOT EXISTS thumbnail_key TEXT             NOT NULL DEFAULT '',           -- Выбранная обложка
+    ADD COLUMN IF NOT EXISTS poster_frames TEXT             NOT NULL DEFAULT '';           -- Кадры-кандидаты через запятую
+
+-- Уже загруженные видео считаем готовыми
+UPDATE videos SET status = 'ready' WHERE status = 'processing';
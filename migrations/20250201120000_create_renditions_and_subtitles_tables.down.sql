@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS subtitle_tracks;
+DROP TABLE IF EXISTS video_renditions;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS video_renditions
+(
+    id         SERIAL PRIMARY KEY,                  -- Автоинкрементируемый первичный ключ
+    video_id   INTEGER      NOT NULL,               -- ID видео
+    name       VARCHAR(32)  NOT NULL,               -- Название представления, например 720p
+    width      INTEGER      NOT NULL,               -- Ширина кадра
+    height     INTEGER      NOT NULL,               -- Высота кадра
+    bandwidth  INTEGER      NOT NULL,               -- Пиковый битрейт в бит/с
+    codecs     VARCHAR(255) NOT NULL,               -- Кодеки для атрибута CODECS
+    playlist   TEXT         NOT NULL,               -- Путь к плейлисту относительно папки hls
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Время создания записи
+    FOREIGN KEY (video_id) REFERENCES videos (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_renditions_video_id ON video_renditions (video_id);
+
+CREATE TABLE IF NOT EXISTS subtitle_tracks
+(
+    id         SERIAL PRIMARY KEY,                  -- Автоинкрементируемый первичный ключ
+    video_id   INTEGER      NOT NULL,               -- ID видео
+    language   VARCHAR(35)  NOT NULL,               -- Язык в формате BCP 47
+    label      VARCHAR(255) NOT NULL,               -- Название дорожки для плеера
+    is_default BOOLEAN      NOT NULL DEFAULT FALSE, -- Дорожка по умолчанию
+    file_key   TEXT         NOT NULL DEFAULT '',    -- Путь к WebVTT-файлу
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Время создания записи
+    FOREIGN KEY (video_id) REFERENCES videos (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_subtitle_tracks_video_id ON subtitle_tracks (video_id);
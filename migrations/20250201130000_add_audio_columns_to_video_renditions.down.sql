@@ -0,0 +1,6 @@
+ALTER TABLE video_renditions
+    DROP COLUMN IF EXISTS type,
+    DROP COLUMN IF EXISTS language,
+    DROP COLUMN IF EXISTS label,
+    DROP COLUMN IF EXISTS is_default,
+    DROP COLUMN IF EXISTS stream_index;
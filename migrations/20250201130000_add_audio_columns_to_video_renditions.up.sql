@@ -0,0 +1,6 @@
+ALTER TABLE video_renditions
+    ADD COLUMN IF NOT EXISTS type         VARCHAR(16)  NOT NULL DEFAULT 'video', -- video или audio
+    ADD COLUMN IF NOT EXISTS language     VARCHAR(35)  NOT NULL DEFAULT '',      -- Язык аудиодорожки
+    ADD COLUMN IF NOT EXISTS label        VARCHAR(255) NOT NULL DEFAULT '',      -- Название аудиодорожки
+    ADD COLUMN IF NOT EXISTS is_default   BOOLEAN      NOT NULL DEFAULT FALSE,   -- Основная аудиодорожка
+    ADD COLUMN IF NOT EXISTS stream_index INTEGER      NOT NULL DEFAULT 0;       -- Номер аудиодорожки в исходнике
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS video_keys;
+DROP TABLE IF EXISTS video_entitlements;
+
+ALTER TABLE videos
+    DROP COLUMN IF EXISTS visibility,
+    DROP COLUMN IF EXISTS is_paid;
@@ -0,0 +1,28 @@
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS visibility VARCHAR(16) NOT NULL DEFAULT 'public', -- public, unlisted или private
+    ADD COLUMN IF NOT EXISTS is_paid    BOOLEAN     NOT NULL DEFAULT FALSE;    -- Платное видео
+
+CREATE TABLE IF NOT EXISTS video_entitlements
+(
+    id         SERIAL PRIMARY KEY,                  -- Автоинкрементируемый первичный ключ
+    video_id   INTEGER NOT NULL,                    -- ID видео
+    user_id    INTEGER NOT NULL,                    -- ID пользователя с доступом
+    expires_at TIMESTAMP DEFAULT NULL,              -- Время окончания доступа (NULL - бессрочно)
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Время создания записи
+    FOREIGN KEY (video_id) REFERENCES videos (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    UNIQUE (video_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS video_keys
+(
+    id            SERIAL PRIMARY KEY,                  -- Автоинкрементируемый первичный ключ
+    video_id      INTEGER     NOT NULL,                -- ID видео
+    kid           VARCHAR(32) UNIQUE NOT NULL,         -- Идентификатор ключа в URI
+    iv            VARCHAR(32) NOT NULL,                -- Вектор инициализации в hex
+    encrypted_key BYTEA       NOT NULL,                -- Ключ, зашифрованный мастер-ключом
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Время создания записи
+    FOREIGN KEY (video_id) REFERENCES videos (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_keys_video_id ON video_keys (video_id);
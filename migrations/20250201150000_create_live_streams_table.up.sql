@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS live_streams
+(
+    id          SERIAL PRIMARY KEY,                  -- Автоинкрементируемый первичный ключ
+    user_id     INTEGER      NOT NULL,               -- ID автора трансляции
+    title       VARCHAR(255) NOT NULL,               -- Название трансляции
+    stream_key  VARCHAR(64)  UNIQUE NOT NULL,        -- Ключ для кодировщика
+    status      VARCHAR(16)  NOT NULL DEFAULT 'idle', -- idle, live или ended
+    session_dir VARCHAR(255) DEFAULT NULL,           -- Папка с сегментами текущего или последнего эфира
+    started_at  TIMESTAMP    DEFAULT NULL,           -- Начало последнего эфира
+    ended_at    TIMESTAMP    DEFAULT NULL,           -- Окончание последнего эфира
+    created_at  TIMESTAMP    DEFAULT CURRENT_TIMESTAMP, -- Время создания записи
+    updated_at  TIMESTAMP    DEFAULT CURRENT_TIMESTAMP, -- Время последнего обновления записи
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_live_streams_user_id ON live_streams (user_id);
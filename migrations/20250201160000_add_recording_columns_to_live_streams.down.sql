@@ -0,0 +1,5 @@
+ALTER TABLE live_streams
+    DROP COLUMN IF EXISTS record_vod,
+    DROP COLUMN IF EXISTS trim_start,
+    DROP COLUMN IF EXISTS trim_end,
+    DROP COLUMN IF EXISTS video_id;
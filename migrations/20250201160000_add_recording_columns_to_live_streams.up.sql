@@ -0,0 +1,5 @@
+ALTER TABLE live_streams
+    ADD COLUMN IF NOT EXISTS record_vod BOOLEAN          NOT NULL DEFAULT TRUE, -- Сохранять эфир как видео после окончания
+    ADD COLUMN IF NOT EXISTS trim_start DOUBLE PRECISION NOT NULL DEFAULT 0,    -- Сколько секунд обрезать в начале записи
+    ADD COLUMN IF NOT EXISTS trim_end   DOUBLE PRECISION NOT NULL DEFAULT 0,    -- Сколько секунд обрезать в конце записи
+    ADD COLUMN IF NOT EXISTS video_id   INTEGER DEFAULT NULL REFERENCES videos (id) ON DELETE SET NULL; -- Видео с записью последнего эфира
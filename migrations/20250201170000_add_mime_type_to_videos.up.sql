@@ -0,0 +1,8 @@
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS mime_type VARCHAR(64) NOT NULL DEFAULT 'video/mp4'; -- Тип контейнера, определённый по содержимому файла
+
+-- Для уже загруженных файлов тип восстанавливаем по расширению
+UPDATE videos SET mime_type = 'video/quicktime' WHERE file_path ILIKE '%.mov';
+UPDATE videos SET mime_type = 'video/webm' WHERE file_path ILIKE '%.webm';
+UPDATE videos SET mime_type = 'video/x-matroska' WHERE file_path ILIKE '%.mkv';
+UPDATE videos SET mime_type = 'video/mp2t' WHERE file_path ILIKE '%.ts' OR file_path ILIKE '%.m2ts';
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS user_quotas;
+
+DROP INDEX IF EXISTS idx_videos_author_id;
+
+ALTER TABLE videos
+    DROP COLUMN IF EXISTS file_size;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS role;
@@ -0,0 +1,18 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user'; -- user или admin, от роли зависят квоты по умолчанию
+
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS file_size BIGINT NOT NULL DEFAULT 0; -- Размер исходного файла в байтах
+
+CREATE INDEX IF NOT EXISTS idx_videos_author_id ON videos (author_id);
+
+CREATE TABLE IF NOT EXISTS user_quotas
+(
+    user_id       INTEGER PRIMARY KEY,                 -- ID пользователя
+    max_bytes     BIGINT           DEFAULT NULL,       -- Суммарный размер видео (NULL - лимит роли, 0 - без ограничения)
+    max_videos    BIGINT           DEFAULT NULL,       -- Количество видео
+    max_file_size BIGINT           DEFAULT NULL,       -- Размер одного файла
+    max_duration  DOUBLE PRECISION DEFAULT NULL,       -- Длительность одного видео в секундах
+    updated_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Время последнего изменения
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+ALTER TABLE videos
+    DROP COLUMN IF EXISTS scan_status,
+    DROP COLUMN IF EXISTS rejection_reason;
@@ -0,0 +1,3 @@
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS scan_status      VARCHAR(16) NOT NULL DEFAULT '', -- pending, clean, infected; пусто - не проверялось
+    ADD COLUMN IF NOT EXISTS rejection_reason TEXT        NOT NULL DEFAULT ''; -- Причина статуса rejected
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_videos_title_trgm;
+DROP INDEX IF EXISTS idx_videos_search_vector;
+
+ALTER TABLE videos
+    DROP COLUMN IF EXISTS search_vector,
+    DROP COLUMN IF EXISTS language,
+    DROP COLUMN IF EXISTS description;
+
+DROP FUNCTION IF EXISTS video_search_config(TEXT);
@@ -0,0 +1,28 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS description   TEXT       NOT NULL DEFAULT '', -- Описание видео
+    ADD COLUMN IF NOT EXISTS language      VARCHAR(8) NOT NULL DEFAULT '', -- Язык названия и описания (ru, en), пусто - без морфологии
+    ADD COLUMN IF NOT EXISTS search_vector TSVECTOR;                       -- Поисковый вектор: название (A), теги (B), описание (C)
+
+-- Конфигурация полнотекстового поиска по языку видео
+CREATE OR REPLACE FUNCTION video_search_config(lang TEXT) RETURNS REGCONFIG
+    LANGUAGE sql
+    IMMUTABLE AS
+$$
+SELECT CASE lang
+           WHEN 'ru' THEN 'russian'::REGCONFIG
+           WHEN 'en' THEN 'english'::REGCONFIG
+           ELSE 'simple'::REGCONFIG
+           END
+$$;
+
+-- У уже загруженных видео язык определяем по наличию кириллицы в названии
+UPDATE videos SET language = CASE WHEN title ~ '[А-Яа-яЁё]' THEN 'ru' ELSE 'en' END WHERE language = '';
+
+UPDATE videos
+SET search_vector = setweight(to_tsvector(video_search_config(language), title), 'A') ||
+                    setweight(to_tsvector(video_search_config(language), description), 'C');
+
+CREATE INDEX IF NOT EXISTS idx_videos_search_vector ON videos USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_videos_title_trgm ON videos USING GIN (title gin_trgm_ops);
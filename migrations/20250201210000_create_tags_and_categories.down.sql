@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_video_views_video_id_created_at;
+DROP INDEX IF EXISTS idx_videos_category_id;
+
+ALTER TABLE videos
+    DROP COLUMN IF EXISTS category_id;
+
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS video_tags;
+DROP TABLE IF EXISTS tags;
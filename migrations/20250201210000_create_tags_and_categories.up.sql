@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS tags
+(
+    id         SERIAL PRIMARY KEY,                  -- Уникальный идентификатор тега
+    name       VARCHAR(32) NOT NULL UNIQUE,         -- Имя тега в нижнем регистре, без #
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- Время создания
+);
+
+CREATE TABLE IF NOT EXISTS video_tags
+(
+    video_id INTEGER NOT NULL, -- ID видео
+    tag_id   INTEGER NOT NULL, -- ID тега
+    PRIMARY KEY (video_id, tag_id),
+    FOREIGN KEY (video_id) REFERENCES videos (id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_tags_tag_id ON video_tags (tag_id);
+
+CREATE TABLE IF NOT EXISTS categories
+(
+    id         SERIAL PRIMARY KEY,                   -- Уникальный идентификатор раздела
+    parent_id  INTEGER      DEFAULT NULL,            -- Родительский раздел (NULL - верхний уровень)
+    slug       VARCHAR(64)  NOT NULL UNIQUE,         -- Имя раздела в URL
+    name       VARCHAR(255) NOT NULL,                -- Название раздела
+    position   INTEGER      NOT NULL DEFAULT 0,      -- Порядок среди соседних разделов
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,  -- Время создания
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,  -- Время последнего изменения
+    FOREIGN KEY (parent_id) REFERENCES categories (id) ON DELETE RESTRICT
+);
+
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories (parent_id);
+
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS category_id INTEGER DEFAULT NULL REFERENCES categories (id) ON DELETE SET NULL; -- Раздел каталога
+
+CREATE INDEX IF NOT EXISTS idx_videos_category_id ON videos (category_id);
+CREATE INDEX IF NOT EXISTS idx_video_views_video_id_created_at ON video_views (video_id, created_at);
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS playlists
+(
+    id          SERIAL PRIMARY KEY,                        -- Уникальный идентификатор плейлиста
+    owner_id    INTEGER      NOT NULL,                     -- ID владельца
+    title       VARCHAR(255) NOT NULL,                     -- Название
+    description TEXT         NOT NULL DEFAULT '',          -- Описание
+    visibility  VARCHAR(16)  NOT NULL DEFAULT 'private',   -- public, unlisted или private
+    kind        VARCHAR(16)  NOT NULL DEFAULT 'user',      -- user или watch_later (встроенный "Смотреть позже")
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,       -- Время создания
+    updated_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,       -- Время последнего изменения
+    FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_playlists_owner_id ON playlists (owner_id);
+-- У пользователя ровно один плейлист "Смотреть позже"
+CREATE UNIQUE INDEX IF NOT EXISTS idx_playlists_watch_later ON playlists (owner_id) WHERE kind = 'watch_later';
+
+CREATE TABLE IF NOT EXISTS playlist_items
+(
+    playlist_id INTEGER NOT NULL,                    -- ID плейлиста
+    video_id    INTEGER NOT NULL,                    -- ID видео
+    position    INTEGER NOT NULL,                    -- Порядок в плейлисте, с 0
+    added_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Время добавления
+    PRIMARY KEY (playlist_id, video_id),
+    FOREIGN KEY (playlist_id) REFERENCES playlists (id) ON DELETE CASCADE,
+    FOREIGN KEY (video_id) REFERENCES videos (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_playlist_items_position ON playlist_items (playlist_id, position);
+
+-- "Смотреть позже" для уже зарегистрированных пользователей
+INSERT INTO playlists (owner_id, title, visibility, kind)
+SELECT id, 'Watch later', 'private', 'watch_later'
+FROM users
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS watch_history
+(
+    user_id    INTEGER          NOT NULL,               -- ID пользователя
+    video_id   INTEGER          NOT NULL,               -- ID видео
+    position   DOUBLE PRECISION NOT NULL DEFAULT 0,     -- Последняя позиция в секундах
+    percent    DOUBLE PRECISION NOT NULL DEFAULT 0,     -- Максимальная просмотренная доля видео в процентах
+    completed  BOOLEAN          NOT NULL DEFAULT FALSE, -- Видео досмотрено
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,     -- Первый просмотр
+    watched_at TIMESTAMP        NOT NULL,               -- Последний heartbeat
+    PRIMARY KEY (user_id, video_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (video_id) REFERENCES videos (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_watch_history_user_id_watched_at ON watch_history (user_id, watched_at DESC);
@@ -0,0 +1,4 @@
+ALTER TABLE videos
+    DROP COLUMN IF EXISTS comments_disabled;
+
+DROP TABLE IF EXISTS comments;
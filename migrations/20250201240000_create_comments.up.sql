@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS comments
+(
+    id         SERIAL PRIMARY KEY,                   -- Уникальный идентификатор комментария
+    video_id   INTEGER NOT NULL,                     -- ID видео
+    author_id  INTEGER NOT NULL,                     -- ID автора комментария
+    parent_id  INTEGER   DEFAULT NULL,               -- Комментарий, на который это ответ (NULL - комментарий к видео)
+    depth      SMALLINT NOT NULL DEFAULT 0,          -- 0 - комментарий к видео, 1-2 - ответы
+    body       TEXT    NOT NULL,                     -- Текст (пустой у удалённых)
+    pinned     BOOLEAN NOT NULL DEFAULT FALSE,       -- Закреплён автором видео
+    edited_at  TIMESTAMP DEFAULT NULL,               -- Время последней правки
+    deleted_at TIMESTAMP DEFAULT NULL,               -- Время удаления
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,  -- Время публикации
+    FOREIGN KEY (video_id) REFERENCES videos (id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (parent_id) REFERENCES comments (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_video_id ON comments (video_id, depth, id);
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id, id);
+CREATE INDEX IF NOT EXISTS idx_comments_author_id_created_at ON comments (author_id, created_at);
+-- У видео закреплён не больше одного комментария
+CREATE UNIQUE INDEX IF NOT EXISTS idx_comments_pinned ON comments (video_id) WHERE pinned;
+
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS comments_disabled BOOLEAN NOT NULL DEFAULT FALSE; -- Автор отключил комментарии
@@ -0,0 +1,5 @@
+ALTER TABLE videos
+    DROP COLUMN IF EXISTS like_count,
+    DROP COLUMN IF EXISTS dislike_count;
+
+DROP TABLE IF EXISTS video_reactions;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS video_reactions
+(
+    user_id    INTEGER     NOT NULL,                 -- ID пользователя
+    video_id   INTEGER     NOT NULL,                 -- ID видео
+    kind       VARCHAR(16) NOT NULL,                 -- like или dislike
+    created_at TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Время последней смены реакции
+    PRIMARY KEY (user_id, video_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (video_id) REFERENCES videos (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_reactions_created_at ON video_reactions (created_at);
+
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS like_count    BIGINT NOT NULL DEFAULT 0, -- Количество лайков
+    ADD COLUMN IF NOT EXISTS dislike_count BIGINT NOT NULL DEFAULT 0; -- Количество дизлайков
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS subscriber_count;
+
+DROP INDEX IF EXISTS idx_videos_author_id_id;
+DROP TABLE IF EXISTS subscriptions;
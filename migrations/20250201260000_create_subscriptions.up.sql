@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS subscriptions
+(
+    subscriber_id INTEGER NOT NULL,                    -- ID подписчика
+    channel_id    INTEGER NOT NULL,                    -- ID автора, на которого подписались
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Время подписки
+    PRIMARY KEY (subscriber_id, channel_id),
+    FOREIGN KEY (subscriber_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (channel_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_channel_id ON subscriptions (channel_id);
+-- Лента подписок читает видео каждого канала с конца
+CREATE INDEX IF NOT EXISTS idx_videos_author_id_id ON videos (author_id, id DESC);
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS subscriber_count BIGINT NOT NULL DEFAULT 0; -- Число подписчиков канала
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS notifications
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL,                    -- ID получателя
+    kind       VARCHAR(32) NOT NULL,                -- Вид уведомления: video_ready, comment, new_video...
+    video_id   INTEGER,                             -- ID видео, к которому относится событие
+    comment_id INTEGER,                             -- ID комментария, к которому относится событие
+    actor_id   INTEGER,                             -- ID пользователя, вызвавшего событие
+    text       TEXT NOT NULL,                       -- Текст уведомления
+    read_at    TIMESTAMP,                           -- Время прочтения, NULL - не прочитано
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Время создания
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (video_id) REFERENCES videos (id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id_id ON notifications (user_id, id DESC);
+-- Счётчик непрочитанных
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications (user_id) WHERE read_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS notification_preferences
+(
+    user_id INTEGER NOT NULL,     -- ID пользователя
+    kind    VARCHAR(32) NOT NULL, -- Вид уведомления
+    enabled BOOLEAN NOT NULL,     -- Включён ли вид; без записи вид включён
+    PRIMARY KEY (user_id, kind),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS reports;
+DROP TABLE IF EXISTS moderation_actions;
+
+ALTER TABLE videos
+    DROP COLUMN IF EXISTS age_restricted,
+    DROP COLUMN IF EXISTS moderation_reason,
+    DROP COLUMN IF EXISTS moderation_status;
@@ -0,0 +1,44 @@
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS moderation_status VARCHAR(16) NOT NULL DEFAULT '', -- hidden, taken_down; пусто - без ограничений
+    ADD COLUMN IF NOT EXISTS moderation_reason TEXT NOT NULL DEFAULT '',        -- Причина последнего решения модератора
+    ADD COLUMN IF NOT EXISTS age_restricted    BOOLEAN NOT NULL DEFAULT FALSE;  -- Смотреть могут только авторизованные
+
+CREATE TABLE IF NOT EXISTS moderation_actions
+(
+    id           SERIAL PRIMARY KEY,
+    moderator_id INTEGER NOT NULL,                    -- ID модератора
+    target_type  VARCHAR(16) NOT NULL,                -- Объект решения: video или comment
+    target_id    INTEGER NOT NULL,                    -- ID видео или комментария
+    action       VARCHAR(32) NOT NULL,                -- hide, age_restrict, takedown, dismiss, restore
+    reason       TEXT NOT NULL DEFAULT '',            -- Пояснение модератора
+    snapshot     TEXT NOT NULL DEFAULT '',            -- Текст скрытого комментария
+    reports      BIGINT NOT NULL DEFAULT 0,           -- Сколько жалоб закрыто решением
+    created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Время решения
+    FOREIGN KEY (moderator_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_target ON moderation_actions (target_type, target_id);
+
+CREATE TABLE IF NOT EXISTS reports
+(
+    id          SERIAL PRIMARY KEY,
+    reporter_id INTEGER NOT NULL,                    -- ID пожаловавшегося пользователя
+    target_type VARCHAR(16) NOT NULL,                -- Объект жалобы: video или comment
+    target_id   INTEGER NOT NULL,                    -- ID видео или комментария
+    video_id    INTEGER NOT NULL,                    -- ID видео жалобы или видео комментария
+    reason      VARCHAR(32) NOT NULL,                -- Категория: spam, harassment, copyright...
+    details     TEXT NOT NULL DEFAULT '',            -- Пояснение пользователя
+    status      VARCHAR(16) NOT NULL DEFAULT 'open', -- open, actioned, dismissed
+    action_id   INTEGER,                             -- Решение модератора, закрывшее жалобу
+    resolved_at TIMESTAMP,                           -- Время закрытия
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Время жалобы
+    FOREIGN KEY (reporter_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (video_id) REFERENCES videos (id) ON DELETE CASCADE,
+    FOREIGN KEY (action_id) REFERENCES moderation_actions (id)
+);
+
+-- Открытая жалоба пользователя на объект одна
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_open_unique ON reports (reporter_id, target_type, target_id)
+    WHERE status = 'open';
+-- Очередь модерации группирует жалобы по объекту
+CREATE INDEX IF NOT EXISTS idx_reports_status_target ON reports (status, target_type, target_id);
@@ -0,0 +1,2 @@
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS scan_attempts INTEGER NOT NULL DEFAULT 0; -- Неудачные попытки проверки из-за недоступного сканера
@@ -0,0 +1,3 @@
+ALTER TABLE subtitle_tracks
+    DROP COLUMN IF EXISTS duration,
+    DROP COLUMN IF EXISTS segment_duration;
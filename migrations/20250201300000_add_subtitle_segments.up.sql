@@ -0,0 +1,3 @@
+ALTER TABLE subtitle_tracks
+    ADD COLUMN IF NOT EXISTS duration         DOUBLE PRECISION NOT NULL DEFAULT 0, -- Конец последней реплики в секундах
+    ADD COLUMN IF NOT EXISTS segment_duration INTEGER          NOT NULL DEFAULT 0; -- Длина сегментов HLS при нарезке, 0 - не нарезана
@@ -0,0 +1,5 @@
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS published_at TIMESTAMP NULL; -- Когда видео впервые стало публичным и готовым, подписчики уведомлены
+
+-- О готовых публичных видео подписчики уже получили уведомления
+UPDATE videos SET published_at = created_at WHERE visibility = 'public' AND status = 'ready' AND published_at IS NULL;
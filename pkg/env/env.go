@@ -0,0 +1,93 @@
+package env
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// String возвращает значение переменной окружения или значение по умолчанию.
+func String(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// Int возвращает целочисленное значение переменной окружения.
+func Int(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// Int64 возвращает значение переменной окружения типа int64.
+func Int64(key string, def int64) int64 {
+	v, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// Float возвращает значение переменной окружения с плавающей точкой.
+func Float(key string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// Bool возвращает логическое значение переменной окружения.
+func Bool(key string, def bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// Duration возвращает длительность в формате time.ParseDuration (например, 10s, 5m).
+func Duration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// List возвращает список значений, разделённых запятой.
+func List(key string, def []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	var result []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// FloatList возвращает список чисел, разделённых запятой. Некорректные значения пропускаются.
+func FloatList(key string, def []float64) []float64 {
+	items := List(key, nil)
+	if items == nil {
+		return def
+	}
+
+	var result []float64
+	for _, item := range items {
+		if v, err := strconv.ParseFloat(item, 64); err == nil {
+			result = append(result, v)
+		}
+	}
+	return result
+}